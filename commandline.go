@@ -798,6 +798,17 @@ func cmdRaw(args []string) error {
 	}
 
 	if len(rawCommand) > 0 {
+		if cleRRIClient.XMLMode && !rri.IsXML(rawCommand) {
+			// key-value input is converted to be sent in XML mode
+			query, err := rri.ParseQueryKV(rawCommand)
+			if err != nil {
+				return err
+			}
+			if rawCommand, err = query.EncodeXML(); err != nil {
+				return err
+			}
+		}
+
 		response, err := cleRRIClient.SendRaw(rawCommand)
 		if err != nil {
 			return err
@@ -809,8 +820,8 @@ func cmdRaw(args []string) error {
 			if err != nil {
 				return fmt.Errorf("RRI server returned an invalid response")
 			}
-			if !responseObj.IsSuccessful() {
-				return fmt.Errorf("RRI returned result 'failed'")
+			if err := responseObj.Err(); err != nil {
+				return err
 			}
 		}
 	}
@@ -913,7 +924,12 @@ func errorPrinter(err error) {
 }
 
 func processQuery(query *rri.Query) (bool, error) {
-	rawResponse, err := cleRRIClient.SendRaw(query.EncodeKV())
+	msg, err := cleRRIClient.EncodeQuery(query)
+	if err != nil {
+		return false, err
+	}
+
+	rawResponse, err := cleRRIClient.SendRaw(msg)
 	if err != nil {
 		return false, err
 	}
@@ -935,7 +951,7 @@ func processQuery(query *rri.Query) (bool, error) {
 	console.Print(colorEnd)
 
 	if returnErrorOnFail && !response.IsSuccessful() {
-		return false, fmt.Errorf("RRI returned result 'failed'")
+		return false, response.Err()
 	}
 	return response.IsSuccessful(), nil
 }
@@ -974,9 +990,26 @@ func readDomainData(args []string, dataOffset int) (string, rri.DomainData, erro
 		}
 	}
 
-	var nameServers []string
+	var nameServers []rri.NameServer
+	var dnsKeys []rri.DNSKey
 	if len(args) >= (dataOffset + len(handleNames)) {
-		nameServers = args[dataOffset+len(handleNames):]
+		for _, arg := range args[dataOffset+len(handleNames):] {
+			// DNSKEYs contain spaces and need to be passed as quoted argument like "dnskey=257 3 8 AwEAA..."
+			if strings.HasPrefix(strings.ToLower(arg), "dnskey=") {
+				dnsKey, err := parseDNSKey(arg[len("dnskey="):])
+				if err != nil {
+					return "", rri.DomainData{}, err
+				}
+				dnsKeys = append(dnsKeys, dnsKey)
+			} else {
+				// glue addresses need to be passed as quoted argument like "ns1.denic.de 81.91.170.1"
+				nameServer, err := parseNameServer(arg)
+				if err != nil {
+					return "", rri.DomainData{}, err
+				}
+				nameServers = append(nameServers, nameServer)
+			}
+		}
 	} else {
 		for {
 			console.Printf("NameServer> ")
@@ -987,7 +1020,26 @@ func readDomainData(args []string, dataOffset int) (string, rri.DomainData, erro
 			if len(str) == 0 {
 				break
 			}
-			nameServers = append(nameServers, str)
+			nameServer, err := parseNameServer(str)
+			if err != nil {
+				return "", rri.DomainData{}, err
+			}
+			nameServers = append(nameServers, nameServer)
+		}
+		for {
+			console.Printf("DNSKEY> ")
+			str, err := console.ReadLine()
+			if err != nil {
+				return "", rri.DomainData{}, err
+			}
+			if len(str) == 0 {
+				break
+			}
+			dnsKey, err := parseDNSKey(str)
+			if err != nil {
+				return "", rri.DomainData{}, err
+			}
+			dnsKeys = append(dnsKeys, dnsKey)
 		}
 	}
 
@@ -996,9 +1048,32 @@ func readDomainData(args []string, dataOffset int) (string, rri.DomainData, erro
 		GeneralRequestHandles: []rri.DenicHandle{handles[1]},
 		AbuseContactHandles:   []rri.DenicHandle{handles[2]},
 		NameServers:           nameServers,
+		DNSKeys:               dnsKeys,
 	}, nil
 }
 
+func parseNameServer(str string) (rri.NameServer, error) {
+	nameServer, err := rri.ParseNameServer(str)
+	if err != nil {
+		return rri.NameServer{}, fmt.Errorf("%q: %s", str, err.Error())
+	}
+	if err := nameServer.Validate(); err != nil {
+		return rri.NameServer{}, fmt.Errorf("%q: %s", str, err.Error())
+	}
+	return nameServer, nil
+}
+
+func parseDNSKey(str string) (rri.DNSKey, error) {
+	dnsKey, err := rri.ParseDNSKey(str)
+	if err != nil {
+		return rri.DNSKey{}, fmt.Errorf("%q: %s", str, err.Error())
+	}
+	if err := dnsKey.Validate(); err != nil {
+		return rri.DNSKey{}, fmt.Errorf("%q: %s", str, err.Error())
+	}
+	return dnsKey, nil
+}
+
 func readContactData(args []string, dataOffset int) (rri.DenicHandle, rri.ContactData, error) {
 	handle, err := rri.ParseDenicHandle(args[0])
 	if err != nil {
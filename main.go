@@ -36,21 +36,44 @@ var (
 	argFail          = app.Flag("fail", "Exit with code 1 if RRI returns a failed result").Bool()
 	argVerbose       = app.Flag("verbose", "Print all sent and received requests").Short('v').Bool()
 	argInsecure      = app.Flag("insecure", "Disable SSL Certificate checks").Bool()
+	argCAFile        = app.Flag("ca-file", "PEM file with root certificates to verify the RRI server with. Can be repeated").Strings()
+	argClientCert    = app.Flag("client-cert", "PEM file with client certificate for mutual TLS").String()
+	argClientKey     = app.Flag("client-key", "PEM file with client key for mutual TLS").String()
+	argPin           = app.Flag("pin", "Base64 encoded SHA-256 hash of a public key that must be contained in the verified server certificate chain. Can be repeated").Strings()
+	argServerName    = app.Flag("server-name", "Server name to verify the server certificate with").String()
+	argRecord        = app.Flag("record", "Record all sent and received requests with censored passwords to a transcript file").String()
+	argReplay        = app.Flag("replay", "Answer requests from a recorded transcript file instead of connecting to a RRI server").String()
 	argVersion       = app.Flag("version", "Display application version and exit").Bool()
 	argDumpCLIConfig = app.Flag("dump-cli-config", "Print all configured colors and signs for testing").Bool()
 )
 
 type environment struct {
-	Address  string `json:"address"`
-	User     string `json:"user"`
-	Password string `json:"pass" jcrypt:"aes"`
-	Insecure bool   `json:"insecure"`
+	Address          string   `json:"address"`
+	User             string   `json:"user"`
+	Password         string   `json:"pass" jcrypt:"aes"`
+	Insecure         bool     `json:"insecure"`
+	CAFiles          []string `json:"ca_files,omitempty"`
+	ClientCertFile   string   `json:"client_cert,omitempty"`
+	ClientKeyFile    string   `json:"client_key,omitempty"`
+	PinnedPublicKeys []string `json:"pinned_public_keys,omitempty"`
+	ServerName       string   `json:"server_name,omitempty"`
 }
 
 func (e environment) HasCredentials() bool {
 	return len(e.User) > 0 && len(e.Password) > 0
 }
 
+func (e environment) ClientConfig() *rri.ClientConfig {
+	return &rri.ClientConfig{
+		Insecure:         e.Insecure,
+		RootCAFiles:      e.CAFiles,
+		ClientCertFile:   e.ClientCertFile,
+		ClientKeyFile:    e.ClientKeyFile,
+		PinnedPublicKeys: e.PinnedPublicKeys,
+		ServerName:       e.ServerName,
+	}
+}
+
 func main() {
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -101,14 +124,25 @@ func main() {
 		}
 
 		if len(env.Address) == 0 {
-			return fmt.Errorf("missing RRI server address")
+			if len(*argReplay) == 0 {
+				return fmt.Errorf("missing RRI server address")
+			}
+			// the address is not used to replay a transcript
+			env.Address = "replay"
+		}
+
+		clientConfig := env.ClientConfig()
+		closeTranscript, err := setupTranscript(clientConfig)
+		if err != nil {
+			return err
 		}
+		defer closeTranscript()
 
-		client, err := rri.NewClient(env.Address, &rri.ClientConfig{Insecure: env.Insecure || *argInsecure})
+		client, err := rri.NewClient(env.Address, clientConfig)
 		if err != nil {
-			if !*argInsecure && strings.Contains(err.Error(), "x509") {
+			if !*argInsecure && rri.IsCertificateError(err) {
 				// show help message for x509 related errors
-				console.Println("HINT: try the '--insecure' flag if you have trouble with self signed certificates")
+				console.Println("HINT: try the '--insecure' or '--ca-file' flags if you have trouble with self signed or private certificates")
 			}
 			return err
 		}
@@ -159,7 +193,7 @@ func retrieveEnvironment(envReader *env.Reader) (environment, error) {
 	var env environment
 	if len(*argEnvironment) > 0 {
 		err = envReader.CreateOrReadEnvironment(*argEnvironment, &env)
-	} else if len(addressFromCommandLine) == 0 {
+	} else if len(addressFromCommandLine) == 0 && len(*argReplay) == 0 {
 		err = envReader.SelectEnvironment(&env)
 	}
 	if err != nil {
@@ -175,6 +209,20 @@ func retrieveEnvironment(envReader *env.Reader) (environment, error) {
 	if len(*argPassword) > 0 {
 		env.Password = *argPassword
 	}
+	if *argInsecure {
+		env.Insecure = true
+	}
+	env.CAFiles = append(env.CAFiles, *argCAFile...)
+	if len(*argClientCert) > 0 {
+		env.ClientCertFile = *argClientCert
+	}
+	if len(*argClientKey) > 0 {
+		env.ClientKeyFile = *argClientKey
+	}
+	env.PinnedPublicKeys = append(env.PinnedPublicKeys, *argPin...)
+	if len(*argServerName) > 0 {
+		env.ServerName = *argServerName
+	}
 
 	if len(env.User) > 0 && len(env.Password) == 0 {
 		// ask for missing user credentials
@@ -190,6 +238,41 @@ func retrieveEnvironment(envReader *env.Reader) (environment, error) {
 	return env, nil
 }
 
+// setupTranscript configures the client to replay and record transcripts as requested on the command line. The returned
+// function closes the recorded transcript.
+func setupTranscript(conf *rri.ClientConfig) (func(), error) {
+	closeTranscript := func() {}
+
+	if len(*argReplay) > 0 {
+		file, err := os.Open(*argReplay)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := rri.ReadTranscript(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		conf.TLSDialContextHandler = rri.NewTranscriptReplayer(entries).DialContext
+		// retried queries are not part of the transcript
+		noRetry := rri.NoRetryPolicy()
+		conf.RetryPolicy = &noRetry
+	}
+
+	if len(*argRecord) > 0 {
+		file, err := os.Create(*argRecord)
+		if err != nil {
+			return nil, err
+		}
+		conf.TLSDialContextHandler = rri.NewTranscriptWriter(file).Dialer(conf.TLSDialContextHandler)
+		closeTranscript = func() {
+			file.Close()
+		}
+	}
+
+	return closeTranscript, nil
+}
+
 func enterEnvironment(envName string, env interface{}) error {
 	e, ok := env.(*environment)
 	if !ok {
@@ -277,7 +360,7 @@ func parseQueries(str string) ([]*rri.Query, error) {
 
 	queries := make([]*rri.Query, len(queryStrings))
 	for i, queryString := range queryStrings {
-		query, err := rri.ParseQueryKV(strings.TrimSpace(queryString))
+		query, err := rri.ParseQuery(strings.TrimSpace(queryString))
 		if err != nil {
 			return nil, err
 		}
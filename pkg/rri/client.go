@@ -1,19 +1,31 @@
 package rri
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultCloseTimeout denotes how long Client.Close waits for queries in flight and the LOGOUT by default.
+const DefaultCloseTimeout = 3 * time.Second
+
 // TLSDialer is the callback function to open a new TLS connection. Maps tls.Dial by default.
 type TLSDialer func(network, addr string, config *tls.Config) (TLSConnection, error)
 
+// TLSContextDialer is the callback function to open a new TLS connection that is aborted when the context is done. Maps tls.Dialer.DialContext by default.
+type TLSContextDialer func(ctx context.Context, network, addr string, config *tls.Config) (TLSConnection, error)
+
 // TLSConnection wraps a TLS connection as denoted by *tls.Conn.
 type TLSConnection interface {
 	io.ReadWriteCloser
+	// SetDeadline sets the read and write deadlines of the connection. A zero value disables the deadline.
+	SetDeadline(t time.Time) error
 }
 
 // QueryProcessor is used to process a query directly before sending. The returned query is sent to RRI server. Return nil to abort processing.
@@ -26,35 +38,86 @@ type RawQueryPrinter func(msg string, isOutgoing bool)
 type ErrorPrinter func(err error)
 
 // Client represents a stateful connection to a specific RRI Server.
+//
+// A Client is safe for concurrent use by multiple goroutines. Queries are serialized on the single underlying connection,
+// so concurrent callers wait for their turn. The exported fields must not be modified while queries are in flight.
 type Client struct {
-	address            string
-	dialer             TLSDialer
-	connection         TLSConnection
-	tlsConfig          *tls.Config
+	address     string
+	dialer      TLSContextDialer
+	tlsConfig   *tls.Config
+	retryPolicy RetryPolicy
+	middlewares []Middleware
+	// maxMessageSize limits the size of queries and responses.
+	maxMessageSize int
+	closeTimeout   time.Duration
+	// queryLock serializes all queries and guards the connection and session state.
+	queryLock  chan struct{}
+	connection TLSConnection
+	// queryCancel releases the context of the current query and is guarded by queryLock.
+	queryCancel context.CancelFunc
+	// abort is closed to cancel queries in flight that did not finish before the close timeout.
+	abort     chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// stateMutex additionally guards the session state for readers that do not hold queryLock.
+	stateMutex         sync.Mutex
 	currentUser        string
 	lastUser, lastPass string
+	closed             bool
 	// RawQueryPrinter is called for the raw messages sent and received by the client.
 	RawQueryPrinter RawQueryPrinter
 	// InnerErrorPrinter is called to print uncritical errors that occur internally.
 	InnerErrorPrinter ErrorPrinter
-	// XMLMode controls whether the queries are sent in KeyValue or XML encoding.
+	// XMLMode sends all queries in the XML schema of the DENIC registry instead of key-value encoding. Responses are
+	// parsed in either format.
 	XMLMode bool
-	// NoAutoRetry can be used to disable automatic retry and login after connection errors.
+	// NoAutoRetry can be used to disable automatic retry and login after connection errors regardless of the RetryPolicy.
 	NoAutoRetry bool
+	// ValidateQueries enables Query.Validate for all queries before sending. Invalid queries are not sent and a
+	// *ValidationError is returned instead.
+	ValidateQueries bool
 }
 
 // ClientConfig can be used to further configure the RRI client.
 type ClientConfig struct {
 	// TLSDialHandler denotes the TLS dialer to use for the instanced RRI Client. Maps tls.Dial by default.
 	TLSDialHandler TLSDialer
+	// TLSDialContextHandler denotes the context aware TLS dialer to use for the instanced RRI Client. Takes precedence over TLSDialHandler.
+	TLSDialContextHandler TLSContextDialer
+	// RetryPolicy controls whether and when failed queries are retried. Uses DefaultRetryPolicy if not set.
+	RetryPolicy *RetryPolicy
+	// Middlewares are passed to Client.Use for the instanced RRI Client.
+	Middlewares []Middleware
 	// Insecure allows to accept self-signed SSL certificates.
 	Insecure bool
 	// MinTLSVersion denotes the minimum accepted TLS version.
 	MinTLSVersion uint16
+	// ServerName overrides the host name that is used to verify the server certificate.
+	ServerName string
+	// RootCAs denotes the root certificates to verify the server certificate with. Uses the system pool if not set.
+	RootCAs *x509.CertPool
+	// RootCAFiles denotes PEM files with additional root certificates. Only these and RootCAs are trusted if set.
+	RootCAFiles []string
+	// ClientCertificates are presented to the server for mutual TLS authentication.
+	ClientCertificates []tls.Certificate
+	// ClientCertFile and ClientKeyFile denote PEM files of an additional client certificate for mutual TLS authentication.
+	ClientCertFile, ClientKeyFile string
+	// PinnedPublicKeys restricts the accepted server certificate chains to verified ones containing any of the given public keys as returned by SPKIHash.
+	// Only the server certificate itself is compared for insecure connections.
+	PinnedPublicKeys []string
+	// MaxMessageSize denotes the maximum size of queries and responses in bytes. Uses DefaultMaxMessageSize if not set.
+	MaxMessageSize int
+	// CloseTimeout denotes how long Close waits for queries in flight and the LOGOUT. Uses DefaultCloseTimeout if not set.
+	CloseTimeout time.Duration
 }
 
 // NewClient returns a new Client object for the given RRI Server.
 func NewClient(address string, conf *ClientConfig) (*Client, error) {
+	return NewClientContext(context.Background(), address, conf)
+}
+
+// NewClientContext returns a new Client object for the given RRI Server. The context is only used to establish the initial connection.
+func NewClientContext(ctx context.Context, address string, conf *ClientConfig) (*Client, error) {
 	var actualConf ClientConfig
 	if conf != nil {
 		// create copy of config to operate on
@@ -63,42 +126,139 @@ func NewClient(address string, conf *ClientConfig) (*Client, error) {
 	if !strings.ContainsRune(address, ':') {
 		address += ":51131"
 	}
-	if actualConf.TLSDialHandler == nil {
-		// use tls.Dial by default to establish a tls connection
-		actualConf.TLSDialHandler = func(network, addr string, config *tls.Config) (TLSConnection, error) {
-			return tls.Dial(network, addr, config)
+	if actualConf.TLSDialContextHandler == nil {
+		if actualConf.TLSDialHandler != nil {
+			// legacy dialers cannot be aborted, the context is only checked afterwards
+			dialHandler := actualConf.TLSDialHandler
+			actualConf.TLSDialContextHandler = func(ctx context.Context, network, addr string, config *tls.Config) (TLSConnection, error) {
+				return dialHandler(network, addr, config)
+			}
+		} else {
+			actualConf.TLSDialContextHandler = dialTLS
 		}
 	}
+	if actualConf.MaxMessageSize <= 0 {
+		actualConf.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if actualConf.CloseTimeout <= 0 {
+		actualConf.CloseTimeout = DefaultCloseTimeout
+	}
 	if actualConf.MinTLSVersion <= 0 {
 		actualConf.MinTLSVersion = tls.VersionTLS13
 	}
 
+	tlsConfig, err := newClientTLSConfig(actualConf)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &Client{
-		address: address,
-		dialer:  actualConf.TLSDialHandler,
-		tlsConfig: &tls.Config{
-			MinVersion:         actualConf.MinTLSVersion,
-			InsecureSkipVerify: actualConf.Insecure,
-		},
+		address:        address,
+		dialer:         actualConf.TLSDialContextHandler,
+		tlsConfig:      tlsConfig,
+		retryPolicy:    actualConf.RetryPolicy.withDefaults(),
+		maxMessageSize: actualConf.MaxMessageSize,
+		closeTimeout:   actualConf.CloseTimeout,
+		queryLock:      make(chan struct{}, 1),
+		abort:          make(chan struct{}),
 	}
+	client.Use(actualConf.Middlewares...)
 
-	if err := client.setupConnection(); err != nil {
+	if err := client.setupConnection(ctx); err != nil {
 		return nil, err
 	}
 
 	return client, nil
 }
 
-func (client *Client) setupConnection() error {
+// dialTLS uses tls.Dialer to establish a tls connection. It is used if no dialer is configured.
+func dialTLS(ctx context.Context, network, addr string, config *tls.Config) (TLSConnection, error) {
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (client *Client) setupConnection(ctx context.Context) error {
 	if client.connection == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var err error
-		client.connection, err = client.dialer("tcp", client.address, client.tlsConfig)
-		client.currentUser = ""
+		client.connection, err = client.dialer(ctx, "tcp", client.address, client.tlsConfig)
+		client.setCurrentUser("")
+		if err == nil && ctx.Err() != nil {
+			// the dialer might have ignored the context
+			client.closeConnection()
+			return ctx.Err()
+		}
 		return err
 	}
 	return nil
 }
 
+// lock acquires exclusive access to the connection or returns an error if the context is done before or the client is
+// closed. The returned context is additionally canceled if Close aborts the query.
+func (client *Client) lock(ctx context.Context) (context.Context, error) {
+	select {
+	case client.queryLock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if client.isClosed() {
+		<-client.queryLock
+		return nil, ErrClientClosed
+	}
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-client.abort:
+			cancel()
+		case <-queryCtx.Done():
+		}
+	}()
+	client.queryCancel = cancel
+	return queryCtx, nil
+}
+
+func (client *Client) unlock() {
+	client.queryCancel()
+	client.queryCancel = nil
+	<-client.queryLock
+}
+
+// abortError returns ErrClientClosed instead of the cancellation error of a query that has been aborted by Close. ctx
+// denotes the context passed by the caller.
+func (client *Client) abortError(ctx context.Context, err error) error {
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return ErrClientClosed
+	}
+	return err
+}
+
+func (client *Client) isClosed() bool {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	return client.closed
+}
+
+func (client *Client) setCurrentUser(user string) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	client.currentUser = user
+}
+
+func (client *Client) setSession(user, pass string) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	client.currentUser = user
+	client.lastUser = user
+	client.lastPass = pass
+}
+
 // RemoteAddress returns the RRI server address and port.
 func (client *Client) RemoteAddress() string {
 	return client.address
@@ -106,34 +266,74 @@ func (client *Client) RemoteAddress() string {
 
 // IsLoggedIn returns whether the client is currently logged in.
 func (client *Client) IsLoggedIn() bool {
-	return len(client.currentUser) > 0
+	return len(client.CurrentUser()) > 0
 }
 
 // CurrentUser returns the currently logged in user.
 func (client *Client) CurrentUser() string {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
 	return client.currentUser
 }
 
 // CurrentRegAccID tries to parse the RegAccID from CurrentUser.
 func (client *Client) CurrentRegAccID() (int, error) {
-	parts := strings.Split(client.currentUser, "-")
-	if len(parts) < 2 {
-		return 0, fmt.Errorf("malformed login name")
-	}
-	regAccID, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return 0, fmt.Errorf("malformed login name")
-	}
-	return regAccID, nil
+	return parseRegAccID(client.CurrentUser())
 }
 
-// Close closes the underlying connection.
+// Close sends LOGOUT if logged in and closes the underlying connection. Stored credentials are cleared and all following
+// queries return ErrClientClosed.
+//
+// Close waits up to ClientConfig.CloseTimeout for queries in flight to finish and the LOGOUT to be answered. Queries
+// still in flight afterwards are aborted with ErrClientClosed. It is safe to call Close multiple times and concurrently
+// with queries, every call returns the result of the first one.
 func (client *Client) Close() error {
-	if client.connection != nil {
-		//TODO send LOGOUT while connected?
-		return client.closeConnection()
+	return client.close(true, client.closeTimeout)
+}
+
+// CloseNoLogout is like Close but does not send LOGOUT, the session is left to time out on the server.
+func (client *Client) CloseNoLogout() error {
+	return client.close(false, client.closeTimeout)
+}
+
+// close waits up to timeout for queries in flight and the LOGOUT.
+func (client *Client) close(logout bool, timeout time.Duration) error {
+	client.closeOnce.Do(func() {
+		client.stateMutex.Lock()
+		client.closed = true
+		client.stateMutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		select {
+		case client.queryLock <- struct{}{}:
+		case <-ctx.Done():
+			close(client.abort)
+			client.queryLock <- struct{}{}
+		}
+		defer func() {
+			<-client.queryLock
+		}()
+
+		if logout && ctx.Err() == nil && client.connection != nil && len(client.CurrentUser()) > 0 {
+			client.logoutOnClose(ctx)
+		}
+		client.setSession("", "")
+		client.closeErr = client.closeConnection()
+	})
+	return client.closeErr
+}
+
+// logoutOnClose sends LOGOUT directly, neither middlewares nor retries are applied while closing.
+func (client *Client) logoutOnClose(ctx context.Context) {
+	msg, err := client.EncodeQuery(NewLogoutQuery())
+	if err == nil {
+		_, _, err = client.exchange(ctx, msg)
+	}
+	// the server might close the connection without responding
+	if err != nil && err != io.EOF && client.InnerErrorPrinter != nil {
+		client.InnerErrorPrinter(fmt.Errorf("logout on close failed: %s", err))
 	}
-	return nil
 }
 
 func (client *Client) closeConnection() error {
@@ -160,13 +360,28 @@ func (client *Client) closeConnection() error {
 
 // Login sends a login request to the server and checks for a success result.
 func (client *Client) Login(username, password string) error {
-	r, err := client.SendQuery(NewLoginQuery(username, password))
+	return client.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext sends a login request to the server and checks for a success result. The query is aborted when the context is done.
+func (client *Client) LoginContext(ctx context.Context, username, password string) error {
+	queryCtx, err := client.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.unlock()
+
+	return client.abortError(ctx, client.login(queryCtx, username, password))
+}
+
+func (client *Client) login(ctx context.Context, username, password string) error {
+	r, err := client.sendQuery(ctx, NewLoginQuery(username, password))
 	if err != nil {
 		return err
 	}
 
 	if r != nil && !r.IsSuccessful() {
-		return fmt.Errorf("login failed")
+		return fmt.Errorf("login failed: %w", NewBusinessError(r))
 	}
 
 	return err
@@ -174,7 +389,12 @@ func (client *Client) Login(username, password string) error {
 
 // Logout sends a logout request to the server.
 func (client *Client) Logout() error {
-	_, err := client.SendQuery(NewLogoutQuery())
+	return client.LogoutContext(context.Background())
+}
+
+// LogoutContext sends a logout request to the server. The query is aborted when the context is done.
+func (client *Client) LogoutContext(ctx context.Context) error {
+	_, err := client.SendQueryContext(ctx, NewLogoutQuery())
 	return err
 }
 
@@ -182,28 +402,68 @@ func (client *Client) Logout() error {
 //
 // Only technical errors are returned. You need to check Response.Result to check for RRI error responses.
 func (client *Client) SendQuery(query *Query) (*Response, error) {
-	if client.XMLMode {
-		return nil, fmt.Errorf("XML mode not yet supported")
+	return client.SendQueryContext(context.Background(), query)
+}
+
+// SendQueryContext sends a query to the server and returns the response. The query is aborted when the context is done.
+//
+// Only technical errors are returned. You need to check Response.Result to check for RRI error responses.
+func (client *Client) SendQueryContext(ctx context.Context, query *Query) (*Response, error) {
+	queryCtx, err := client.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.unlock()
+
+	response, err := client.sendQuery(queryCtx, query)
+	return response, client.abortError(ctx, err)
+}
+
+func (client *Client) sendQuery(ctx context.Context, query *Query) (*Response, error) {
+	return client.chain()(ctx, query)
+}
+
+// sendQueryDirect sends a query without passing it through the middleware chain.
+func (client *Client) sendQueryDirect(ctx context.Context, query *Query) (*Response, error) {
+	if client.ValidateQueries {
+		if err := query.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if client.connection == nil && len(client.lastUser) > 0 && query.Action() != ActionLogin {
+		// the connection has been discarded after an aborted query or the session could not be restored
+		if query.Action() == ActionLogout {
+			client.setSession("", "")
+			return nil, nil
+		}
+		if err := client.restoreSession(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	if !client.IsLoggedIn() && query.Action() != ActionLogin {
-		return nil, fmt.Errorf("need to log in before sending action %s", query.Action())
+	isLoggedIn := len(client.currentUser) > 0
+	if !isLoggedIn && query.Action() != ActionLogin {
+		return nil, fmt.Errorf("%w: need to log in before sending action %s", ErrNotLoggedIn, query.Action())
 	}
-	if client.IsLoggedIn() && query.Action() == ActionLogin {
-		return nil, fmt.Errorf("already logged in")
+	if isLoggedIn && query.Action() == ActionLogin {
+		return nil, ErrAlreadyLoggedIn
 	}
 
 	if query.Action() == ActionLogout {
 		defer func() {
 			// after action logout the connection and session are closed
 			client.connection = nil
-			client.currentUser = ""
-			client.lastUser = ""
-			client.lastPass = ""
+			client.setSession("", "")
 		}()
 	}
 
-	rawResponse, err := client.SendRaw(query.EncodeKV())
+	msg, err := client.EncodeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rawResponse, err := client.sendRaw(ctx, msg, query.Action())
 	if err != nil {
 		if err == io.EOF && query.Action() == ActionLogout {
 			// the server will immediately close the connection once LOGOUT is received
@@ -214,85 +474,191 @@ func (client *Client) SendQuery(query *Query) (*Response, error) {
 
 	response, err := ParseResponse(rawResponse)
 	if err != nil {
-		return nil, fmt.Errorf("received malformed response: %s", err.Error())
+		return nil, &ProtocolError{"received malformed response", err}
 	}
 
 	if query.Action() == ActionLogin && response.IsSuccessful() {
-		client.currentUser = query.FirstField(QueryFieldNameUser)
 		// save credentials to restore session after lost connections
-		client.lastUser = client.currentUser
-		pwField := query.Field(QueryFieldNamePassword)
-		if len(pwField) > 0 {
-			client.lastPass = query.Field(QueryFieldNamePassword)[0]
-		} else {
-			client.lastPass = ""
-		}
+		client.setSession(query.FirstField(QueryFieldNameUser), query.FirstField(QueryFieldNamePassword))
 	}
 
 	return response, nil
 }
 
+// EncodeQuery returns the query in the format used by the client, which is XML if XMLMode is set and key-value
+// encoding otherwise.
+func (client *Client) EncodeQuery(query *Query) (string, error) {
+	if client.XMLMode {
+		return query.EncodeXML()
+	}
+	return query.EncodeKV(), nil
+}
+
 // SendRaw sends a raw message to RRI and reads the returns the raw response.
 //
 // This method should be used with caution as it does not update the client login state.
 func (client *Client) SendRaw(msg string) (string, error) {
-	// ensure connection is established
-	if err := client.setupConnection(); err != nil {
+	return client.SendRawContext(context.Background(), msg)
+}
+
+// SendRawContext sends a raw message to RRI and reads the returns the raw response. When the context is done, the
+// query is aborted and the connection is discarded, as it is left in an undefined state.
+//
+// This method should be used with caution as it does not update the client login state.
+func (client *Client) SendRawContext(ctx context.Context, msg string) (string, error) {
+	queryCtx, err := client.lock(ctx)
+	if err != nil {
 		return "", err
 	}
+	defer client.unlock()
 
-	buffer := prepareMessage(msg)
+	// the action is required to decide about retries
+	var action QueryAction
+	if query, err := ParseQuery(msg); err == nil {
+		action = query.Action()
+	}
+	response, err := client.sendRaw(queryCtx, msg, action)
+	return response, client.abortError(ctx, err)
+}
 
-	if client.RawQueryPrinter != nil {
-		client.RawQueryPrinter(msg, true)
+func (client *Client) sendRaw(ctx context.Context, msg string, action QueryAction) (string, error) {
+	if len(msg) > client.maxMessageSize {
+		return "", ErrMessageTooLarge
 	}
-	response, err := client.sendAndReceive(buffer)
-	if err != nil {
-		if client.NoAutoRetry {
-			return "", err
-		}
 
-		if client.InnerErrorPrinter != nil {
-			client.InnerErrorPrinter(fmt.Errorf("query failed: %s", err))
+	for attempt := 1; ; attempt++ {
+		var response string
+		var sent bool
+		var err error
+		if attempt == 1 {
+			// ensure connection is established
+			err = client.setupConnection(ctx)
+		} else {
+			err = client.restoreSession(ctx)
+		}
+		if err == nil {
+			response, sent, err = client.exchange(ctx, msg)
+			if err == nil {
+				return response, nil
+			}
 		}
 
-		// try re-establishing lost connection once
-		if client.connection != nil {
+		if ctxErr := contextError(ctx); ctxErr != nil {
 			// ignore close errors (connection will be discarded anyway)
 			client.closeConnection()
+			return "", ctxErr
 		}
-		if err := client.setupConnection(); err != nil {
-			return "", fmt.Errorf("failed to restore lost connection: %s", err.Error())
+		if client.NoAutoRetry {
+			return "", err
 		}
-		// restore authenticated session if it existed before
-		if len(client.lastUser) > 0 && len(client.lastPass) > 0 {
-			if err := client.Login(client.lastUser, client.lastPass); err != nil {
-				return "", fmt.Errorf("failed to restore session: %s", err.Error())
-			}
+		// the connection is in an undefined state after errors and is re-established for the next attempt
+		client.closeConnection()
+
+		if attempt >= client.retryPolicy.MaxAttempts || !client.retryPolicy.ShouldRetry(action, err, !sent) {
+			return "", err
 		}
-		// retry sending request once
-		if client.RawQueryPrinter != nil {
-			client.RawQueryPrinter(msg, true)
+		if client.InnerErrorPrinter != nil {
+			client.InnerErrorPrinter(fmt.Errorf("query failed: %s", err))
 		}
-		response, err = client.sendAndReceive(buffer)
-		if err != nil {
+		if err := client.retryPolicy.wait(ctx, attempt); err != nil {
 			return "", err
 		}
 	}
+}
 
+// exchange sends a single message on the current connection and returns the raw response. The returned bool denotes
+// whether the message has been sent completely and thus might have been processed by the server.
+func (client *Client) exchange(ctx context.Context, msg string) (string, bool, error) {
+	if client.RawQueryPrinter != nil {
+		client.RawQueryPrinter(msg, true)
+	}
+	response, sent, err := client.sendAndReceive(ctx, msg)
+	if err != nil {
+		return "", sent, err
+	}
 	if client.RawQueryPrinter != nil {
 		client.RawQueryPrinter(response, false)
 	}
-	return response, nil
+	return response, true, nil
 }
 
-func (client *Client) sendAndReceive(msg []byte) (string, error) {
-	n, err := client.connection.Write(msg)
-	if err != nil {
-		return "", err
+// contextError returns the context error if the context is done or its deadline has passed.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// connection deadlines might expire slightly before the context is done
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// restoreSession re-establishes the connection and logs in with the last known credentials.
+func (client *Client) restoreSession(ctx context.Context) error {
+	if err := client.setupConnection(ctx); err != nil {
+		return &ReconnectError{false, err}
+	}
+	// restore authenticated session if it existed before
+	if len(client.lastUser) > 0 && len(client.lastPass) > 0 {
+		// send login directly as retries are handled by the caller
+		msg, err := client.EncodeQuery(NewLoginQuery(client.lastUser, client.lastPass))
+		if err != nil {
+			client.closeConnection()
+			return &ReconnectError{true, err}
+		}
+		rawResponse, _, err := client.exchange(ctx, msg)
+		if err != nil {
+			// discard the connection to retry restoring the session with the next query
+			client.closeConnection()
+			return &ReconnectError{true, err}
+		}
+		response, err := ParseResponse(rawResponse)
+		if err != nil {
+			client.closeConnection()
+			return &ReconnectError{true, &ProtocolError{"received malformed response", err}}
+		}
+		if !response.IsSuccessful() {
+			client.closeConnection()
+			return &ReconnectError{true, fmt.Errorf("login failed: %w", NewBusinessError(response))}
+		}
+		client.setCurrentUser(client.lastUser)
 	}
-	if n != len(msg) {
-		return "", fmt.Errorf("failed to send %d bytes", len(msg))
+	return nil
+}
+
+// sendAndReceive writes a message and reads the response. The returned bool denotes whether the message has been
+// written completely.
+func (client *Client) sendAndReceive(ctx context.Context, msg string) (string, bool, error) {
+	// apply the context deadline or reset deadlines of previous queries
+	deadline, _ := ctx.Deadline()
+	if err := client.connection.SetDeadline(deadline); err != nil {
+		return "", false, err
+	}
+	if ctx.Done() != nil {
+		// force pending reads and writes to return immediately on cancellation
+		done := make(chan struct{})
+		exited := make(chan struct{})
+		defer func() {
+			// the deadline must not be touched anymore once the next query owns the connection
+			close(done)
+			<-exited
+		}()
+		conn := client.connection
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				conn.SetDeadline(time.Unix(1, 0))
+			case <-done:
+			}
+		}()
+	}
+
+	// the server can only process a completely received message
+	if err := NewFrameWriter(client.connection, client.maxMessageSize).WriteFrame(msg); err != nil {
+		return "", false, err
 	}
-	return readMessage(client.connection)
+	response, err := NewFrameReader(client.connection, client.maxMessageSize).ReadFrame()
+	return response, true, err
 }
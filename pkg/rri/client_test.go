@@ -1,10 +1,13 @@
 package rri
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -44,6 +47,193 @@ func TestClient(t *testing.T) {
 	})
 }
 
+func TestClientXMLMode(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		var rawQueries []string
+		client.RawQueryPrinter = func(msg string, isOutgoing bool) {
+			if isOutgoing {
+				rawQueries = append(rawQueries, msg)
+			}
+		}
+
+		client.XMLMode = true
+		response, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.True(t, response.IsSuccessful())
+		require.Len(t, rawQueries, 1)
+		assert.Equal(t, MessageFormatXML, DetectMessageFormat(rawQueries[0]))
+		require.Len(t, server.Queries(), 2)
+		assert.Equal(t, "denic.de", server.Queries()[1].FirstField(QueryFieldNameDomainIDN))
+
+		// queries that cannot be represented in the XML schema are not sent
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de").WithEntity("Empty", nil))
+		assert.ErrorIs(t, err, ErrXMLUnsupported)
+		assert.Len(t, rawQueries, 1)
+
+		// logout is sent in XML as well
+		require.NoError(t, client.Logout())
+		require.Len(t, rawQueries, 2)
+		assert.Equal(t, MessageFormatXML, DetectMessageFormat(rawQueries[1]))
+
+		client.XMLMode = false
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		require.Len(t, rawQueries, 4)
+		assert.False(t, IsXML(rawQueries[3]))
+	})
+}
+
+func TestClientContext(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		release := make(chan struct{})
+		defer close(release)
+		cancelEntered := make(chan struct{}, 1)
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			if query.Action() == ActionCheck {
+				if query.FirstField(QueryFieldNameDomainIDN) == "cancel.de" {
+					cancelEntered <- struct{}{}
+				}
+				// simulate a stalled registry
+				<-release
+			}
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		_, err := NewClientContext(newCanceledContext(), server.Address(), &ClientConfig{Insecure: true})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		client, err := NewClientContext(context.Background(), server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.LoginContext(context.Background(), "DENIC-1000011-TEST", "secret"))
+
+		t.Run("Deadline", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := client.SendQueryContext(ctx, NewCheckDomainQuery("denic.de"))
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), 2*time.Second)
+			assert.Nil(t, client.connection, "broken connection must be discarded")
+		})
+
+		t.Run("Cancel", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				// cancel once the query is in flight
+				<-cancelEntered
+				cancel()
+			}()
+			_, err := client.SendQueryContext(ctx, NewCheckDomainQuery("cancel.de"))
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Nil(t, client.connection, "broken connection must be discarded")
+		})
+
+		t.Run("RestoreSession", func(t *testing.T) {
+			response, err := client.SendQueryContext(context.Background(), NewInfoDomainQuery("denic.de"))
+			require.NoError(t, err)
+			assert.True(t, response.IsSuccessful())
+			assert.Equal(t, "DENIC-1000011-TEST", client.CurrentUser())
+		})
+
+		t.Run("Canceled", func(t *testing.T) {
+			_, err := client.SendQueryContext(newCanceledContext(), NewInfoDomainQuery("denic.de"))
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+	})
+}
+
+func newCanceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestClientConcurrentQueries(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			// echo the domain to detect interleaved queries and responses
+			fields := NewResponseFieldList()
+			fields.Add("Domain", query.FirstField(QueryFieldNameDomainIDN))
+			return NewResponse(ResultSuccess, fields), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					domain := fmt.Sprintf("domain-%d-%d.de", i, j)
+					response, err := client.SendQuery(NewInfoDomainQuery(domain))
+					if assert.NoError(t, err) {
+						assert.Equal(t, domain, response.FirstField("Domain"))
+					}
+					assert.True(t, client.IsLoggedIn())
+					assert.Equal(t, "DENIC-1000011-TEST", client.CurrentUser())
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func TestClientConcurrentLock(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			if query.Action() == ActionCheck {
+				close(entered)
+				<-release
+			}
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		blockingQueryDone := make(chan struct{})
+		go func() {
+			defer close(blockingQueryDone)
+			_, err := client.SendQuery(NewCheckDomainQuery("denic.de"))
+			assert.NoError(t, err)
+		}()
+		// wait for the blocking query to hold the connection
+		<-entered
+
+		// waiting for the connection must respect the context
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = client.SendQueryContext(ctx, NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, client.IsLoggedIn(), "session state must be readable while a query is in flight")
+
+		close(release)
+		<-blockingQueryDone
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.NoError(t, err)
+	})
+}
+
 func TestClientConfDefaults(t *testing.T) {
 	dialCount := 0
 	client, err := NewClient("localhost", &ClientConfig{
@@ -99,7 +289,8 @@ func TestClientNoAutoRetry(t *testing.T) {
 		},
 	})
 	require.NoError(t, err)
-	defer client.Close()
+	// the mocked connection does not expect a LOGOUT
+	defer client.CloseNoLogout()
 
 	require.NoError(t, client.Login("DENIC-1000011-RRI", "secret"))
 	client.NoAutoRetry = true
@@ -133,7 +324,8 @@ func TestClientAutoRetry(t *testing.T) {
 		},
 	})
 	require.NoError(t, err)
-	defer client.Close()
+	// the mocked connection does not expect a LOGOUT
+	defer client.CloseNoLogout()
 
 	require.NoError(t, client.Login("DENIC-1000011-RRI", "secret"))
 	resp, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
@@ -146,6 +338,131 @@ func TestClientAutoRetry(t *testing.T) {
 	conn.AssertComplete()
 }
 
+func TestClientClose(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		require.NoError(t, client.Close())
+		require.Len(t, server.Queries(), 2)
+		assert.Equal(t, ActionLogout, server.Queries()[1].Action())
+		assert.False(t, client.IsLoggedIn())
+		assert.Empty(t, client.lastUser)
+		assert.Empty(t, client.lastPass)
+
+		// closing again has no effect and the client cannot be used anymore
+		assert.NoError(t, client.Close())
+		assert.NoError(t, client.CloseNoLogout())
+		_, err = client.SendQuery(NewCheckDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, ErrClientClosed)
+		assert.ErrorIs(t, client.Login("DENIC-1000011-TEST", "secret"), ErrClientClosed)
+		assert.Len(t, server.Queries(), 2)
+	})
+}
+
+func TestClientCloseNoLogout(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		require.NoError(t, client.CloseNoLogout())
+		assert.Len(t, server.Queries(), 1)
+		assert.Empty(t, client.lastUser)
+		assert.Empty(t, client.lastPass)
+		assert.NoError(t, client.Close())
+		assert.Len(t, server.Queries(), 1)
+	})
+}
+
+func TestClientCloseInFlight(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			if query.Action() == ActionCheck {
+				close(entered)
+				<-release
+			}
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true, CloseTimeout: 100 * time.Millisecond})
+		require.NoError(t, err)
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		queryErr := make(chan error, 1)
+		go func() {
+			_, err := client.SendQuery(NewCheckDomainQuery("denic.de"))
+			queryErr <- err
+		}()
+		<-entered
+
+		start := time.Now()
+		require.NoError(t, client.Close())
+		assert.Less(t, time.Since(start), time.Second)
+		assert.ErrorIs(t, <-queryErr, ErrClientClosed)
+		// the connection of the aborted query is discarded, so LOGOUT cannot be sent
+		for _, query := range server.Queries() {
+			assert.NotEqual(t, ActionLogout, query.Action())
+		}
+	})
+}
+
+func TestClientCancelDuringResponse(t *testing.T) {
+	conn := &deadlineConn{mockReadWriteCloser: newMockReadWriteCloser(t, []readResponse{
+		{[]byte{0, 0, 0, 15}, nil},
+		{[]byte("RESULT: success"), nil},
+		{[]byte{0, 0, 0, 15}, nil},
+		{[]byte("RESULT: success"), nil},
+	}, []writeResponse{
+		{prepareMessage("first"), nil},
+		{prepareMessage("second"), nil},
+	}), abortEntered: make(chan struct{}), abortRelease: make(chan struct{})}
+	client := &Client{connection: conn, maxMessageSize: DefaultMaxMessageSize}
+
+	// cancel the first query while its response is read and the abort is applied too late to interrupt reading
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn.afterRead = func(readIndex int) {
+		if readIndex == 1 {
+			cancel()
+			<-conn.abortEntered
+		}
+	}
+	type result struct {
+		response string
+		err      error
+	}
+	firstDone := make(chan result, 1)
+	go func() {
+		response, _, err := client.sendAndReceive(ctx, "first")
+		firstDone <- result{response, err}
+	}()
+	<-conn.abortEntered
+	select {
+	case <-firstDone:
+		t.Fatal("query must wait for the pending abort")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(conn.abortRelease)
+	first := <-firstDone
+	require.NoError(t, first.err)
+	assert.Equal(t, "RESULT: success", first.response)
+	assert.Equal(t, 0, conn.PendingAborts(), "deadline is still modified after the query returned")
+
+	// the cancellation of the first query must not expire the deadline of the next one
+	response, _, err := client.sendAndReceive(context.Background(), "second")
+	require.NoError(t, err)
+	assert.Equal(t, "RESULT: success", response)
+	conn.AssertComplete()
+}
+
 type mockReadWriteCloser struct {
 	ReadResponses  []readResponse
 	ReadIndex      int
@@ -211,3 +528,62 @@ func (m *mockReadWriteCloser) Write(p []byte) (int, error) {
 func (m *mockReadWriteCloser) Close() error {
 	return nil
 }
+
+func (m *mockReadWriteCloser) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// deadlineConn fails reads after a deadline in the past has been set, like a real connection does.
+type deadlineConn struct {
+	*mockReadWriteCloser
+	deadlineMutex sync.Mutex
+	deadline      time.Time
+	pendingAborts int
+	afterRead     func(readIndex int)
+	// abortEntered is closed once a deadline in the past is about to be set.
+	abortEntered chan struct{}
+	// abortRelease blocks setting deadlines in the past until closed to simulate a slowly scheduled abort.
+	abortRelease chan struct{}
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	c.deadlineMutex.Lock()
+	expired := !c.deadline.IsZero() && c.deadline.Before(time.Now())
+	c.deadlineMutex.Unlock()
+	if expired {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	n, err := c.mockReadWriteCloser.Read(p)
+	if c.afterRead != nil {
+		c.afterRead(c.ReadIndex)
+	}
+	return n, err
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	if !t.IsZero() && t.Before(time.Now()) {
+		c.deadlineMutex.Lock()
+		c.pendingAborts++
+		c.deadlineMutex.Unlock()
+		close(c.abortEntered)
+		<-c.abortRelease
+		defer func() {
+			c.deadlineMutex.Lock()
+			c.pendingAborts--
+			c.deadlineMutex.Unlock()
+		}()
+	}
+
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// PendingAborts returns the number of deadlines in the past that are currently being set.
+func (c *deadlineConn) PendingAborts() int {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	return c.pendingAborts
+}
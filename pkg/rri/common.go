@@ -5,8 +5,29 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strings"
 )
 
+const (
+	// MessageFormatAuto denotes that the message format is chosen automatically.
+	MessageFormatAuto MessageFormat = ""
+	// MessageFormatKV denotes the key-value message format.
+	MessageFormatKV MessageFormat = "KV"
+	// MessageFormatXML denotes the XML schema of the DENIC registry (http://registry.denic.de/global/5.0).
+	MessageFormatXML MessageFormat = "XML"
+)
+
+// MessageFormat represents the encoding of a raw RRI query or response.
+type MessageFormat string
+
+// DetectMessageFormat returns the format of a raw query or response.
+func DetectMessageFormat(msg string) MessageFormat {
+	if IsXML(msg) {
+		return MessageFormatXML
+	}
+	return MessageFormatKV
+}
+
 func prepareMessage(msg string) []byte {
 	// prepare data packet: 4 byte message length + actual message
 	data := []byte(msg)
@@ -16,63 +37,53 @@ func prepareMessage(msg string) []byte {
 	return buffer
 }
 
+// readMessage reads a single message limited to DefaultMaxMessageSize.
 func readMessage(r io.Reader) (string, error) {
-	lenBuffer, err := readBytes(r, 4)
-	if err != nil {
-		return "", err
-	}
-	len := binary.BigEndian.Uint32(lenBuffer)
-	if len == 0 {
-		return "", fmt.Errorf("message is empty")
-	}
-	if len > 65536 || int(len) < 0 {
-		return "", fmt.Errorf("message too large")
-	}
-
-	buffer, err := readBytes(r, int(len))
-	if err != nil {
-		return "", err
-	}
-
-	return string(buffer), nil
+	return NewFrameReader(r, DefaultMaxMessageSize).ReadFrame()
 }
 
 func readBytes(r io.Reader, count int) ([]byte, error) {
 	buffer := make([]byte, count)
-	received := 0
+	if err := readFull(r, buffer); err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
 
-	for received < count {
-		len, err := r.Read(buffer[received:])
+// readFull fills the buffer completely. In contrast to io.ReadFull, io.EOF is returned as is even after a partial read.
+func readFull(r io.Reader, buffer []byte) error {
+	received := 0
+	for received < len(buffer) {
+		n, err := r.Read(buffer[received:])
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if len == 0 {
-			return nil, fmt.Errorf("failed to read %d bytes from connection", count)
+		if n == 0 {
+			return &ProtocolError{fmt.Sprintf("failed to read %d bytes from connection", len(buffer)), nil}
 		}
 
-		received += len
+		received += n
 	}
 
-	return buffer, nil
+	return nil
 }
 
 // IsXML returns whether the message seems to contain a XML encoded query or response.
 func IsXML(msg string) bool {
-	//TODO xml detection
-	return false
+	// key-value messages never start with '<' as field names are expected first
+	return strings.HasPrefix(strings.TrimSpace(msg), "<")
 }
 
-// CensorRawMessage replaces passwords in a raw query with '******'.
+var (
+	censorKVPattern  = regexp.MustCompile(`(?im)^((?:password|authinfo):[ \t]+)[^\r\n]*`)
+	censorXMLPattern = regexp.MustCompile(`(?i)(<(?:[a-z]+:)?(?:password|authinfo)(?:\s[^>]*)?>)([^<]*)(</(?:[a-z]+:)?(?:password|authinfo)\s*>)`)
+)
+
+// CensorRawMessage replaces passwords and AuthInfo values in a raw query with '******'. Field names are matched
+// case-insensitively, empty values are kept.
 func CensorRawMessage(msg string) string {
 	if IsXML(msg) {
-		//TODO censor xml
-		return msg
-
+		return censorXMLPattern.ReplaceAllString(msg, "${1}******${3}")
 	}
-
-	pattern := regexp.MustCompile("([\r\n]|^)(password:[ \t]+)([^\r\n]*)([\r\n]|$)")
-	return pattern.ReplaceAllStringFunc(msg, func(matchStr string) string {
-		m := pattern.FindStringSubmatch(matchStr)
-		return m[1] + m[2] + "******" + m[4]
-	})
+	return censorKVPattern.ReplaceAllString(msg, "${1}******")
 }
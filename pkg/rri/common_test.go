@@ -90,4 +90,38 @@ func TestCensorRawMessage(t *testing.T) {
 	assert.Equal(t, "version: 5.0\naction: LOGIN\npassword: ******\nuser: DENIC-1000011-RRI", CensorRawMessage("version: 5.0\naction: LOGIN\npassword: secret-password\nuser: DENIC-1000011-RRI"))
 	assert.Equal(t, "version: 5.0\naction: LOGIN\nuser: DENIC-1000011-RRI\npassword: ******", CensorRawMessage("version: 5.0\naction: LOGIN\nuser: DENIC-1000011-RRI\npassword: secret-password"))
 	assert.Equal(t, "password: ******\nversion: 5.0\npassword: ******\naction: LOGIN\nuser: DENIC-1000011-RRI\npassword: ******", CensorRawMessage("password: secret-password\nversion: 5.0\npassword: secret-password\naction: LOGIN\nuser: DENIC-1000011-RRI\npassword: secret-password"))
+	assert.Equal(t, "Password: ******\r\nPASSWORD: ******\r\nversion: 5.0", CensorRawMessage("Password: secret-password\r\nPASSWORD: secret-password\r\nversion: 5.0"))
+}
+
+func TestIsXML(t *testing.T) {
+	assert.False(t, IsXML("version: 5.0\naction: info\ndomain: denic.de"))
+	assert.False(t, IsXML(""))
+	assert.True(t, IsXML("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<registry-request></registry-request>"))
+	assert.True(t, IsXML("  \n<registry-response></registry-response>"))
+}
+
+func TestCensorRawMessageAuthInfo(t *testing.T) {
+	query := NewChangeProviderQuery("denic.de", "a-secret-auth-info", DomainData{})
+	for _, msg := range []string{query.EncodeKV(), mustEncodeQueryXML(t, query)} {
+		censored := CensorRawMessage(msg)
+		assert.NotContains(t, censored, "a-secret-auth-info")
+		assert.Contains(t, censored, "******")
+		assert.Contains(t, censored, "denic.de")
+	}
+	assert.Equal(t, "version: 5.0\naction: CHPROV\nauthinfo: ******\ndomain: denic.de", CensorRawMessage("version: 5.0\naction: CHPROV\nauthinfo: a-secret-auth-info\ndomain: denic.de"))
+	// the expiry and hash of an AuthInfo1 are no secrets
+	assert.Equal(t, "authinfohash: abc\nauthinfoexpire: 20200925", CensorRawMessage("authinfohash: abc\nauthinfoexpire: 20200925"))
+}
+
+func TestCensorRawMessageXML(t *testing.T) {
+	query := mustEncodeQueryXML(t, NewInfoDomainQuery("denic.de"))
+	assert.Equal(t, query, CensorRawMessage(query))
+	assert.Equal(t, "<registry-request xmlns=\"http://registry.denic.de/global/5.0\">\n\t<login>\n\t\t<user>DENIC-1000011-RRI</user>\n\t\t<password>******</password>\n\t</login>\n</registry-request>", CensorRawMessage("<registry-request xmlns=\"http://registry.denic.de/global/5.0\">\n\t<login>\n\t\t<user>DENIC-1000011-RRI</user>\n\t\t<password>secret-password</password>\n\t</login>\n</registry-request>"))
+	assert.Equal(t, "<g:Password>******</g:Password><domain:authInfo>******</domain:authInfo><domain:authInfoHash>abc</domain:authInfoHash>", CensorRawMessage("<g:Password>secret-password</g:Password><domain:authInfo>other</domain:authInfo><domain:authInfoHash>abc</domain:authInfoHash>"))
+}
+
+func TestDetectMessageFormat(t *testing.T) {
+	assert.Equal(t, MessageFormatKV, DetectMessageFormat("version: 5.0\naction: info\ndomain: denic.de"))
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(mustEncodeQueryXML(t, NewInfoDomainQuery("denic.de"))))
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(mustEncodeResponseXML(t, NewResponse(ResultSuccess, nil))))
 }
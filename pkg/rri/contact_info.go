@@ -0,0 +1,87 @@
+package rri
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ResponseFieldNameType denotes the response field name for the contact type.
+	ResponseFieldNameType ResponseFieldName = "Type"
+	// ResponseFieldNameName denotes the response field name for the contact name.
+	ResponseFieldNameName ResponseFieldName = "Name"
+	// ResponseFieldNameOrganisation denotes the response field name for organisation lines.
+	ResponseFieldNameOrganisation ResponseFieldName = "Organisation"
+	// ResponseFieldNameAddress denotes the response field name for address lines.
+	ResponseFieldNameAddress ResponseFieldName = "Address"
+	// ResponseFieldNamePostalCode denotes the response field name for postal code.
+	ResponseFieldNamePostalCode ResponseFieldName = "PostalCode"
+	// ResponseFieldNameCity denotes the response field name for city.
+	ResponseFieldNameCity ResponseFieldName = "City"
+	// ResponseFieldNameCountryCode denotes the response field name for country code.
+	ResponseFieldNameCountryCode ResponseFieldName = "CountryCode"
+	// ResponseFieldNameEMail denotes the response field name for email addresses.
+	ResponseFieldNameEMail ResponseFieldName = "Email"
+	// ResponseFieldNamePhone denotes the response field name for phone.
+	ResponseFieldNamePhone ResponseFieldName = "Phone"
+)
+
+// ContactInfo holds the information returned for an INFO handle query.
+type ContactInfo struct {
+	Handle      DenicHandle
+	ContactData ContactData
+	Changed     time.Time
+}
+
+// ContactInfo returns the contact information of a successful INFO handle response.
+func (r *Response) ContactInfo() (*ContactInfo, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	handle, err := ParseDenicHandle(r.FirstField(ResponseFieldNameHandle))
+	if err != nil {
+		return nil, err
+	}
+	if handle.IsEmpty() {
+		return nil, fmt.Errorf("response does not contain contact information")
+	}
+
+	contactType, err := ParseContactType(r.FirstField(ResponseFieldNameType))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ContactInfo{
+		Handle: handle,
+		ContactData: ContactData{
+			Type:         contactType,
+			Name:         r.FirstField(ResponseFieldNameName),
+			Organisation: strings.Join(r.Field(ResponseFieldNameOrganisation), "\n"),
+			Address:      strings.Join(r.Field(ResponseFieldNameAddress), "\n"),
+			PostalCode:   r.FirstField(ResponseFieldNamePostalCode),
+			City:         r.FirstField(ResponseFieldNameCity),
+			CountryCode:  r.FirstField(ResponseFieldNameCountryCode),
+			EMail:        r.Field(ResponseFieldNameEMail),
+			Phone:        r.FirstField(ResponseFieldNamePhone),
+		},
+	}
+
+	if changed := r.FirstField(ResponseFieldNameChanged); len(changed) > 0 {
+		info.Changed, err = time.Parse(time.RFC3339, changed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid changed timestamp %q", changed)
+		}
+	}
+
+	verificationInformation, err := r.ExtractVerificationInformation()
+	if err != nil {
+		return nil, err
+	}
+	for _, vi := range verificationInformation {
+		info.ContactData.VerificationInformation = append(info.ContactData.VerificationInformation, *vi)
+	}
+
+	return info, nil
+}
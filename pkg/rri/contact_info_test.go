@@ -0,0 +1,84 @@
+package rri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseContactInfo(t *testing.T) {
+	response, err := ParseResponse("RESULT: success\nSTID: 8792891a-c366-11eb-bca6-bbfdc472082a\n\nHandle: DENIC-1000021-TEST-DAGOBERT\nType: PERSON\nName: Dagobert Duck\nOrganisation: Duck Industries\nOrganisation: Finance Department\nAddress: Im Geldspeicher\nAddress: Obergeschoss\nCity: Entenhausen\nPostalCode: 64542\nCountryCode: DE\nEmail: dagobert.duck@duck-industries.de\nEmail: dagobert@enten-netz.de\nPhone: +49.6927235\nChanged: 2020-12-23T07:13:04+01:00\n\n[VerificationInformation]\nVerifiedClaim: name\nVerifiedClaim: address\nVerificationResult: success\nVerificationReference: ref-1\nVerificationTimestamp: 2024-05-01T12:00:00+02:00\nVerificationEvidence: idcard\nVerificationMethod: electronic_document\nTrustFramework: de_denic\n")
+	require.NoError(t, err)
+
+	info, err := response.ContactInfo()
+	require.NoError(t, err)
+	assert.Equal(t, NewDenicHandle(1000021, "TEST-DAGOBERT"), info.Handle)
+	assert.True(t, time.Date(2020, time.December, 23, 6, 13, 4, 0, time.UTC).Equal(info.Changed))
+
+	contactData := info.ContactData
+	assert.Equal(t, ContactTypePerson, contactData.Type)
+	assert.Equal(t, "Dagobert Duck", contactData.Name)
+	assert.Equal(t, "Duck Industries\nFinance Department", contactData.Organisation)
+	assert.Equal(t, "Im Geldspeicher\nObergeschoss", contactData.Address)
+	assert.Equal(t, "64542", contactData.PostalCode)
+	assert.Equal(t, "Entenhausen", contactData.City)
+	assert.Equal(t, "DE", contactData.CountryCode)
+	assert.Equal(t, []string{"dagobert.duck@duck-industries.de", "dagobert@enten-netz.de"}, contactData.EMail)
+	assert.Equal(t, "+49.6927235", contactData.Phone)
+
+	require.Len(t, contactData.VerificationInformation, 1)
+	vi := contactData.VerificationInformation[0]
+	assert.Equal(t, []VerificationClaim{VerificationClaimName, VerificationClaimAddress}, vi.VerifiedClaim)
+	assert.Equal(t, VerificationResultSuccess, vi.VerificationResult)
+	assert.Equal(t, "ref-1", vi.VerificationReference)
+	assert.True(t, time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC).Equal(vi.VerificationTimestamp))
+	assert.Equal(t, VerificationEvidenceIDCard, vi.VerificationEvidence)
+	assert.Equal(t, VerificationMethodEDoc, vi.VerificationMethod)
+	assert.Equal(t, TrustFrameworkDenic, vi.TrustFramework)
+
+	// contact data can be sent again as read
+	query := NewCreateContactQuery(info.Handle, contactData)
+	assert.Equal(t, []string{"Duck Industries", "Finance Department"}, query.Field(QueryFieldNameOrganisation))
+	assert.Equal(t, []string{"Im Geldspeicher", "Obergeschoss"}, query.Field(QueryFieldNameAddress))
+}
+
+func TestResponseContactInfoRequest(t *testing.T) {
+	response, err := ParseResponse("RESULT: success\nSTID: 8792891a-c366-11eb-bca6-bbfdc472082a\n\nHandle: DENIC-1000021-TEST-REQUEST\nType: REQUEST\nEmail: request@duck-industries.de\nChanged: 2020-12-23T07:13:04+01:00\n")
+	require.NoError(t, err)
+
+	info, err := response.ContactInfo()
+	require.NoError(t, err)
+	assert.Equal(t, NewDenicHandle(1000021, "TEST-REQUEST"), info.Handle)
+	assert.Equal(t, ContactTypeRequest, info.ContactData.Type)
+	assert.Equal(t, []string{"request@duck-industries.de"}, info.ContactData.EMail)
+	assert.Empty(t, info.ContactData.Name)
+	assert.Empty(t, info.ContactData.VerificationInformation)
+
+	query := NewCreateContactQuery(info.Handle, info.ContactData)
+	assert.NoError(t, query.Validate())
+}
+
+func TestResponseContactInfoErrors(t *testing.T) {
+	response, err := ParseResponse("RESULT: failure\nERROR: 53000000 Handle not found")
+	require.NoError(t, err)
+	_, err = response.ContactInfo()
+	var businessErr *BusinessError
+	assert.ErrorAs(t, err, &businessErr)
+
+	response, err = ParseResponse("RESULT: success\n\nDomain: denic.de")
+	require.NoError(t, err)
+	_, err = response.ContactInfo()
+	assert.Error(t, err)
+
+	response, err = ParseResponse("RESULT: success\n\nHandle: DENIC-1000021-TEST\nType: ALIEN")
+	require.NoError(t, err)
+	_, err = response.ContactInfo()
+	assert.Error(t, err)
+
+	response, err = ParseResponse("RESULT: success\n\nHandle: DENIC-1000021-TEST\nType: ORG\n\n[VerificationInformation]\nVerificationTimestamp: yesterday")
+	require.NoError(t, err)
+	_, err = response.ContactInfo()
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package rri
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DNSKeyFlagsZSK denotes the flags of a zone signing key.
+	DNSKeyFlagsZSK uint16 = 256
+	// DNSKeyFlagsKSK denotes the flags of a key signing key.
+	DNSKeyFlagsKSK uint16 = 257
+	// DNSKeyProtocol denotes the only valid protocol value of a DNSKEY.
+	DNSKeyProtocol uint8 = 3
+)
+
+// supportedDNSKeyAlgorithms contains the DNSSEC algorithm numbers accepted by the registry.
+var supportedDNSKeyAlgorithms = map[uint8]bool{
+	3:  true, // DSA/SHA1
+	5:  true, // RSA/SHA-1
+	6:  true, // DSA-NSEC3-SHA1
+	7:  true, // RSASHA1-NSEC3-SHA1
+	8:  true, // RSA/SHA-256
+	10: true, // RSA/SHA-512
+	13: true, // ECDSA Curve P-256 with SHA-256
+	14: true, // ECDSA Curve P-384 with SHA-384
+	15: true, // Ed25519
+	16: true, // Ed448
+}
+
+// DNSKey represents a DNSKEY record as used for DNSSEC.
+type DNSKey struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey string
+}
+
+// String returns the DNSKEY in RRI syntax like "257 3 8 AwEAAc...".
+func (key DNSKey) String() string {
+	return fmt.Sprintf("%d %d %d %s", key.Flags, key.Protocol, key.Algorithm, key.PublicKey)
+}
+
+// Validate checks flags, protocol, algorithm and the base64 encoding of the public key.
+func (key DNSKey) Validate() error {
+	if key.Flags != DNSKeyFlagsZSK && key.Flags != DNSKeyFlagsKSK {
+		return fmt.Errorf("dnskey flags must be %d or %d", DNSKeyFlagsZSK, DNSKeyFlagsKSK)
+	}
+	if key.Protocol != DNSKeyProtocol {
+		return fmt.Errorf("dnskey protocol must be %d", DNSKeyProtocol)
+	}
+	if !supportedDNSKeyAlgorithms[key.Algorithm] {
+		return fmt.Errorf("unsupported dnskey algorithm %d", key.Algorithm)
+	}
+	if len(key.PublicKey) == 0 {
+		return fmt.Errorf("dnskey public key is empty")
+	}
+	if _, err := base64.StdEncoding.DecodeString(key.PublicKey); err != nil {
+		return fmt.Errorf("dnskey public key is not base64 encoded")
+	}
+	return nil
+}
+
+// ParseDNSKey parses a DNSKEY in RRI syntax like "257 3 8 AwEAAc...". Whitespace in the public key is removed.
+// Use Validate to also check the values.
+func ParseDNSKey(str string) (DNSKey, error) {
+	parts := strings.Fields(str)
+	if len(parts) < 4 {
+		return DNSKey{}, fmt.Errorf("dnskey must consist of flags, protocol, algorithm and public key")
+	}
+
+	flags, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return DNSKey{}, fmt.Errorf("invalid dnskey flags")
+	}
+	protocol, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return DNSKey{}, fmt.Errorf("invalid dnskey protocol")
+	}
+	algorithm, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return DNSKey{}, fmt.Errorf("invalid dnskey algorithm")
+	}
+
+	return DNSKey{uint16(flags), uint8(protocol), uint8(algorithm), strings.Join(parts[3:], "")}, nil
+}
@@ -0,0 +1,46 @@
+package rri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDNSKey(t *testing.T) {
+	key, err := ParseDNSKey("257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0d xCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==")
+	require.NoError(t, err)
+	assert.Equal(t, DNSKey{257, 3, 13, "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="}, key)
+	assert.Equal(t, "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==", key.String())
+
+	_, err = ParseDNSKey("257 3 13")
+	assert.Error(t, err)
+	_, err = ParseDNSKey("65536 3 13 AwEAAb1Xh6Y=")
+	assert.Error(t, err)
+	_, err = ParseDNSKey("257 x 13 AwEAAb1Xh6Y=")
+	assert.Error(t, err)
+	_, err = ParseDNSKey("257 3 256 AwEAAb1Xh6Y=")
+	assert.Error(t, err)
+}
+
+func TestDNSKeyValidate(t *testing.T) {
+	assert.NoError(t, DNSKey{257, 3, 13, "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="}.Validate())
+	assert.NoError(t, DNSKey{256, 3, 8, "AwEAAb1Xh6Y="}.Validate())
+	assert.Error(t, DNSKey{255, 3, 8, "AwEAAb1Xh6Y="}.Validate())
+	assert.Error(t, DNSKey{257, 4, 8, "AwEAAb1Xh6Y="}.Validate())
+	assert.Error(t, DNSKey{257, 3, 1, "AwEAAb1Xh6Y="}.Validate())
+	assert.Error(t, DNSKey{257, 3, 8, ""}.Validate())
+	assert.Error(t, DNSKey{257, 3, 8, "not base64!"}.Validate())
+}
+
+func TestDomainDataDNSKeys(t *testing.T) {
+	query := NewUpdateDomainQuery("denic.de", DomainData{
+		NameServers: []NameServer{NewNameServer("ns1.denic.de")},
+		DNSKeys:     []DNSKey{{257, 3, 8, "AwEAAb1Xh6Y="}, {256, 3, 8, "AwEAAc2Yi7Z="}},
+	})
+	assert.Equal(t, []string{"257 3 8 AwEAAb1Xh6Y=", "256 3 8 AwEAAc2Yi7Z="}, query.Field(QueryFieldNameDNSKey))
+
+	parsed, err := ParseQuery(query.EncodeKV())
+	require.NoError(t, err)
+	assert.Equal(t, query.Field(QueryFieldNameDNSKey), parsed.Field(QueryFieldNameDNSKey))
+}
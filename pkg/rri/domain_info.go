@@ -0,0 +1,140 @@
+package rri
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ResponseFieldNameDomainIDN denotes the response field name for IDN domain name.
+	ResponseFieldNameDomainIDN ResponseFieldName = "Domain"
+	// ResponseFieldNameDomainACE denotes the response field name for ACE domain name.
+	ResponseFieldNameDomainACE ResponseFieldName = "Domain-Ace"
+	// ResponseFieldNameNameServer denotes the response field name for name servers.
+	ResponseFieldNameNameServer ResponseFieldName = "Nserver"
+	// ResponseFieldNameDNSKey denotes the response field name for DNSKEY records.
+	ResponseFieldNameDNSKey ResponseFieldName = "Dnskey"
+	// ResponseFieldNameStatus denotes the response field name for the domain status.
+	ResponseFieldNameStatus ResponseFieldName = "Status"
+	// ResponseFieldNameRegAccID denotes the response field name for the registrar handle.
+	ResponseFieldNameRegAccID ResponseFieldName = "RegAccId"
+	// ResponseFieldNameRegAccName denotes the response field name for the registrar name.
+	ResponseFieldNameRegAccName ResponseFieldName = "RegAccName"
+	// ResponseFieldNameChanged denotes the response field name for the last change timestamp.
+	ResponseFieldNameChanged ResponseFieldName = "Changed"
+	// ResponseFieldNameHandle denotes the response field name for denic handles.
+	ResponseFieldNameHandle ResponseFieldName = "Handle"
+
+	// ResponseEntityNameGeneralRequest denotes the entity name of a general request contact.
+	ResponseEntityNameGeneralRequest ResponseEntityName = "generalrequest"
+	// ResponseEntityNameAbuseContact denotes the entity name of an abuse contact.
+	ResponseEntityNameAbuseContact ResponseEntityName = "abusecontact"
+
+	// DomainStatusConnect denotes a registered domain that is delegated to its name servers.
+	DomainStatusConnect DomainStatus = "connect"
+	// DomainStatusFailed denotes a registered domain that is not delegated due to failed name server checks.
+	DomainStatusFailed DomainStatus = "failed"
+	// DomainStatusFree denotes a domain that is not registered.
+	DomainStatusFree DomainStatus = "free"
+)
+
+// DomainStatus represents the status of a domain.
+type DomainStatus string
+
+// Normalize returns the normalized representation of the given DomainStatus.
+func (s DomainStatus) Normalize() DomainStatus {
+	return DomainStatus(strings.ToLower(string(s)))
+}
+
+// DomainInfo holds the information returned for an INFO domain query.
+type DomainInfo struct {
+	Domain                string
+	DomainACE             string
+	Status                DomainStatus
+	HolderHandles         []DenicHandle
+	GeneralRequestHandles []DenicHandle
+	AbuseContactHandles   []DenicHandle
+	NameServers           []NameServer
+	DNSKeys               []DNSKey
+	RegAccID              string
+	RegAccName            string
+	Changed               time.Time
+}
+
+// DomainData returns the domain data as used for NewUpdateDomainQuery.
+func (info *DomainInfo) DomainData() DomainData {
+	return DomainData{
+		HolderHandles:         append([]DenicHandle{}, info.HolderHandles...),
+		GeneralRequestHandles: append([]DenicHandle{}, info.GeneralRequestHandles...),
+		AbuseContactHandles:   append([]DenicHandle{}, info.AbuseContactHandles...),
+		NameServers:           append([]NameServer{}, info.NameServers...),
+		DNSKeys:               append([]DNSKey{}, info.DNSKeys...),
+	}
+}
+
+// DomainInfo returns the domain information of a successful INFO domain response.
+func (r *Response) DomainInfo() (*DomainInfo, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if len(r.FirstField(ResponseFieldNameDomainIDN)) == 0 && len(r.FirstField(ResponseFieldNameDomainACE)) == 0 {
+		return nil, fmt.Errorf("response does not contain domain information")
+	}
+
+	info := &DomainInfo{
+		Domain:     r.FirstField(ResponseFieldNameDomainIDN),
+		DomainACE:  r.FirstField(ResponseFieldNameDomainACE),
+		Status:     DomainStatus(r.FirstField(ResponseFieldNameStatus)).Normalize(),
+		RegAccID:   r.FirstField(ResponseFieldNameRegAccID),
+		RegAccName: r.FirstField(ResponseFieldNameRegAccName),
+	}
+
+	for _, str := range r.Field(ResponseFieldNameNameServer) {
+		ns, err := ParseNameServer(str)
+		if err != nil {
+			return nil, err
+		}
+		info.NameServers = append(info.NameServers, ns)
+	}
+
+	for _, str := range r.Field(ResponseFieldNameDNSKey) {
+		key, err := ParseDNSKey(str)
+		if err != nil {
+			return nil, err
+		}
+		info.DNSKeys = append(info.DNSKeys, key)
+	}
+
+	if changed := r.FirstField(ResponseFieldNameChanged); len(changed) > 0 {
+		var err error
+		info.Changed, err = time.Parse(time.RFC3339, changed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid changed timestamp %q", changed)
+		}
+	}
+
+	for _, entity := range r.Entities() {
+		var handles *[]DenicHandle
+		switch entity.Name().Normalize() {
+		case ResponseEntityNameHolder:
+			handles = &info.HolderHandles
+		case ResponseEntityNameGeneralRequest:
+			handles = &info.GeneralRequestHandles
+		case ResponseEntityNameAbuseContact:
+			handles = &info.AbuseContactHandles
+		default:
+			continue
+		}
+
+		handle, err := ParseDenicHandle(entity.FirstField(ResponseFieldNameHandle))
+		if err != nil {
+			return nil, fmt.Errorf("%s entity: %s", entity.Name(), err.Error())
+		}
+		if !handle.IsEmpty() {
+			*handles = append(*handles, handle)
+		}
+	}
+
+	return info, nil
+}
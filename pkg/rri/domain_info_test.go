@@ -0,0 +1,72 @@
+package rri
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseDomainInfo(t *testing.T) {
+	response, err := ParseResponse("RESULT: success\nSTID: 10459b07-861a-11ea-b33a-d9ddb946cb7c\n\nDomain: dönic.de\nDomain-Ace: xn--dnic-5qa.de\nNserver: ns1.dönic.de. 81.91.170.1 2001:608:6::5\nNserver: ns2.denic.de.\nDnskey: 257 3 8 AwEAAb1 Xh6Y=\nStatus: connect\nRegAccId: DENIC-1000006\nRegAccName: DENIC eG\nChanged: 2020-04-23T09:58:11+02:00\n\n[Holder]\nHandle: DENIC-1000006-DENIC\nType: ORG\nName: DENIC eG\n\n[Holder]\nHandle: DENIC-1000006-OTHER\n\n[GeneralRequest]\nHandle: DENIC-1000006-REQUEST\n\n[AbuseContact]\nHandle: DENIC-1000006-ABUSE\n")
+	require.NoError(t, err)
+
+	info, err := response.DomainInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "dönic.de", info.Domain)
+	assert.Equal(t, "xn--dnic-5qa.de", info.DomainACE)
+	assert.Equal(t, DomainStatusConnect, info.Status)
+	assert.Equal(t, []DenicHandle{NewDenicHandle(1000006, "DENIC"), NewDenicHandle(1000006, "OTHER")}, info.HolderHandles)
+	assert.Equal(t, []DenicHandle{NewDenicHandle(1000006, "REQUEST")}, info.GeneralRequestHandles)
+	assert.Equal(t, []DenicHandle{NewDenicHandle(1000006, "ABUSE")}, info.AbuseContactHandles)
+	assert.Equal(t, []NameServer{
+		{"ns1.dönic.de.", []netip.Addr{netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("2001:608:6::5")}},
+		{"ns2.denic.de.", nil},
+	}, info.NameServers)
+	assert.Equal(t, []DNSKey{{257, 3, 8, "AwEAAb1Xh6Y="}}, info.DNSKeys)
+	assert.Equal(t, "DENIC-1000006", info.RegAccID)
+	assert.Equal(t, "DENIC eG", info.RegAccName)
+	assert.True(t, time.Date(2020, time.April, 23, 7, 58, 11, 0, time.UTC).Equal(info.Changed))
+
+	domainData := info.DomainData()
+	assert.Equal(t, info.HolderHandles, domainData.HolderHandles)
+	assert.Equal(t, info.GeneralRequestHandles, domainData.GeneralRequestHandles)
+	assert.Equal(t, info.AbuseContactHandles, domainData.AbuseContactHandles)
+	assert.Equal(t, info.NameServers, domainData.NameServers)
+	assert.Equal(t, info.DNSKeys, domainData.DNSKeys)
+
+	query := NewUpdateDomainQuery(info.Domain, domainData)
+	assert.Equal(t, []string{"DENIC-1000006-DENIC", "DENIC-1000006-OTHER"}, query.Field(QueryFieldNameHolder))
+	assert.Equal(t, []string{"ns1.xn--dnic-5qa.de. 81.91.170.1 2001:608:6::5", "ns2.denic.de."}, query.Field(QueryFieldNameNameServer))
+	assert.Equal(t, []string{"257 3 8 AwEAAb1Xh6Y="}, query.Field(QueryFieldNameDNSKey))
+}
+
+func TestResponseDomainInfoErrors(t *testing.T) {
+	response, err := ParseResponse("RESULT: failure\nERROR: 53000000 Domain not found")
+	require.NoError(t, err)
+	_, err = response.DomainInfo()
+	var businessErr *BusinessError
+	assert.ErrorAs(t, err, &businessErr)
+
+	response, err = ParseResponse("RESULT: success\n\nHandle: DENIC-1000006-DENIC")
+	require.NoError(t, err)
+	_, err = response.DomainInfo()
+	assert.Error(t, err)
+
+	response, err = ParseResponse("RESULT: success\n\nDomain: denic.de\nDnskey: 257 3 8")
+	require.NoError(t, err)
+	_, err = response.DomainInfo()
+	assert.Error(t, err)
+
+	response, err = ParseResponse("RESULT: success\n\nDomain: denic.de\nNserver: ns1.denic.de. 1.2.3")
+	require.NoError(t, err)
+	_, err = response.DomainInfo()
+	assert.Error(t, err)
+
+	response, err = ParseResponse("RESULT: success\n\nDomain: denic.de\nChanged: yesterday")
+	require.NoError(t, err)
+	_, err = response.DomainInfo()
+	assert.Error(t, err)
+}
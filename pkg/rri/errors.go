@@ -0,0 +1,146 @@
+package rri
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotLoggedIn is returned when a query other than LOGIN is sent without being logged in.
+	ErrNotLoggedIn = fmt.Errorf("not logged in")
+	// ErrAlreadyLoggedIn is returned when LOGIN is sent while already being logged in.
+	ErrAlreadyLoggedIn = fmt.Errorf("already logged in")
+	// ErrClientClosed is returned for queries sent using a closed client and for queries aborted by Client.Close.
+	ErrClientClosed = fmt.Errorf("client is closed")
+	// ErrMessageTooLarge is returned when a message exceeds the maximum message size.
+	ErrMessageTooLarge = fmt.Errorf("message too large")
+	// ErrPoolClosed is returned when sending queries using a closed pool.
+	ErrPoolClosed = fmt.Errorf("pool is closed")
+	// ErrQueryAborted is returned when a QueryProcessor aborts sending a query.
+	ErrQueryAborted = fmt.Errorf("query aborted by processor")
+	// ErrNoQueryHandler is returned by ServeMux for queries without a matching handler if no fallback is set.
+	ErrNoQueryHandler = fmt.Errorf("no query handler registered")
+	// ErrTranscriptMismatch is returned by TranscriptReplayer for queries that differ from the recorded transcript.
+	ErrTranscriptMismatch = fmt.Errorf("query does not match transcript")
+	// ErrXMLUnsupported is returned when a query or response cannot be represented in the XML schema of the registry.
+	ErrXMLUnsupported = fmt.Errorf("cannot be encoded in XML")
+)
+
+// ProtocolError denotes a message that violates the RRI protocol, like a malformed response or invalid framing.
+type ProtocolError struct {
+	// Msg describes the violation.
+	Msg string
+	// Err denotes the underlying error and may be nil.
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Msg, e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// ReconnectError is returned when a lost connection or session could not be restored.
+type ReconnectError struct {
+	// Login denotes whether the connection has been restored, but the session could not be restored.
+	Login bool
+	// Err denotes the underlying error.
+	Err error
+}
+
+func (e *ReconnectError) Error() string {
+	if e.Login {
+		return fmt.Sprintf("failed to restore session: %s", e.Err.Error())
+	}
+	return fmt.Sprintf("failed to restore lost connection: %s", e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *ReconnectError) Unwrap() error {
+	return e.Err
+}
+
+// BusinessError wraps a response with a result other than success.
+type BusinessError struct {
+	Response *Response
+}
+
+// NewBusinessError returns a new BusinessError for the given response.
+func NewBusinessError(response *Response) *BusinessError {
+	return &BusinessError{response}
+}
+
+// Result returns the result of the wrapped response.
+func (e *BusinessError) Result() Result {
+	return e.Response.Result()
+}
+
+// ErrorMessages returns all error messages of the wrapped response.
+func (e *BusinessError) ErrorMessages() []BusinessMessage {
+	return e.Response.ErrorMessages()
+}
+
+func (e *BusinessError) Error() string {
+	messages := e.ErrorMessages()
+	if len(messages) == 0 {
+		return fmt.Sprintf("RRI returned result '%s'", e.Result())
+	}
+	strs := make([]string, len(messages))
+	for i, msg := range messages {
+		strs[i] = msg.String()
+	}
+	return fmt.Sprintf("RRI returned result '%s': %s", e.Result(), strings.Join(strs, "; "))
+}
+
+// IsCertificateError returns whether the error has been caused by an untrusted or invalid server certificate.
+func IsCertificateError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &certificateInvalidErr) || errors.As(err, &hostnameErr)
+}
+
+// QueryViolation describes a single problem found by Query.Validate.
+type QueryViolation struct {
+	// Entity denotes the entity section of the field or is empty for the main section.
+	Entity QueryFieldEntity
+	// Field denotes the affected field or is empty if the violation concerns the whole query.
+	Field QueryFieldName
+	// Msg describes the violation.
+	Msg string
+}
+
+func (v QueryViolation) String() string {
+	var sb strings.Builder
+	if len(v.Entity) > 0 {
+		sb.WriteString(v.Entity.String())
+		sb.WriteString(" ")
+	}
+	if len(v.Field) > 0 {
+		sb.WriteString(string(v.Field))
+		sb.WriteString(": ")
+	}
+	sb.WriteString(v.Msg)
+	return sb.String()
+}
+
+// ValidationError is returned for queries that violate the RRI specification and holds all violations found.
+type ValidationError struct {
+	Violations []QueryViolation
+}
+
+func (e *ValidationError) Error() string {
+	strs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		strs[i] = v.String()
+	}
+	return fmt.Sprintf("invalid query: %s", strings.Join(strs, "; "))
+}
@@ -0,0 +1,80 @@
+package rri
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTypedErrors(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, ErrNotLoggedIn)
+
+		err = client.Login("DENIC-1000011-TEST", "wrong")
+		var businessErr *BusinessError
+		require.ErrorAs(t, err, &businessErr)
+		assert.Equal(t, ResultFailure, businessErr.Result())
+
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+		err = client.Login("DENIC-1000011-TEST", "secret")
+		assert.ErrorIs(t, err, ErrAlreadyLoggedIn)
+
+		_, err = client.SendRaw(strings.Repeat("a", DefaultMaxMessageSize+1))
+		assert.ErrorIs(t, err, ErrMessageTooLarge)
+	})
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	_, err := readMessage(bytes.NewReader([]byte{0, 0, 0, 0}))
+	var protocolErr *ProtocolError
+	assert.ErrorAs(t, err, &protocolErr)
+
+	_, err = readMessage(bytes.NewReader([]byte{0, 1, 0, 1}))
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestReconnectError(t *testing.T) {
+	inner := fmt.Errorf("connection refused")
+	err := fmt.Errorf("query failed: %w", &ReconnectError{false, inner})
+	var reconnectErr *ReconnectError
+	require.ErrorAs(t, err, &reconnectErr)
+	assert.False(t, reconnectErr.Login)
+	assert.ErrorIs(t, err, inner)
+	assert.Equal(t, "failed to restore lost connection: connection refused", reconnectErr.Error())
+	assert.Equal(t, "failed to restore session: connection refused", (&ReconnectError{true, inner}).Error())
+}
+
+func TestBusinessError(t *testing.T) {
+	response, err := ParseResponseKV("RESULT: failure\nERROR: 53000000 Some error\nERROR: 53000001 Another error")
+	require.NoError(t, err)
+
+	err = response.Err()
+	var businessErr *BusinessError
+	require.ErrorAs(t, err, &businessErr)
+	assert.Same(t, response, businessErr.Response)
+	assert.Equal(t, []BusinessMessage{NewBusinessMessage(53000000, "Some error"), NewBusinessMessage(53000001, "Another error")}, businessErr.ErrorMessages())
+	assert.Equal(t, "RRI returned result 'failure': 53000000 Some error; 53000001 Another error", err.Error())
+
+	response, err = ParseResponseKV("RESULT: success")
+	require.NoError(t, err)
+	assert.NoError(t, response.Err())
+}
+
+func TestIsCertificateError(t *testing.T) {
+	assert.True(t, IsCertificateError(x509.UnknownAuthorityError{}))
+	assert.True(t, IsCertificateError(fmt.Errorf("dial: %w", x509.HostnameError{Host: "localhost"})))
+	assert.False(t, IsCertificateError(errors.New("x509: but not really")))
+}
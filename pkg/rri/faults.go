@@ -0,0 +1,202 @@
+package rri
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// FaultCloseBeforeProcessing closes the connection after receiving a query without passing it to the handler.
+	FaultCloseBeforeProcessing FaultType = iota + 1
+	// FaultCloseAfterProcessing closes the connection after the handler has processed a query without sending the response.
+	FaultCloseAfterProcessing
+	// FaultDelay delays the response by Fault.Delay.
+	FaultDelay
+	// FaultTruncatedFrame sends only half of the response and closes the connection.
+	FaultTruncatedFrame
+	// FaultOversizedLength sends a length prefix exceeding the maximum message size and closes the connection.
+	FaultOversizedLength
+	// FaultGarbage sends a message with lines that are neither key-value pairs nor XML instead of the response.
+	FaultGarbage
+	// FaultEmptyMessage sends a zero-length message instead of the response.
+	FaultEmptyMessage
+	// FaultHandshake sends non-TLS data to let the TLS handshake of a new connection fail. Fault.Action is ignored
+	// and Fault.Nth counts connections instead of queries.
+	FaultHandshake
+)
+
+// FaultType denotes the kind of failure injected by a FaultInjector.
+type FaultType int
+
+func (t FaultType) String() string {
+	switch t {
+	case FaultCloseBeforeProcessing:
+		return "close-before-processing"
+	case FaultCloseAfterProcessing:
+		return "close-after-processing"
+	case FaultDelay:
+		return "delay"
+	case FaultTruncatedFrame:
+		return "truncated-frame"
+	case FaultOversizedLength:
+		return "oversized-length"
+	case FaultGarbage:
+		return "garbage"
+	case FaultEmptyMessage:
+		return "empty-message"
+	case FaultHandshake:
+		return "handshake"
+	default:
+		return "none"
+	}
+}
+
+// Fault describes a failure and the queries it is injected for. All conditions must be met.
+type Fault struct {
+	Type FaultType
+	// Action restricts the fault to queries with the given action. Matches all actions if empty.
+	Action QueryAction
+	// Nth restricts the fault to the n-th matching query, counting from 1. Matches every query if 0.
+	Nth int
+	// Probability denotes the chance between 0 and 1 to inject the fault for a matching query. The fault is always
+	// injected if 0.
+	Probability float64
+	// Delay denotes the delay for FaultDelay.
+	Delay time.Duration
+}
+
+type faultState struct {
+	fault   Fault
+	matches int
+}
+
+// FaultInjector injects failures into the connections of a Server to test error handling of clients. The first
+// matching fault is injected. A FaultInjector is safe for concurrent use.
+//
+// DO NOT USE IN PRODUCTION!
+type FaultInjector struct {
+	mutex    sync.Mutex
+	faults   []*faultState
+	random   *rand.Rand
+	injected int
+}
+
+// NewFaultInjector returns a new FaultInjector with the given faults.
+func NewFaultInjector(faults ...Fault) *FaultInjector {
+	injector := &FaultInjector{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	injector.Add(faults...)
+	return injector
+}
+
+// Add appends faults to inject.
+func (f *FaultInjector) Add(faults ...Fault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, fault := range faults {
+		f.faults = append(f.faults, &faultState{fault: fault})
+	}
+}
+
+// Reset removes all faults and resets the counters.
+func (f *FaultInjector) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = nil
+	f.injected = 0
+}
+
+// Seed initializes the random source used for Fault.Probability to get reproducible results.
+func (f *FaultInjector) Seed(seed int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.random = rand.New(rand.NewSource(seed))
+}
+
+// Injected returns the number of faults injected so far.
+func (f *FaultInjector) Injected() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.injected
+}
+
+// nextQueryFault returns the fault to inject for the query or nil.
+func (f *FaultInjector) nextQueryFault(query *Query) *Fault {
+	return f.next(func(fault Fault) bool {
+		return fault.Type != FaultHandshake && (len(fault.Action) == 0 || fault.Action.Normalize() == query.Action())
+	})
+}
+
+// nextConnectionFault returns the handshake fault to inject for a new connection or nil.
+func (f *FaultInjector) nextConnectionFault() *Fault {
+	return f.next(func(fault Fault) bool {
+		return fault.Type == FaultHandshake
+	})
+}
+
+func (f *FaultInjector) next(matches func(Fault) bool) *Fault {
+	if f == nil {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var result *Fault
+	for _, state := range f.faults {
+		if !matches(state.fault) {
+			continue
+		}
+		// count all matching queries, even if another fault is injected
+		state.matches++
+		if result != nil || (state.fault.Nth > 0 && state.matches != state.fault.Nth) {
+			continue
+		}
+		if state.fault.Probability > 0 && f.random.Float64() >= state.fault.Probability {
+			continue
+		}
+		fault := state.fault
+		result = &fault
+	}
+	if result != nil {
+		f.injected++
+	}
+	return result
+}
+
+// failHandshake sends data that is not a TLS record on the underlying connection.
+func failHandshake(conn net.Conn) {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		tlsConn.NetConn().Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	}
+}
+
+// writeFaultyResponse writes the response as denoted by the fault and returns whether the connection must be closed.
+func writeFaultyResponse(conn net.Conn, fault *Fault, responseMsg []byte) (bool, error) {
+	switch fault.Type {
+	case FaultTruncatedFrame:
+		_, err := conn.Write(responseMsg[:4+(len(responseMsg)-4)/2])
+		return true, err
+
+	case FaultOversizedLength:
+		header := make([]byte, 4)
+		// announce a length beyond any configurable limit
+		binary.BigEndian.PutUint32(header, math.MaxUint32)
+		_, err := conn.Write(append(header, responseMsg[4:]...))
+		return true, err
+
+	case FaultGarbage:
+		_, err := conn.Write(prepareMessage("RESULT success\n%%garbage%%\n\x00\x01\x02"))
+		return false, err
+
+	case FaultEmptyMessage:
+		_, err := conn.Write(make([]byte, 4))
+		return false, err
+
+	default:
+		_, err := conn.Write(responseMsg)
+		return false, err
+	}
+}
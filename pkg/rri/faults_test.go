@@ -0,0 +1,155 @@
+package rri
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultInjectorSelection(t *testing.T) {
+	info := NewInfoDomainQuery("denic.de")
+	check := NewCheckDomainQuery("denic.de")
+
+	injector := NewFaultInjector(Fault{Type: FaultGarbage, Action: ActionCheck, Nth: 2})
+	assert.Nil(t, injector.nextQueryFault(check))
+	assert.Nil(t, injector.nextQueryFault(info))
+	fault := injector.nextQueryFault(check)
+	require.NotNil(t, fault)
+	assert.Equal(t, FaultGarbage, fault.Type)
+	assert.Nil(t, injector.nextQueryFault(check))
+	assert.Nil(t, injector.nextConnectionFault())
+	assert.Equal(t, 1, injector.Injected())
+
+	injector.Reset()
+	injector.Add(Fault{Type: FaultEmptyMessage, Action: "info"}, Fault{Type: FaultGarbage})
+	assert.Equal(t, FaultEmptyMessage, injector.nextQueryFault(info).Type)
+	assert.Equal(t, FaultGarbage, injector.nextQueryFault(check).Type)
+
+	injector.Reset()
+	injector.Seed(42)
+	injector.Add(Fault{Type: FaultGarbage, Probability: 0.25})
+	count := 0
+	for i := 0; i < 1000; i++ {
+		if injector.nextQueryFault(info) != nil {
+			count++
+		}
+	}
+	assert.InDelta(t, 250, count, 50)
+
+	var nilInjector *FaultInjector
+	assert.Nil(t, nilInjector.nextQueryFault(info))
+}
+
+func TestMockServerFaults(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		var queryCount int32
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			atomic.AddInt32(&queryCount, 1)
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		noRetry := NoRetryPolicy()
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		var protocolErr *ProtocolError
+		server.Faults().Add(Fault{Type: FaultGarbage, Action: ActionInfo, Nth: 1})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.ErrorAs(t, err, &protocolErr)
+
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultEmptyMessage, Action: ActionInfo, Nth: 1})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.ErrorAs(t, err, &protocolErr)
+
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultOversizedLength, Action: ActionInfo, Nth: 1})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultTruncatedFrame, Action: ActionInfo, Nth: 1})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.Error(t, err)
+
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultDelay, Action: ActionInfo, Delay: 500 * time.Millisecond, Nth: 1})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = client.SendQueryContext(ctx, NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the session is restored after each error
+		server.Faults().Reset()
+		atomic.StoreInt32(&queryCount, 0)
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&queryCount))
+	})
+}
+
+func TestMockServerFaultsRetry(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		var queryCount int32
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			atomic.AddInt32(&queryCount, 1)
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true, RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		// idempotent queries are retried after the connection has been closed
+		server.Faults().Add(Fault{Type: FaultCloseBeforeProcessing, Action: ActionInfo, Nth: 1})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&queryCount))
+
+		// the query might have been processed, so it must not be retried
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultCloseAfterProcessing, Action: ActionDelete, Nth: 1})
+		_, err = client.SendQuery(NewDeleteDomainQuery("denic.de"))
+		require.Error(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&queryCount))
+
+		// the session cannot be restored while LOGIN fails
+		server.Faults().Reset()
+		server.Faults().Add(Fault{Type: FaultCloseBeforeProcessing, Action: ActionInfo, Nth: 1}, Fault{Type: FaultCloseBeforeProcessing, Action: ActionLogin})
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		var reconnectErr *ReconnectError
+		require.ErrorAs(t, err, &reconnectErr)
+		assert.True(t, reconnectErr.Login)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&queryCount))
+
+		// the session is restored once LOGIN succeeds again
+		server.Faults().Reset()
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&queryCount))
+	})
+}
+
+func TestMockServerHandshakeFault(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.Faults().Add(Fault{Type: FaultHandshake, Nth: 1})
+		_, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrMessageTooLarge))
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		assert.Equal(t, 1, server.Faults().Injected())
+	})
+}
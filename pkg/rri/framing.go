@@ -0,0 +1,117 @@
+package rri
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultMaxMessageSize denotes the default maximum size of a message in bytes, not including the length prefix.
+const DefaultMaxMessageSize = 65536
+
+// frameBufferPool holds buffers to read and write frames without allocating a new buffer for every message.
+var frameBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	},
+}
+
+// getFrameBuffer returns a pooled buffer of the given size.
+func getFrameBuffer(size int) *[]byte {
+	buffer := frameBufferPool.Get().(*[]byte)
+	if cap(*buffer) < size {
+		*buffer = make([]byte, size)
+	}
+	*buffer = (*buffer)[:size]
+	return buffer
+}
+
+// putFrameBuffer returns a buffer to the pool.
+func putFrameBuffer(buffer *[]byte) {
+	// do not retain the memory of exceptionally large messages
+	if cap(*buffer) > 4+DefaultMaxMessageSize {
+		return
+	}
+	frameBufferPool.Put(buffer)
+}
+
+// FrameReader reads length-prefixed RRI messages from an underlying reader.
+//
+// A FrameReader is not safe for concurrent use.
+type FrameReader struct {
+	r              io.Reader
+	maxMessageSize int
+	header         [4]byte
+}
+
+// NewFrameReader returns a FrameReader that rejects messages larger than maxMessageSize bytes. Uses
+// DefaultMaxMessageSize if maxMessageSize is not positive.
+func NewFrameReader(r io.Reader, maxMessageSize int) *FrameReader {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &FrameReader{r: r, maxMessageSize: maxMessageSize}
+}
+
+// ReadFrame reads the next message. Returns ErrMessageTooLarge if the announced length exceeds the limit and a
+// *ProtocolError for empty messages. The underlying reader is in an undefined state after errors.
+func (fr *FrameReader) ReadFrame() (string, error) {
+	if err := readFull(fr.r, fr.header[:]); err != nil {
+		return "", err
+	}
+	length := binary.BigEndian.Uint32(fr.header[:])
+	if length == 0 {
+		return "", &ProtocolError{"message is empty", nil}
+	}
+	if uint64(length) > uint64(fr.maxMessageSize) {
+		return "", ErrMessageTooLarge
+	}
+
+	buffer := getFrameBuffer(int(length))
+	defer putFrameBuffer(buffer)
+	if err := readFull(fr.r, *buffer); err != nil {
+		return "", err
+	}
+	return string(*buffer), nil
+}
+
+// FrameWriter writes length-prefixed RRI messages to an underlying writer.
+//
+// A FrameWriter is not safe for concurrent use.
+type FrameWriter struct {
+	w              io.Writer
+	maxMessageSize int
+}
+
+// NewFrameWriter returns a FrameWriter that rejects messages larger than maxMessageSize bytes. Uses
+// DefaultMaxMessageSize if maxMessageSize is not positive.
+func NewFrameWriter(w io.Writer, maxMessageSize int) *FrameWriter {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &FrameWriter{w: w, maxMessageSize: maxMessageSize}
+}
+
+// WriteFrame writes the message with its length prefix in a single write. Returns ErrMessageTooLarge without writing
+// anything if the message exceeds the limit.
+func (fw *FrameWriter) WriteFrame(msg string) error {
+	if len(msg) > fw.maxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	buffer := getFrameBuffer(4 + len(msg))
+	defer putFrameBuffer(buffer)
+	binary.BigEndian.PutUint32((*buffer)[0:4], uint32(len(msg)))
+	copy((*buffer)[4:], msg)
+
+	n, err := fw.w.Write(*buffer)
+	if err != nil {
+		return err
+	}
+	if n != len(*buffer) {
+		return fmt.Errorf("failed to send %d bytes", len(*buffer))
+	}
+	return nil
+}
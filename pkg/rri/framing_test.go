@@ -0,0 +1,155 @@
+package rri
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameReader(t *testing.T) {
+	var data []byte
+	data = append(data, prepareMessage("version: 5.0\naction: LOGIN")...)
+	data = append(data, prepareMessage(strings.Repeat("a", 10000))...)
+	data = append(data, prepareMessage("version: 5.0\naction: LOGOUT")...)
+
+	reader := NewFrameReader(bytes.NewReader(data), 0)
+	msg, err := reader.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, "version: 5.0\naction: LOGIN", msg)
+	msg, err = reader.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 10000), msg)
+	msg, err = reader.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, "version: 5.0\naction: LOGOUT", msg)
+	_, err = reader.ReadFrame()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestFrameReaderMaxMessageSize(t *testing.T) {
+	_, err := NewFrameReader(bytes.NewReader(prepareMessage("0123456789")), 9).ReadFrame()
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+	msg, err := NewFrameReader(bytes.NewReader(prepareMessage("0123456789")), 10).ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", msg)
+
+	large := strings.Repeat("a", DefaultMaxMessageSize+1)
+	_, err = NewFrameReader(bytes.NewReader(prepareMessage(large)), 0).ReadFrame()
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+	msg, err = NewFrameReader(bytes.NewReader(prepareMessage(large)), 2*DefaultMaxMessageSize).ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, large, msg)
+}
+
+func TestFrameWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewFrameWriter(&buffer, 10)
+	require.NoError(t, writer.WriteFrame("version: 5"))
+	assert.Equal(t, prepareMessage("version: 5"), buffer.Bytes())
+
+	buffer.Reset()
+	assert.ErrorIs(t, writer.WriteFrame("version: 5.0"), ErrMessageTooLarge)
+	assert.Zero(t, buffer.Len())
+}
+
+func TestClientServerMaxMessageSize(t *testing.T) {
+	largeValue := strings.Repeat("a", DefaultMaxMessageSize)
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		if q.Action() == ActionInfo {
+			return NewResponse(ResultSuccess, nil).WithField(ResponseFieldNameRegAccName, largeValue), nil
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	server.MaxMessageSize = 2 * DefaultMaxMessageSize
+	runError := runTestServer(server)
+	defer func() {
+		server.Close()
+		require.NoError(t, <-runError)
+	}()
+
+	noRetry := NoRetryPolicy()
+	client, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry, MaxMessageSize: 2 * DefaultMaxMessageSize})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Login("user", "secret"))
+
+	// the query contains the domain twice and exceeds the default limit as well
+	response, err := client.SendQuery(NewInfoDomainQuery(strings.Repeat("a", DefaultMaxMessageSize/2) + ".de"))
+	require.NoError(t, err)
+	assert.Equal(t, largeValue, response.FirstField(ResponseFieldNameRegAccName))
+
+	// clients with the default limit reject the large response
+	defaultClient, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer defaultClient.Close()
+	require.NoError(t, defaultClient.Login("user", "secret"))
+	_, err = defaultClient.SendQuery(NewInfoDomainQuery("denic.de"))
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func FuzzFrameReader(f *testing.F) {
+	f.Add(prepareMessage("version: 5.0\naction: LOGIN\nuser: user\npassword: secret"))
+	f.Add(append(prepareMessage("RESULT: success"), prepareMessage("RESULT: failed")...))
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{0, 0, 4, 1})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x00})
+	f.Add([]byte{0, 0, 0, 10, 'a'})
+
+	const maxMessageSize = 1024
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := NewFrameReader(bytes.NewReader(data), maxMessageSize)
+		offset := 0
+		for {
+			msg, err := reader.ReadFrame()
+			if err != nil {
+				if len(data)-offset >= 4 {
+					length := binary.BigEndian.Uint32(data[offset:])
+					if length > maxMessageSize {
+						assert.ErrorIs(t, err, ErrMessageTooLarge)
+					}
+				}
+				return
+			}
+
+			// every successfully read message must match the input exactly
+			require.NotEmpty(t, msg)
+			require.LessOrEqual(t, len(msg), maxMessageSize)
+			require.Equal(t, prepareMessage(msg), data[offset:offset+4+len(msg)])
+			offset += 4 + len(msg)
+		}
+	})
+}
+
+func FuzzFrameRoundTrip(f *testing.F) {
+	f.Add("version: 5.0\naction: LOGIN\nuser: user\npassword: secret")
+	f.Add("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<registry-request></registry-request>")
+	f.Add("")
+	f.Add("\x00\x00\x00\x00")
+
+	const maxMessageSize = 1024
+	f.Fuzz(func(t *testing.T, msg string) {
+		var buffer bytes.Buffer
+		err := NewFrameWriter(&buffer, maxMessageSize).WriteFrame(msg)
+		if len(msg) > maxMessageSize {
+			require.ErrorIs(t, err, ErrMessageTooLarge)
+			return
+		}
+		require.NoError(t, err)
+
+		received, err := NewFrameReader(&buffer, maxMessageSize).ReadFrame()
+		if len(msg) == 0 {
+			var protocolErr *ProtocolError
+			require.ErrorAs(t, err, &protocolErr)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, msg, received)
+		require.Zero(t, buffer.Len())
+	})
+}
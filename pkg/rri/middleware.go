@@ -0,0 +1,82 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sender sends a single query and returns the response.
+type Sender func(ctx context.Context, query *Query) (*Response, error)
+
+// Middleware wraps a Sender to intercept queries and responses. Call next to pass the query on or return a response
+// directly to short-circuit sending.
+type Middleware func(next Sender) Sender
+
+// Use appends middlewares to the chain that wraps all queries sent by SendQuery, Login and Logout. The first middleware
+// is the outermost one. Queries sent with SendRaw and the login to restore a lost session are not passed through the chain.
+//
+// Middlewares are called while the client is locked and must not send queries using the same client. Use must not be
+// called while queries are in flight.
+func (client *Client) Use(middlewares ...Middleware) {
+	client.middlewares = append(client.middlewares, middlewares...)
+}
+
+// chain returns the sender that passes queries through all middlewares.
+func (client *Client) chain() Sender {
+	sender := client.sendQueryDirect
+	for i := len(client.middlewares) - 1; i >= 0; i-- {
+		sender = client.middlewares[i](sender)
+	}
+	return sender
+}
+
+// QueryProcessorMiddleware returns a middleware that passes every query to the processor before sending. Sending is
+// aborted with ErrQueryAborted if the processor returns nil.
+func QueryProcessorMiddleware(processor QueryProcessor) Middleware {
+	return func(next Sender) Sender {
+		return func(ctx context.Context, query *Query) (*Response, error) {
+			processedQuery := processor(query)
+			if processedQuery == nil {
+				return nil, ErrQueryAborted
+			}
+			return next(ctx, processedQuery)
+		}
+	}
+}
+
+// QueryPrinterMiddleware returns a middleware that prints every query and its response in the given format. Messages
+// that cannot be represented in the format are printed in key-value encoding. In contrast to Client.RawQueryPrinter,
+// retries are not printed separately.
+func QueryPrinterMiddleware(printer RawQueryPrinter, format MessageFormat) Middleware {
+	return func(next Sender) Sender {
+		return func(ctx context.Context, query *Query) (*Response, error) {
+			msg, encodeErr := query.Encode(format)
+			if encodeErr != nil {
+				msg = query.EncodeKV()
+			}
+			printer(msg, true)
+			response, err := next(ctx, query)
+			if response != nil {
+				msg, encodeErr = response.Encode(format)
+				if encodeErr != nil {
+					msg = response.EncodeKV()
+				}
+				printer(msg, false)
+			}
+			return response, err
+		}
+	}
+}
+
+// ErrorPrinterMiddleware returns a middleware that prints all errors returned for a query before passing them on.
+func ErrorPrinterMiddleware(printer ErrorPrinter) Middleware {
+	return func(next Sender) Sender {
+		return func(ctx context.Context, query *Query) (*Response, error) {
+			response, err := next(ctx, query)
+			if err != nil {
+				printer(fmt.Errorf("%s query failed: %s", query.Action(), err.Error()))
+			}
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMiddleware(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		var receivedDomains []string
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			receivedDomains = append(receivedDomains, query.FirstField(QueryFieldNameDomainIDN))
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		var calls []string
+		trace := func(name string) Middleware {
+			return func(next Sender) Sender {
+				return func(ctx context.Context, query *Query) (*Response, error) {
+					calls = append(calls, fmt.Sprintf("%s>%s", name, query.Action()))
+					response, err := next(ctx, query)
+					calls = append(calls, fmt.Sprintf("%s<%s", name, query.Action()))
+					return response, err
+				}
+			}
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true, Middlewares: []Middleware{trace("a")}})
+		require.NoError(t, err)
+		defer client.Close()
+		client.Use(trace("b"), QueryProcessorMiddleware(func(query *Query) *Query {
+			if query.Action() == ActionInfo {
+				return NewInfoDomainQuery("rewritten.de")
+			}
+			return query
+		}))
+
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"a>LOGIN", "b>LOGIN", "b<LOGIN", "a<LOGIN", "a>INFO", "b>INFO", "b<INFO", "a<INFO"}, calls)
+		assert.Equal(t, []string{"rewritten.de"}, receivedDomains)
+	})
+}
+
+func TestClientMiddlewareShortCircuit(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		queryCount := 0
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			queryCount++
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		// dry-run all queries that modify data
+		client.Use(func(next Sender) Sender {
+			return func(ctx context.Context, query *Query) (*Response, error) {
+				if query.Action() == ActionDelete {
+					return NewResponse(ResultSuccess, nil), nil
+				}
+				return next(ctx, query)
+			}
+		}, QueryProcessorMiddleware(func(query *Query) *Query {
+			if query.Action() == ActionCreate {
+				return nil
+			}
+			return query
+		}))
+
+		response, err := client.SendQuery(NewDeleteDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.True(t, response.IsSuccessful())
+		assert.Equal(t, 0, queryCount)
+
+		_, err = client.SendQuery(NewCreateDomainQuery("denic.de", DomainData{}))
+		assert.ErrorIs(t, err, ErrQueryAborted)
+		assert.Equal(t, 0, queryCount)
+
+		_, err = client.SendQuery(NewCheckDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, queryCount)
+	})
+}
+
+func TestPrinterMiddlewares(t *testing.T) {
+	var printed []string
+	var errs []error
+	var sender Sender = func(ctx context.Context, query *Query) (*Response, error) {
+		if query.Action() == ActionDelete {
+			return nil, fmt.Errorf("broken pipe")
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	}
+	sender = ErrorPrinterMiddleware(func(err error) {
+		errs = append(errs, err)
+	})(sender)
+	sender = QueryPrinterMiddleware(func(msg string, isOutgoing bool) {
+		printed = append(printed, fmt.Sprintf("%v %s", isOutgoing, msg))
+	}, MessageFormatKV)(sender)
+
+	_, err := sender(context.Background(), NewCheckDomainQuery("denic.de"))
+	require.NoError(t, err)
+	_, err = sender(context.Background(), NewDeleteDomainQuery("denic.de"))
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"true " + NewCheckDomainQuery("denic.de").EncodeKV(),
+		"false RESULT: success",
+		"true " + NewDeleteDomainQuery("denic.de").EncodeKV(),
+	}, printed)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "DELETE query failed: broken pipe", errs[0].Error())
+}
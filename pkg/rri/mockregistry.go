@@ -0,0 +1,702 @@
+package rri
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// The business messages of a MockRegistry use the message codes of the DENIC registry. The texts are shortened and
+// might differ from those of the registry.
+var (
+	// MockMessageTestEnvironment is attached to all successful responses of a MockRegistry like done by the registry test environment.
+	MockMessageTestEnvironment = NewBusinessMessage(13000000011, "Request was processed in test environment - not valid in real world [testing platform]")
+	// MockMessageQueueEmpty is returned by a MockRegistry for QUEUE-READ on an empty queue.
+	MockMessageQueueEmpty = NewBusinessMessage(13000000017, "No message in queue")
+	// MockMessageInvalidQuery is returned by a MockRegistry for every violation found by Query.Validate.
+	MockMessageInvalidQuery = NewBusinessMessage(83000000002, "Invalid request")
+	// MockMessageActionNotSupported is returned by a MockRegistry for actions it does not implement.
+	MockMessageActionNotSupported = NewBusinessMessage(83000000005, "Action not supported")
+	// MockMessageNotAuthorized is returned by a MockRegistry if the object is managed by another registrar.
+	MockMessageNotAuthorized = NewBusinessMessage(63000000003, "Object is managed by another registrar")
+	// MockMessageDomainNotFound is returned by a MockRegistry for unknown domains.
+	MockMessageDomainNotFound = NewBusinessMessage(63300062009, "Domain doesn't exist")
+	// MockMessageDomainExists is returned by a MockRegistry when creating a registered domain.
+	MockMessageDomainExists = NewBusinessMessage(63300062002, "Domain is already registered")
+	// MockMessageDomainNotDeleted is returned by a MockRegistry when restoring a domain that has not been deleted by the registrar.
+	MockMessageDomainNotDeleted = NewBusinessMessage(63300062021, "Domain is not in redemption period")
+	// MockMessageHandleNotFound is returned by a MockRegistry for unknown handles.
+	MockMessageHandleNotFound = NewBusinessMessage(63500062009, "Handle does not exist")
+	// MockMessageHandleExists is returned by a MockRegistry when creating an existing handle.
+	MockMessageHandleExists = NewBusinessMessage(63500062002, "Handle already exists")
+	// MockMessageInvalidAuthInfo is returned by a MockRegistry for CHPROV with a wrong or expired AuthInfo.
+	MockMessageInvalidAuthInfo = NewBusinessMessage(63300062030, "AuthInfo is invalid or expired")
+	// MockMessageSameProvider is returned by a MockRegistry for CHPROV of a domain that is already managed by the registrar.
+	MockMessageSameProvider = NewBusinessMessage(63300062031, "Domain is already managed by the registrar")
+	// MockMessageQueueMessageNotFound is returned by a MockRegistry for QUEUE-DELETE of a message that is not the oldest one.
+	MockMessageQueueMessageNotFound = NewBusinessMessage(63600062009, "Message is not the oldest message in queue")
+)
+
+const (
+	// MockTransitRegAccID denotes the RegAccID that manages domains after TRANSIT in a MockRegistry.
+	MockTransitRegAccID = 1000001
+)
+
+type mockDomain struct {
+	domain         string
+	domainACE      string
+	regAccID       int
+	data           DomainData
+	changed        time.Time
+	deleted        bool
+	authInfo1Hash  string
+	authInfo1Until time.Time
+	authInfo2      string
+}
+
+type mockHandle struct {
+	handle  DenicHandle
+	data    ContactData
+	changed time.Time
+}
+
+type mockQueueMessage struct {
+	id      string
+	msgType QueueMessageType
+	time    time.Time
+	fields  ResponseFieldList
+}
+
+// MockRegistry is a stateful in-memory registry for offline integration tests. It implements CREATE, INFO, CHECK,
+// UPDATE, DELETE, RESTORE, TRANSIT and CHHOLDER for domains, CREATE, INFO, CHECK and UPDATE for handles, the AuthInfo1
+// and AuthInfo2 flows, CHPROV between registrars and a message queue per registrar. Use HandleQuery as
+// MockServer.Handler. The RegAccID of a user is taken from the login name like DENIC-1000011-TEST.
+//
+// DO NOT USE IN PRODUCTION!
+type MockRegistry struct {
+	mutex   sync.Mutex
+	domains map[string]*mockDomain
+	handles map[string]*mockHandle
+	queues  map[int][]*mockQueueMessage
+	// Now returns the current time and can be replaced to control AuthInfo expiration and timestamps.
+	Now func() time.Time
+}
+
+// NewMockRegistry returns an empty registry.
+//
+// DO NOT USE IN PRODUCTION!
+func NewMockRegistry() *MockRegistry {
+	return &MockRegistry{
+		domains: make(map[string]*mockDomain),
+		handles: make(map[string]*mockHandle),
+		queues:  make(map[int][]*mockQueueMessage),
+		Now:     time.Now,
+	}
+}
+
+// HandleQuery processes a query of the given user and can be used as MockQueryHandler.
+func (reg *MockRegistry) HandleQuery(user string, session *Session, query *Query) (*Response, error) {
+	regAccID, err := parseRegAccID(user)
+	if err != nil {
+		return newMockFailure(withMockDetail(MockMessageNotAuthorized, err.Error())), nil
+	}
+
+	isHandle := len(query.FirstField(QueryFieldNameHandle)) > 0
+	if isHandle && query.Action() != ActionCheck && query.Action() != ActionInfo && query.Action() != ActionCreate && query.Action() != ActionUpdate {
+		return newMockFailure(withMockDetail(MockMessageActionNotSupported, "handles only support CREATE, INFO, CHECK and UPDATE")), nil
+	}
+
+	var validationErr *ValidationError
+	if err := query.Validate(); errors.As(err, &validationErr) {
+		messages := make([]BusinessMessage, len(validationErr.Violations))
+		for i, v := range validationErr.Violations {
+			messages[i] = withMockDetail(MockMessageInvalidQuery, v.String())
+		}
+		return newMockFailure(messages...), nil
+	}
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	switch query.Action() {
+	case ActionCheck:
+		if isHandle {
+			return reg.checkHandle(query), nil
+		}
+		return reg.checkDomain(query), nil
+	case ActionInfo:
+		if isHandle {
+			return reg.infoHandle(query), nil
+		}
+		return reg.infoDomain(query), nil
+	case ActionCreate:
+		if isHandle {
+			return reg.createHandle(regAccID, query), nil
+		}
+		return reg.createDomain(regAccID, query), nil
+	case ActionUpdate:
+		if isHandle {
+			return reg.updateHandle(regAccID, query), nil
+		}
+		return reg.updateDomain(regAccID, query), nil
+	case ActionChangeHolder:
+		return reg.updateDomain(regAccID, query), nil
+	case ActionDelete:
+		return reg.deleteDomain(regAccID, query), nil
+	case ActionRestore:
+		return reg.restoreDomain(regAccID, query), nil
+	case ActionTransit:
+		return reg.transitDomain(regAccID, query), nil
+	case ActionCreateAuthInfo1:
+		return reg.createAuthInfo1(regAccID, query), nil
+	case ActionCreateAuthInfo2:
+		return reg.createAuthInfo2(query), nil
+	case ActionChangeProvider:
+		return reg.changeProvider(regAccID, query), nil
+	case ActionQueueRead:
+		return reg.queueRead(regAccID, query), nil
+	case ActionQueueDelete:
+		return reg.queueDelete(regAccID, query), nil
+	default:
+		return newMockFailure(MockMessageActionNotSupported), nil
+	}
+}
+
+// AuthInfo2 returns the AuthInfo2 that has been created for a domain. The registry would send it to the holder by mail.
+func (reg *MockRegistry) AuthInfo2(domain string) (string, bool) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	d, ok := reg.domains[mockDomainKey(domain)]
+	if !ok || len(d.authInfo2) == 0 {
+		return "", false
+	}
+	return d.authInfo2, true
+}
+
+// DomainRegAccID returns the RegAccID of the registrar that manages a registered domain.
+func (reg *MockRegistry) DomainRegAccID(domain string) (int, bool) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	d, ok := reg.domains[mockDomainKey(domain)]
+	if !ok || d.deleted {
+		return 0, false
+	}
+	return d.regAccID, true
+}
+
+// AddQueueMessage appends a message to the queue of a registrar and returns its id. Use the fields to add a payload
+// like Domain or Expire.
+func (reg *MockRegistry) AddQueueMessage(regAccID int, msgType QueueMessageType, fields ResponseFieldList) string {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return reg.enqueue(regAccID, msgType, fields)
+}
+
+// QueueSize returns the number of messages in the queue of a registrar.
+func (reg *MockRegistry) QueueSize(regAccID int) int {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return len(reg.queues[regAccID])
+}
+
+func (reg *MockRegistry) enqueue(regAccID int, msgType QueueMessageType, fields ResponseFieldList) string {
+	msg := &mockQueueMessage{newMockID(), msgType, reg.Now(), NewResponseFieldList()}
+	fields.CopyTo(&msg.fields)
+	reg.queues[regAccID] = append(reg.queues[regAccID], msg)
+	return msg.id
+}
+
+func (reg *MockRegistry) checkDomain(query *Query) *Response {
+	domain, domainACE := queryDomain(query)
+	status := DomainStatusFree
+	if d, ok := reg.domains[mockDomainKey(domainACE)]; ok && !d.deleted {
+		status = DomainStatusConnect
+	}
+
+	fields := NewResponseFieldList()
+	fields.Add(ResponseFieldNameDomainIDN, domain)
+	fields.Add(ResponseFieldNameDomainACE, domainACE)
+	fields.Add(ResponseFieldNameStatus, string(status))
+	return newMockSuccess(fields, nil)
+}
+
+func (reg *MockRegistry) infoDomain(query *Query) *Response {
+	_, domainACE := queryDomain(query)
+	d, ok := reg.domains[mockDomainKey(domainACE)]
+	if !ok || d.deleted {
+		return newMockFailure(MockMessageDomainNotFound)
+	}
+
+	fields := NewResponseFieldList()
+	fields.Add(ResponseFieldNameDomainIDN, d.domain)
+	fields.Add(ResponseFieldNameDomainACE, d.domainACE)
+	for _, ns := range d.data.NameServers {
+		fields.Add(ResponseFieldNameNameServer, ns.String())
+	}
+	for _, key := range d.data.DNSKeys {
+		fields.Add(ResponseFieldNameDNSKey, key.String())
+	}
+	fields.Add(ResponseFieldNameStatus, string(DomainStatusConnect))
+	fields.Add(ResponseFieldNameRegAccID, fmt.Sprintf("DENIC-%d", d.regAccID))
+	fields.Add(ResponseFieldNameRegAccName, fmt.Sprintf("Registrar %d", d.regAccID))
+	fields.Add(ResponseFieldNameChanged, d.changed.Format(time.RFC3339))
+
+	var entities []ResponseEntity
+	putContacts := func(entityName ResponseEntityName, handles []DenicHandle) {
+		for _, handle := range handles {
+			entityFields := NewResponseFieldList()
+			if h, ok := reg.handles[handle.String()]; ok {
+				h.putToResponseFields(&entityFields)
+			} else {
+				entityFields.Add(ResponseFieldNameHandle, handle.String())
+			}
+			entities = append(entities, NewResponseEntity(entityName, entityFields))
+		}
+	}
+	putContacts(ResponseEntityNameHolder, d.data.HolderHandles)
+	putContacts(ResponseEntityNameGeneralRequest, d.data.GeneralRequestHandles)
+	putContacts(ResponseEntityNameAbuseContact, d.data.AbuseContactHandles)
+
+	return newMockSuccess(fields, entities)
+}
+
+func (reg *MockRegistry) createDomain(regAccID int, query *Query) *Response {
+	domain, domainACE := queryDomain(query)
+	if d, ok := reg.domains[mockDomainKey(domainACE)]; ok && !d.deleted {
+		return newMockFailure(MockMessageDomainExists)
+	}
+
+	data, errResponse := reg.queryDomainData(query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	reg.domains[mockDomainKey(domainACE)] = &mockDomain{
+		domain:    domain,
+		domainACE: domainACE,
+		regAccID:  regAccID,
+		data:      data,
+		changed:   reg.Now(),
+	}
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) updateDomain(regAccID int, query *Query) *Response {
+	d, errResponse := reg.managedDomain(regAccID, query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	data, errResponse := reg.queryDomainData(query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	d.data = data
+	d.changed = reg.Now()
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) deleteDomain(regAccID int, query *Query) *Response {
+	d, errResponse := reg.managedDomain(regAccID, query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	// deleted domains can be restored by the same registrar until they are registered again
+	d.deleted = true
+	d.changed = reg.Now()
+	reg.clearAuthInfo(d)
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) restoreDomain(regAccID int, query *Query) *Response {
+	_, domainACE := queryDomain(query)
+	d, ok := reg.domains[mockDomainKey(domainACE)]
+	if !ok || !d.deleted || d.regAccID != regAccID {
+		return newMockFailure(MockMessageDomainNotDeleted)
+	}
+
+	d.deleted = false
+	d.changed = reg.Now()
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) transitDomain(regAccID int, query *Query) *Response {
+	d, errResponse := reg.managedDomain(regAccID, query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	d.regAccID = MockTransitRegAccID
+	if query.FirstField(QueryFieldNameDisconnect) == "true" {
+		d.data.NameServers = nil
+		d.data.DNSKeys = nil
+	}
+	d.changed = reg.Now()
+	reg.clearAuthInfo(d)
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) createAuthInfo1(regAccID int, query *Query) *Response {
+	d, errResponse := reg.managedDomain(regAccID, query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	// the AuthInfo1 is valid until the end of the given day
+	expire, _ := time.Parse("20060102", query.FirstField(QueryFieldNameAuthInfoExpire))
+	d.authInfo1Hash = strings.ToLower(query.FirstField(QueryFieldNameAuthInfoHash))
+	d.authInfo1Until = expire.AddDate(0, 0, 1)
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) createAuthInfo2(query *Query) *Response {
+	_, domainACE := queryDomain(query)
+	d, ok := reg.domains[mockDomainKey(domainACE)]
+	if !ok || d.deleted {
+		return newMockFailure(MockMessageDomainNotFound)
+	}
+
+	d.authInfo2 = newMockID()
+	fields := NewResponseFieldList()
+	fields.Add(ResponseFieldNameDomainIDN, d.domain)
+	reg.enqueue(d.regAccID, QueueMessageTypeAuthInfo2Notify, fields)
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) changeProvider(regAccID int, query *Query) *Response {
+	_, domainACE := queryDomain(query)
+	d, ok := reg.domains[mockDomainKey(domainACE)]
+	if !ok || d.deleted {
+		return newMockFailure(MockMessageDomainNotFound)
+	}
+	if d.regAccID == regAccID {
+		return newMockFailure(MockMessageSameProvider)
+	}
+
+	authInfo := query.FirstField(QueryFieldNameAuthInfo)
+	validAuthInfo1 := len(d.authInfo1Hash) > 0 && reg.Now().Before(d.authInfo1Until) &&
+		subtle.ConstantTimeCompare([]byte(computeHashSHA256(authInfo)), []byte(d.authInfo1Hash)) == 1
+	validAuthInfo2 := len(d.authInfo2) > 0 && subtle.ConstantTimeCompare([]byte(authInfo), []byte(d.authInfo2)) == 1
+	if !validAuthInfo1 && !validAuthInfo2 {
+		return newMockFailure(MockMessageInvalidAuthInfo)
+	}
+
+	data, errResponse := reg.queryDomainData(query)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	fields := NewResponseFieldList()
+	fields.Add(ResponseFieldNameDomainIDN, d.domain)
+	fields.Add(ResponseFieldNameRegAccID, fmt.Sprintf("DENIC-%d", regAccID))
+	reg.enqueue(d.regAccID, QueueMessageTypeChangeProvider, fields)
+
+	d.regAccID = regAccID
+	d.data = data
+	d.changed = reg.Now()
+	reg.clearAuthInfo(d)
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) checkHandle(query *Query) *Response {
+	handle, _ := ParseDenicHandle(query.FirstField(QueryFieldNameHandle))
+	status := DomainStatusFree
+	if _, ok := reg.handles[handle.String()]; ok {
+		status = DomainStatusConnect
+	}
+
+	fields := NewResponseFieldList()
+	fields.Add(ResponseFieldNameHandle, handle.String())
+	fields.Add(ResponseFieldNameStatus, string(status))
+	return newMockSuccess(fields, nil)
+}
+
+func (reg *MockRegistry) infoHandle(query *Query) *Response {
+	handle, _ := ParseDenicHandle(query.FirstField(QueryFieldNameHandle))
+	h, ok := reg.handles[handle.String()]
+	if !ok {
+		return newMockFailure(MockMessageHandleNotFound)
+	}
+
+	fields := NewResponseFieldList()
+	h.putToResponseFields(&fields)
+
+	var entities []ResponseEntity
+	for _, vi := range h.data.VerificationInformation {
+		entityFields := NewResponseFieldList()
+		for _, claim := range vi.VerifiedClaim {
+			entityFields.Add(ResponseFieldName(QueryFieldNameVerifiedClaim), string(claim))
+		}
+		entityFields.Add(ResponseFieldName(QueryFieldNameVerificationResult), string(vi.VerificationResult))
+		entityFields.Add(ResponseFieldName(QueryFieldNameVerificationReference), vi.VerificationReference)
+		entityFields.Add(ResponseFieldName(QueryFieldNameVerificationTimestamp), vi.VerificationTimestamp.Format(VerificationInformationTimestampFormat))
+		entityFields.Add(ResponseFieldName(QueryFieldNameVerificationEvidence), string(vi.VerificationEvidence))
+		entityFields.Add(ResponseFieldName(QueryFieldNameVerificationMethod), string(vi.VerificationMethod))
+		entityFields.Add(ResponseFieldName(QueryFieldNameTrustFramework), string(vi.TrustFramework))
+		entities = append(entities, NewResponseEntity(ResponseEntityName(QueryEntityVerificationInformation), entityFields))
+	}
+
+	return newMockSuccess(fields, entities)
+}
+
+func (reg *MockRegistry) createHandle(regAccID int, query *Query) *Response {
+	handle, _ := ParseDenicHandle(query.FirstField(QueryFieldNameHandle))
+	if handle.RegAccID != regAccID {
+		return newMockFailure(MockMessageNotAuthorized)
+	}
+	if _, ok := reg.handles[handle.String()]; ok {
+		return newMockFailure(MockMessageHandleExists)
+	}
+
+	data, err := queryContactData(query)
+	if err != nil {
+		return newMockFailure(withMockDetail(MockMessageInvalidQuery, err.Error()))
+	}
+
+	reg.handles[handle.String()] = &mockHandle{handle, data, reg.Now()}
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) updateHandle(regAccID int, query *Query) *Response {
+	handle, _ := ParseDenicHandle(query.FirstField(QueryFieldNameHandle))
+	h, ok := reg.handles[handle.String()]
+	if !ok {
+		return newMockFailure(MockMessageHandleNotFound)
+	}
+	if handle.RegAccID != regAccID {
+		return newMockFailure(MockMessageNotAuthorized)
+	}
+
+	data, err := queryContactData(query)
+	if err != nil {
+		return newMockFailure(withMockDetail(MockMessageInvalidQuery, err.Error()))
+	}
+
+	h.data = data
+	h.changed = reg.Now()
+	return newMockSuccess(nil, nil)
+}
+
+func (reg *MockRegistry) queueRead(regAccID int, query *Query) *Response {
+	msg, _ := reg.oldestQueueMessage(regAccID, QueueMessageType(query.FirstField(QueryFieldNameMsgType)))
+	if msg == nil {
+		return newMockSuccess(nil, nil, MockMessageQueueEmpty)
+	}
+
+	msgFields := NewResponseFieldList()
+	msgFields.Add(ResponseFieldNameMsgID, msg.id)
+	msgFields.Add(ResponseFieldNameMsgType, string(msg.msgType))
+	msgFields.Add(ResponseFieldNameMsgTime, msg.time.Format(time.RFC3339))
+	return newMockSuccess(nil, []ResponseEntity{
+		NewResponseEntity(ResponseEntityNameMsg, msgFields),
+		NewResponseEntity(ResponseEntityName(msg.msgType), msg.fields),
+	})
+}
+
+func (reg *MockRegistry) queueDelete(regAccID int, query *Query) *Response {
+	msg, index := reg.oldestQueueMessage(regAccID, QueueMessageType(query.FirstField(QueryFieldNameMsgType)))
+	if msg == nil || msg.id != query.FirstField(QueryFieldNameMsgID) {
+		return newMockFailure(MockMessageQueueMessageNotFound)
+	}
+
+	queue := reg.queues[regAccID]
+	reg.queues[regAccID] = append(queue[:index:index], queue[index+1:]...)
+	return newMockSuccess(nil, nil)
+}
+
+// oldestQueueMessage returns the oldest message of the given type or of any type if msgType is empty.
+func (reg *MockRegistry) oldestQueueMessage(regAccID int, msgType QueueMessageType) (*mockQueueMessage, int) {
+	for i, msg := range reg.queues[regAccID] {
+		if len(msgType) == 0 || msg.msgType.Normalize() == msgType.Normalize() {
+			return msg, i
+		}
+	}
+	return nil, -1
+}
+
+// managedDomain returns the registered domain of the query if it is managed by the registrar.
+func (reg *MockRegistry) managedDomain(regAccID int, query *Query) (*mockDomain, *Response) {
+	_, domainACE := queryDomain(query)
+	d, ok := reg.domains[mockDomainKey(domainACE)]
+	if !ok || d.deleted {
+		return nil, newMockFailure(MockMessageDomainNotFound)
+	}
+	if d.regAccID != regAccID {
+		return nil, newMockFailure(MockMessageNotAuthorized)
+	}
+	return d, nil
+}
+
+// queryDomainData reads the domain data of the query and checks that all handles exist.
+func (reg *MockRegistry) queryDomainData(query *Query) (DomainData, *Response) {
+	var data DomainData
+	var missing []BusinessMessage
+	readHandles := func(fieldName QueryFieldName) []DenicHandle {
+		var handles []DenicHandle
+		for _, str := range query.Field(fieldName) {
+			handle, _ := ParseDenicHandle(str)
+			if _, ok := reg.handles[handle.String()]; !ok {
+				missing = append(missing, withMockDetail(MockMessageHandleNotFound, handle.String()))
+			}
+			handles = append(handles, handle)
+		}
+		return handles
+	}
+
+	data.HolderHandles = readHandles(QueryFieldNameHolder)
+	data.GeneralRequestHandles = readHandles(QueryFieldNameGeneralRequest)
+	data.AbuseContactHandles = readHandles(QueryFieldNameAbuseContact)
+	if len(missing) > 0 {
+		return DomainData{}, newMockFailure(missing...)
+	}
+
+	// values have already been checked by Query.Validate
+	for _, str := range query.Field(QueryFieldNameNameServer) {
+		ns, _ := ParseNameServer(str)
+		ns.HostName = ns.HostNameACE()
+		data.NameServers = append(data.NameServers, ns)
+	}
+	for _, str := range query.Field(QueryFieldNameDNSKey) {
+		key, _ := ParseDNSKey(str)
+		data.DNSKeys = append(data.DNSKeys, key)
+	}
+	return data, nil
+}
+
+func (reg *MockRegistry) clearAuthInfo(d *mockDomain) {
+	d.authInfo1Hash = ""
+	d.authInfo1Until = time.Time{}
+	d.authInfo2 = ""
+}
+
+func (h *mockHandle) putToResponseFields(fields *ResponseFieldList) {
+	putLines := func(fieldName ResponseFieldName, str string) {
+		if len(str) > 0 {
+			fields.Add(fieldName, splitLines(str)...)
+		}
+	}
+
+	fields.Add(ResponseFieldNameHandle, h.handle.String())
+	fields.Add(ResponseFieldNameType, string(h.data.Type.Normalize()))
+	fields.Add(ResponseFieldNameName, h.data.Name)
+	putLines(ResponseFieldNameOrganisation, h.data.Organisation)
+	putLines(ResponseFieldNameAddress, h.data.Address)
+	fields.Add(ResponseFieldNamePostalCode, h.data.PostalCode)
+	fields.Add(ResponseFieldNameCity, h.data.City)
+	fields.Add(ResponseFieldNameCountryCode, h.data.CountryCode)
+	fields.Add(ResponseFieldNameEMail, h.data.EMail...)
+	if len(h.data.Phone) > 0 {
+		fields.Add(ResponseFieldNamePhone, h.data.Phone)
+	}
+	fields.Add(ResponseFieldNameChanged, h.changed.Format(time.RFC3339))
+}
+
+// queryContactData reads the contact data and verification information of the query.
+func queryContactData(query *Query) (ContactData, error) {
+	fields := query.Fields()
+	nonEmpty := func(values []string) []string {
+		var result []string
+		for _, v := range values {
+			if len(v) > 0 {
+				result = append(result, v)
+			}
+		}
+		return result
+	}
+
+	data := ContactData{
+		Type:         ContactType(fields.FirstValue(QueryFieldNameType)).Normalize(),
+		Name:         fields.FirstValue(QueryFieldNameName),
+		Organisation: strings.Join(nonEmpty(fields.Values(QueryFieldNameOrganisation)), "\n"),
+		Address:      strings.Join(nonEmpty(fields.Values(QueryFieldNameAddress)), "\n"),
+		PostalCode:   fields.FirstValue(QueryFieldNamePostalCode),
+		City:         fields.FirstValue(QueryFieldNameCity),
+		CountryCode:  strings.ToUpper(fields.FirstValue(QueryFieldNameCountryCode)),
+		EMail:        nonEmpty(fields.Values(QueryFieldNameEMail)),
+		Phone:        fields.FirstValue(QueryFieldNamePhone),
+	}
+
+	verificationInformation, err := query.ExtractVerificationInformation()
+	if err != nil {
+		return ContactData{}, err
+	}
+	for _, vi := range verificationInformation {
+		data.VerificationInformation = append(data.VerificationInformation, *vi)
+	}
+	return data, nil
+}
+
+// queryDomain returns the IDN and ACE domain name of the query.
+func queryDomain(query *Query) (string, string) {
+	domain := query.FirstField(QueryFieldNameDomainIDN)
+	domainACE := query.FirstField(QueryFieldNameDomainACE)
+	if len(domainACE) == 0 {
+		domainACE, _ = idna.Lookup.ToASCII(domain)
+	}
+	if len(domain) == 0 {
+		domain, _ = idna.ToUnicode(domainACE)
+	}
+	return domain, strings.ToLower(domainACE)
+}
+
+func mockDomainKey(domain string) string {
+	if ace, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, ".")); err == nil {
+		return ace
+	}
+	return strings.ToLower(domain)
+}
+
+// parseRegAccID returns the RegAccID of a login name like DENIC-1000011-TEST.
+func parseRegAccID(user string) (int, error) {
+	parts := strings.Split(user, "-")
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("malformed login name")
+	}
+	regAccID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("malformed login name")
+	}
+	return regAccID, nil
+}
+
+func newMockSuccess(fields ResponseFieldList, entities []ResponseEntity, infos ...BusinessMessage) *Response {
+	response := NewResponseWithInfo(ResultSuccess, nil, append(infos, MockMessageTestEnvironment)...)
+	response.fields.Add(ResponseFieldNameSTID, newMockSTID())
+	fields.CopyTo(&response.fields)
+	return response.WithEntities(entities...)
+}
+
+// withMockDetail returns the message with the detail appended to its text.
+func withMockDetail(msg BusinessMessage, detail string) BusinessMessage {
+	return NewBusinessMessage(msg.ID(), fmt.Sprintf("%s: %s", msg.Message(), detail))
+}
+
+func newMockFailure(errors ...BusinessMessage) *Response {
+	response := NewResponseWithError(ResultFailure, nil, errors...)
+	response.fields.Add(ResponseFieldNameSTID, newMockSTID())
+	return response
+}
+
+// newMockSTID returns a random server transaction id in UUID format.
+func newMockSTID() string {
+	id := newMockID()
+	return fmt.Sprintf("%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:32])
+}
+
+func newMockID() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		panic(fmt.Sprintf("failed to generate random id: %s", err.Error()))
+	}
+	return hex.EncodeToString(buffer)
+}
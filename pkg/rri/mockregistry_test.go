@@ -0,0 +1,247 @@
+package rri
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withMockRegistry runs f with two logged in clients of different registrars.
+func withMockRegistry(t *testing.T, f func(registry *MockRegistry, client1, client2 *Client)) {
+	mustWithMockServer(func(server *MockServer) {
+		registry := NewMockRegistry()
+		server.Handler = registry.HandleQuery
+		server.AddUser("DENIC-1000011-TEST", "secret1")
+		server.AddUser("DENIC-1000022-TEST", "secret2")
+
+		client1, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client1.Close()
+		require.NoError(t, client1.Login("DENIC-1000011-TEST", "secret1"))
+
+		client2, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client2.Close()
+		require.NoError(t, client2.Login("DENIC-1000022-TEST", "secret2"))
+
+		f(registry, client1, client2)
+	})
+}
+
+func requireMockSuccess(t *testing.T, client *Client, query *Query) *Response {
+	response, err := client.SendQuery(query)
+	require.NoError(t, err)
+	require.NoError(t, response.Err())
+	assert.Len(t, response.STID(), 36)
+	return response
+}
+
+func requireMockFailure(t *testing.T, client *Client, query *Query, expectedMsg BusinessMessage) {
+	response, err := client.SendQuery(query)
+	require.NoError(t, err)
+	require.Equal(t, ResultFailure, response.Result())
+	require.NotEmpty(t, response.ErrorMessages())
+	assert.Equal(t, expectedMsg.ID(), response.ErrorMessages()[0].ID())
+}
+
+func createMockHandles(t *testing.T, client *Client, regAccID int) DomainData {
+	domainData := DomainData{
+		HolderHandles:         []DenicHandle{NewDenicHandle(regAccID, "HOLDER")},
+		GeneralRequestHandles: []DenicHandle{NewDenicHandle(regAccID, "REQUEST")},
+		AbuseContactHandles:   []DenicHandle{NewDenicHandle(regAccID, "ABUSE")},
+		NameServers:           []NameServer{NewNameServer("ns1.denic.de"), NewNameServer("ns2.denic.de")},
+	}
+	requireMockSuccess(t, client, NewCreateContactQuery(domainData.HolderHandles[0], validContactData()))
+	requireMockSuccess(t, client, NewCreateContactQuery(domainData.GeneralRequestHandles[0], ContactData{Type: ContactTypeRequest, EMail: []string{"request@denic.de"}}))
+	requireMockSuccess(t, client, NewCreateContactQuery(domainData.AbuseContactHandles[0], ContactData{Type: ContactTypeRequest, EMail: []string{"abuse@denic.de"}}))
+	return domainData
+}
+
+func TestMockRegistryHandles(t *testing.T) {
+	withMockRegistry(t, func(registry *MockRegistry, client1, client2 *Client) {
+		handle := NewDenicHandle(1000011, "DUDE")
+		response := requireMockSuccess(t, client1, NewCheckHandleQuery(handle))
+		assert.Equal(t, "free", response.FirstField(ResponseFieldNameStatus))
+		requireMockFailure(t, client1, NewInfoHandleQuery(handle), MockMessageHandleNotFound)
+
+		contactData := validContactData()
+		contactData.Organisation = "Duck Industries\nFinance Department"
+		requireMockSuccess(t, client1, NewCreateContactQuery(handle, contactData))
+		requireMockFailure(t, client1, NewCreateContactQuery(handle, contactData), MockMessageHandleExists)
+		requireMockFailure(t, client2, NewCreateContactQuery(NewDenicHandle(1000011, "OTHER"), contactData), MockMessageNotAuthorized)
+
+		response = requireMockSuccess(t, client1, NewCheckHandleQuery(handle))
+		assert.Equal(t, "connect", response.FirstField(ResponseFieldNameStatus))
+		info, err := requireMockSuccess(t, client2, NewInfoHandleQuery(handle)).ContactInfo()
+		require.NoError(t, err)
+		assert.Equal(t, handle, info.Handle)
+		assert.Equal(t, contactData.Organisation, info.ContactData.Organisation)
+		assert.Equal(t, contactData.EMail, info.ContactData.EMail)
+		require.Len(t, info.ContactData.VerificationInformation, 1)
+		assert.Equal(t, contactData.VerificationInformation[0].VerifiedClaim, info.ContactData.VerificationInformation[0].VerifiedClaim)
+
+		contactData.City = "Frankfurt am Main"
+		fields := NewQueryFieldList()
+		fields.Add(QueryFieldNameHandle, handle.String())
+		contactData.PutToQueryFields(&fields)
+		query := NewQuery(LatestVersion, ActionUpdate, fields)
+		requireMockFailure(t, client2, query, MockMessageNotAuthorized)
+		requireMockSuccess(t, client1, query)
+		info, err = requireMockSuccess(t, client1, NewInfoHandleQuery(handle)).ContactInfo()
+		require.NoError(t, err)
+		assert.Equal(t, "Frankfurt am Main", info.ContactData.City)
+
+		// other actions are only defined for domains
+		for _, action := range []QueryAction{ActionDelete, ActionRestore, ActionChangeHolder, ActionCreateAuthInfo2} {
+			fields := NewQueryFieldList()
+			fields.Add(QueryFieldNameHandle, handle.String())
+			requireMockFailure(t, client1, NewQuery(LatestVersion, action, fields), MockMessageActionNotSupported)
+		}
+		requireMockSuccess(t, client1, NewCheckHandleQuery(handle))
+	})
+}
+
+func TestMockRegistryDomainLifecycle(t *testing.T) {
+	withMockRegistry(t, func(registry *MockRegistry, client1, client2 *Client) {
+		domainData := createMockHandles(t, client1, 1000011)
+
+		response := requireMockSuccess(t, client1, NewCheckDomainQuery("dönic.de"))
+		assert.Equal(t, "free", response.FirstField(ResponseFieldNameStatus))
+		assert.Equal(t, "xn--dnic-5qa.de", response.FirstField(ResponseFieldNameDomainACE))
+		requireMockFailure(t, client1, NewInfoDomainQuery("dönic.de"), MockMessageDomainNotFound)
+
+		invalidData := domainData
+		invalidData.HolderHandles = []DenicHandle{NewDenicHandle(1000011, "UNKNOWN")}
+		requireMockFailure(t, client1, NewCreateDomainQuery("dönic.de", invalidData), MockMessageHandleNotFound)
+		requireMockFailure(t, client1, NewCreateDomainQuery("dönic.com", domainData), MockMessageInvalidQuery)
+
+		requireMockSuccess(t, client1, NewCreateDomainQuery("dönic.de", domainData))
+		requireMockFailure(t, client2, NewCreateDomainQuery("xn--dnic-5qa.de", domainData), MockMessageDomainExists)
+
+		info, err := requireMockSuccess(t, client2, NewInfoDomainQuery("xn--dnic-5qa.de")).DomainInfo()
+		require.NoError(t, err)
+		assert.Equal(t, "dönic.de", info.Domain)
+		assert.Equal(t, DomainStatusConnect, info.Status)
+		assert.Equal(t, "DENIC-1000011", info.RegAccID)
+		assert.Equal(t, domainData.HolderHandles, info.HolderHandles)
+		assert.Equal(t, domainData.GeneralRequestHandles, info.GeneralRequestHandles)
+		assert.Equal(t, domainData.AbuseContactHandles, info.AbuseContactHandles)
+		assert.Equal(t, domainData.NameServers, info.NameServers)
+
+		updatedData := info.DomainData()
+		updatedData.NameServers = []NameServer{NewNameServer("ns1.dönic.de", netip.MustParseAddr("81.91.170.1"))}
+		updatedData.DNSKeys = []DNSKey{{257, 3, 8, "AwEAAb1Xh6Y="}}
+		requireMockFailure(t, client2, NewUpdateDomainQuery("dönic.de", updatedData), MockMessageNotAuthorized)
+		requireMockSuccess(t, client1, NewUpdateDomainQuery("dönic.de", updatedData))
+		info, err = requireMockSuccess(t, client1, NewInfoDomainQuery("dönic.de")).DomainInfo()
+		require.NoError(t, err)
+		assert.Equal(t, []NameServer{NewNameServer("ns1.xn--dnic-5qa.de", netip.MustParseAddr("81.91.170.1"))}, info.NameServers)
+		assert.Equal(t, updatedData.DNSKeys, info.DNSKeys)
+
+		requireMockFailure(t, client1, NewRestoreDomainQuery("dönic.de"), MockMessageDomainNotDeleted)
+		requireMockSuccess(t, client1, NewDeleteDomainQuery("dönic.de"))
+		requireMockFailure(t, client1, NewInfoDomainQuery("dönic.de"), MockMessageDomainNotFound)
+		requireMockFailure(t, client2, NewRestoreDomainQuery("dönic.de"), MockMessageDomainNotDeleted)
+		requireMockSuccess(t, client1, NewRestoreDomainQuery("dönic.de"))
+		requireMockSuccess(t, client1, NewInfoDomainQuery("dönic.de"))
+
+		requireMockSuccess(t, client1, NewTransitDomainQuery("dönic.de", true))
+		regAccID, ok := registry.DomainRegAccID("dönic.de")
+		assert.True(t, ok)
+		assert.Equal(t, MockTransitRegAccID, regAccID)
+		info, err = requireMockSuccess(t, client1, NewInfoDomainQuery("dönic.de")).DomainInfo()
+		require.NoError(t, err)
+		assert.Empty(t, info.NameServers)
+		requireMockFailure(t, client1, NewDeleteDomainQuery("dönic.de"), MockMessageNotAuthorized)
+	})
+}
+
+func TestMockRegistryChangeProvider(t *testing.T) {
+	withMockRegistry(t, func(registry *MockRegistry, client1, client2 *Client) {
+		now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+		registry.Now = func() time.Time { return now }
+
+		oldDomainData := createMockHandles(t, client1, 1000011)
+		requireMockSuccess(t, client1, NewCreateDomainQuery("denic.de", oldDomainData))
+		newDomainData := createMockHandles(t, client2, 1000022)
+
+		// AuthInfo1 is set by the current registrar and passed on by the holder
+		requireMockFailure(t, client2, NewCreateAuthInfo1Query("denic.de", "secret", now), MockMessageNotAuthorized)
+		requireMockSuccess(t, client1, NewCreateAuthInfo1Query("denic.de", "secret", now))
+		requireMockFailure(t, client1, NewChangeProviderQuery("denic.de", "secret", newDomainData), MockMessageSameProvider)
+		requireMockFailure(t, client2, NewChangeProviderQuery("denic.de", "wrong", newDomainData), MockMessageInvalidAuthInfo)
+		now = now.AddDate(0, 0, 1)
+		requireMockFailure(t, client2, NewChangeProviderQuery("denic.de", "secret", newDomainData), MockMessageInvalidAuthInfo)
+		requireMockSuccess(t, client1, NewCreateAuthInfo1Query("denic.de", "secret", now))
+		requireMockSuccess(t, client2, NewChangeProviderQuery("denic.de", "secret", newDomainData))
+		regAccID, _ := registry.DomainRegAccID("denic.de")
+		assert.Equal(t, 1000022, regAccID)
+
+		// AuthInfo2 is requested by the new registrar and sent to the holder by the registry
+		_, ok := registry.AuthInfo2("denic.de")
+		assert.False(t, ok)
+		requireMockSuccess(t, client1, NewCreateAuthInfo2Query("denic.de"))
+		authInfo2, ok := registry.AuthInfo2("denic.de")
+		require.True(t, ok)
+		requireMockSuccess(t, client1, NewChangeProviderQuery("denic.de", authInfo2, oldDomainData))
+		regAccID, _ = registry.DomainRegAccID("denic.de")
+		assert.Equal(t, 1000011, regAccID)
+		_, ok = registry.AuthInfo2("denic.de")
+		assert.False(t, ok)
+
+		// registrar 1000011 lost the domain once, registrar 1000022 got notified about the AuthInfo2 and lost the domain
+		assert.Equal(t, 1, registry.QueueSize(1000011))
+		assert.Equal(t, 2, registry.QueueSize(1000022))
+
+		msg, err := requireMockSuccess(t, client1, NewQueueReadQuery("")).QueueMessage()
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, QueueMessageTypeChangeProvider, msg.Type)
+		assert.True(t, now.Equal(msg.Timestamp))
+		assert.Equal(t, ChangeProviderPayload{"denic.de", "DENIC-1000022"}, msg.Payload)
+
+		msg, err = requireMockSuccess(t, client2, NewQueueReadQuery(string(QueueMessageTypeChangeProvider))).QueueMessage()
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, ChangeProviderPayload{"denic.de", "DENIC-1000011"}, msg.Payload)
+		requireMockFailure(t, client2, NewQueueDeleteQuery(msg.ID, ""), MockMessageQueueMessageNotFound)
+		requireMockSuccess(t, client2, NewQueueDeleteQuery(msg.ID, string(QueueMessageTypeChangeProvider)))
+
+		msg, err = requireMockSuccess(t, client2, NewQueueReadQuery("")).QueueMessage()
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, AuthInfoPayload{Domain: "denic.de"}, msg.Payload)
+		requireMockSuccess(t, client2, NewQueueDeleteQuery(msg.ID, ""))
+
+		response := requireMockSuccess(t, client2, NewQueueReadQuery(""))
+		msg, err = response.QueueMessage()
+		require.NoError(t, err)
+		assert.Nil(t, msg)
+		assert.Equal(t, MockMessageQueueEmpty, response.InfoMessages()[0])
+	})
+}
+
+func TestMockRegistryQueueMessage(t *testing.T) {
+	withMockRegistry(t, func(registry *MockRegistry, client1, client2 *Client) {
+		fields := NewResponseFieldList()
+		fields.Add(ResponseFieldNameDomainIDN, "denic.de")
+		fields.Add(ResponseFieldNameExpire, "2021-07-01T00:00:00+02:00")
+		id := registry.AddQueueMessage(1000011, QueueMessageTypeExpireWarning, fields)
+
+		msg, err := requireMockSuccess(t, client1, NewQueueReadQuery("")).QueueMessage()
+		require.NoError(t, err)
+		require.NotNil(t, msg)
+		assert.Equal(t, id, msg.ID)
+		payload, ok := msg.Payload.(ExpirePayload)
+		require.True(t, ok)
+		assert.Equal(t, "denic.de", payload.Domain)
+		assert.True(t, time.Date(2021, time.June, 30, 22, 0, 0, 0, time.UTC).Equal(payload.Expire))
+
+		msg, err = requireMockSuccess(t, client2, NewQueueReadQuery("")).QueueMessage()
+		require.NoError(t, err)
+		assert.Nil(t, msg)
+	})
+}
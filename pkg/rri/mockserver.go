@@ -1,6 +1,7 @@
 package rri
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -9,6 +10,8 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
+	"sync"
 	"time"
 )
 
@@ -56,69 +59,137 @@ func NewMockTLSConfig() (*tls.Config, error) {
 	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}, nil
 }
 
-// MockQueryHandler is called for every query, except LOGIN and LOGOUT.
+// MockQueryHandler is called for every query of authenticated sessions, except LOGIN and LOGOUT.
 type MockQueryHandler func(user string, session *Session, query *Query) (*Response, error)
 
 // MockServer represents a mock RRI server with mocked user authentication.
 type MockServer struct {
-	server  *Server
-	address string
-	users   map[string]string
-	Handler MockQueryHandler
+	server    *Server
+	address   string
+	usersLock sync.RWMutex
+	users     map[string]string
+	queryLock sync.Mutex
+	queries   []*Query
+	// Handler must not be changed while the server is running, use SetHandler instead. If nil, all queries except
+	// LOGIN and LOGOUT are answered with success, even for sessions that are not authenticated.
+	Handler     MockQueryHandler
+	handlerLock sync.RWMutex
 }
 
 // Run starts the underlying RRI server.
 func (server *MockServer) Run() error {
-	server.server.Handler = func(session *Session, query *Query) (*Response, error) {
-		switch query.Action() {
-		case ActionLogin:
-			user := query.FirstField(QueryFieldNameUser)
-			pass := query.FirstField(QueryFieldNamePassword)
-			if userPass, ok := server.users[user]; ok && pass == userPass {
-				session.Set("user", user)
-				return NewResponse(ResultSuccess, nil), nil
-			}
-			return NewResponseWithError(ResultFailure, nil, NewBusinessMessage(83000000010, "Please login first")), nil
-
-		case ActionLogout:
-			return nil, ErrCloseConnection
-
-		default:
-			if server.Handler == nil {
-				return NewResponse(ResultSuccess, nil), nil
-			}
-			user, ok := session.GetString("user")
-			if !ok {
-				return NewResponseWithError(ResultFailure, nil, NewBusinessMessage(83000000010, "Please login first")), nil
-			}
-			return server.Handler(user, session, query)
+	mux := NewServeMux()
+	mux.Use(server.recordQueries, server.defaultHandler, AuthMiddleware(server.checkUser))
+	mux.HandleFallback(func(session *Session, query *Query) (*Response, error) {
+		handler := server.handler()
+		if handler == nil {
+			return NewResponse(ResultSuccess, nil), nil
 		}
-	}
+		user, _ := session.User()
+		return handler(user, session, query)
+	})
+	server.server.Handler = mux.ServeQuery
 
 	return server.server.Run()
 }
 
+// SetHandler replaces Handler and is safe to call while the server is running.
+func (server *MockServer) SetHandler(handler MockQueryHandler) {
+	server.handlerLock.Lock()
+	defer server.handlerLock.Unlock()
+	server.Handler = handler
+}
+
+func (server *MockServer) handler() MockQueryHandler {
+	server.handlerLock.RLock()
+	defer server.handlerLock.RUnlock()
+	return server.Handler
+}
+
+// defaultHandler answers all queries except LOGIN and LOGOUT with success if no Handler is set, without requiring
+// authentication.
+func (server *MockServer) defaultHandler(next QueryHandler) QueryHandler {
+	return func(session *Session, query *Query) (*Response, error) {
+		if query.Action() != ActionLogin && query.Action() != ActionLogout && server.handler() == nil {
+			return NewResponse(ResultSuccess, nil), nil
+		}
+		return next(session, query)
+	}
+}
+
+// Ready returns a channel that is closed as soon as the underlying RRI server accepts client connections.
+func (server *MockServer) Ready() <-chan struct{} {
+	return server.server.Ready()
+}
+
+// Faults returns the fault injector of the underlying RRI server to test error handling of clients.
+func (server *MockServer) Faults() *FaultInjector {
+	return server.server.FaultInjector
+}
+
 // Close closes the underlying RRI server.
 func (server *MockServer) Close() error {
 	return server.server.Close()
 }
 
+// Shutdown gracefully shuts down the underlying RRI server.
+func (server *MockServer) Shutdown(ctx context.Context) error {
+	return server.server.Shutdown(ctx)
+}
+
 // AddUser adds a new user with given password or overwrites an existing one.
 func (server *MockServer) AddUser(user, pass string) {
+	server.usersLock.Lock()
+	defer server.usersLock.Unlock()
 	server.users[user] = pass
 }
 
 // RemoveUser removes a user from the authentication list.
 func (server *MockServer) RemoveUser(user string) {
+	server.usersLock.Lock()
+	defer server.usersLock.Unlock()
 	delete(server.users, user)
 }
 
+func (server *MockServer) checkUser(user, pass string) bool {
+	server.usersLock.RLock()
+	defer server.usersLock.RUnlock()
+	userPass, ok := server.users[user]
+	return ok && pass == userPass
+}
+
+func (server *MockServer) recordQueries(next QueryHandler) QueryHandler {
+	return func(session *Session, query *Query) (*Response, error) {
+		server.queryLock.Lock()
+		server.queries = append(server.queries, query)
+		server.queryLock.Unlock()
+		return next(session, query)
+	}
+}
+
+// Queries returns all queries received so far in order, including LOGIN and LOGOUT.
+func (server *MockServer) Queries() []*Query {
+	server.queryLock.Lock()
+	defer server.queryLock.Unlock()
+	queries := make([]*Query, len(server.queries))
+	copy(queries, server.queries)
+	return queries
+}
+
+// ResetQueries clears the list of received queries.
+func (server *MockServer) ResetQueries() {
+	server.queryLock.Lock()
+	defer server.queryLock.Unlock()
+	server.queries = nil
+}
+
 // Address returns the local address to use for an RRI client.
 func (server *MockServer) Address() string {
 	return server.address
 }
 
-// NewMockServer returns a mock server with user authentication for testing.
+// NewMockServer returns a mock server with user authentication for testing. Pass port 0 to listen on a random free
+// port and use Address to connect.
 //
 // DO NOT USE IN PRODUCTION!
 func NewMockServer(port int) (*MockServer, error) {
@@ -131,8 +202,17 @@ func NewMockServer(port int) (*MockServer, error) {
 	if err != nil {
 		return nil, err
 	}
+	server.FaultInjector = NewFaultInjector()
+
+	return &MockServer{server: server, address: localAddress(server), users: make(map[string]string)}, nil
+}
 
-	return &MockServer{server, fmt.Sprintf("localhost:%d", port), make(map[string]string), nil}, nil
+// localAddress returns the address to connect to a server running on the local machine.
+func localAddress(server *Server) string {
+	if addr, ok := server.Addr().(*net.TCPAddr); ok {
+		return fmt.Sprintf("localhost:%d", addr.Port)
+	}
+	return server.Addr().String()
 }
 
 // WithMockServer initializes and starts a mock server for the execution of f.
@@ -144,21 +224,27 @@ func WithMockServer(port int, f func(server *MockServer) error) error {
 		return err
 	}
 
-	var runError error
+	runError := make(chan error, 1)
 	go func() {
-		runError = server.Run()
+		runError <- server.Run()
 	}()
+	select {
+	case <-server.Ready():
+	case err := <-runError:
+		server.Close()
+		return err
+	}
 	result := f(server)
 	server.Close()
 
-	if result != nil {
-		return result
+	if err := <-runError; result == nil {
+		return err
 	}
-	return runError
+	return result
 }
 
 func mustWithMockServer(f func(server *MockServer)) {
-	if err := WithMockServer(31298, func(server *MockServer) error {
+	if err := WithMockServer(0, func(server *MockServer) error {
 		f(server)
 		return nil
 	}); err != nil {
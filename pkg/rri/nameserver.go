@@ -0,0 +1,119 @@
+package rri
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// NameServer represents a name server host name with optional glue addresses. Glue addresses are required for name
+// servers within the domain they serve.
+type NameServer struct {
+	HostName  string
+	Addresses []netip.Addr
+}
+
+// NewNameServer returns a new name server with the given glue addresses.
+func NewNameServer(hostName string, addresses ...netip.Addr) NameServer {
+	return NameServer{hostName, addresses}
+}
+
+// HostNameACE returns the host name in ACE representation. IDN host names are converted like in PutDomainToQueryFields.
+func (ns NameServer) HostNameACE() string {
+	if strings.HasPrefix(strings.ToLower(ns.HostName), "xn--") {
+		return ns.HostName
+	}
+	if ace, err := idna.ToASCII(ns.HostName); err == nil {
+		return ace
+	}
+	return ns.HostName
+}
+
+// HostNameIDN returns the host name in IDN representation.
+func (ns NameServer) HostNameIDN() string {
+	if idn, err := idna.ToUnicode(ns.HostName); err == nil {
+		return idn
+	}
+	return ns.HostName
+}
+
+// String returns the name server in RRI nserver syntax, separating the ACE host name and glue addresses by spaces.
+func (ns NameServer) String() string {
+	parts := make([]string, 1, 1+len(ns.Addresses))
+	parts[0] = ns.HostNameACE()
+	for _, addr := range ns.Addresses {
+		parts = append(parts, addr.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// Validate checks the host name syntax and glue addresses.
+func (ns NameServer) Validate() error {
+	hostName := strings.TrimSuffix(ns.HostNameACE(), ".")
+	if len(hostName) == 0 {
+		return fmt.Errorf("name server host name is empty")
+	}
+	if len(hostName) > 253 {
+		return fmt.Errorf("name server host name %q is too long", ns.HostName)
+	}
+	labels := strings.Split(hostName, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("name server host name %q must be fully qualified", ns.HostName)
+	}
+	for _, label := range labels {
+		if !isValidHostNameLabel(label) {
+			return fmt.Errorf("name server host name %q contains invalid label %q", ns.HostName, label)
+		}
+	}
+
+	seen := make(map[netip.Addr]bool)
+	for _, addr := range ns.Addresses {
+		if !addr.IsValid() || addr.IsUnspecified() {
+			return fmt.Errorf("name server %q has an invalid glue address", ns.HostName)
+		}
+		if len(addr.Zone()) > 0 {
+			return fmt.Errorf("glue address %s of name server %q must not have a zone", addr, ns.HostName)
+		}
+		if addr.Is4In6() {
+			return fmt.Errorf("glue address %s of name server %q must be plain IPv4", addr, ns.HostName)
+		}
+		if seen[addr] {
+			return fmt.Errorf("duplicate glue address %s for name server %q", addr, ns.HostName)
+		}
+		seen[addr] = true
+	}
+	return nil
+}
+
+// isValidHostNameLabel returns whether the label consists of 1 to 63 letters, digits and inner hyphens.
+func isValidHostNameLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNameServer parses a name server in RRI nserver syntax like "ns1.denic.de. 81.91.170.1 2001:608:6::5".
+func ParseNameServer(str string) (NameServer, error) {
+	parts := strings.Fields(str)
+	if len(parts) == 0 {
+		return NameServer{}, fmt.Errorf("name server is empty")
+	}
+
+	ns := NameServer{HostName: parts[0]}
+	for _, part := range parts[1:] {
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return NameServer{}, fmt.Errorf("invalid glue address %q", part)
+		}
+		ns.Addresses = append(ns.Addresses, addr)
+	}
+	return ns, nil
+}
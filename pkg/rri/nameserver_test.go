@@ -0,0 +1,67 @@
+package rri
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameServerEncode(t *testing.T) {
+	assert.Equal(t, "ns1.denic.de", NewNameServer("ns1.denic.de").String())
+	assert.Equal(t, "ns1.denic.de. 81.91.170.1 2001:608:6::5", NewNameServer("ns1.denic.de.", netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("2001:608:6::5")).String())
+	assert.Equal(t, "ns1.xn--dnic-5qa.de 81.91.170.1", NewNameServer("ns1.dönic.de", netip.MustParseAddr("81.91.170.1")).String())
+
+	ns := NewNameServer("ns1.xn--dnic-5qa.de")
+	assert.Equal(t, "ns1.xn--dnic-5qa.de", ns.HostNameACE())
+	assert.Equal(t, "ns1.dönic.de", ns.HostNameIDN())
+}
+
+func TestParseNameServer(t *testing.T) {
+	ns, err := ParseNameServer("ns1.denic.de.  81.91.170.1\t2001:608:6::5")
+	require.NoError(t, err)
+	assert.Equal(t, NewNameServer("ns1.denic.de.", netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("2001:608:6::5")), ns)
+
+	ns, err = ParseNameServer("ns1.denic.de")
+	require.NoError(t, err)
+	assert.Equal(t, NewNameServer("ns1.denic.de"), ns)
+
+	_, err = ParseNameServer("  ")
+	assert.Error(t, err)
+	_, err = ParseNameServer("ns1.denic.de 81.91.170")
+	assert.Error(t, err)
+}
+
+func TestNameServerRoundTrip(t *testing.T) {
+	domainData := DomainData{NameServers: []NameServer{
+		NewNameServer("ns1.dönic.de", netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("2001:608:6::5")),
+		NewNameServer("ns2.denic.de"),
+	}}
+	query := NewUpdateDomainQuery("dönic.de", domainData)
+
+	for i, str := range query.Field(QueryFieldNameNameServer) {
+		ns, err := ParseNameServer(str)
+		require.NoError(t, err)
+		assert.Equal(t, domainData.NameServers[i].HostNameACE(), ns.HostName)
+		assert.Equal(t, domainData.NameServers[i].Addresses, ns.Addresses)
+		assert.NoError(t, ns.Validate())
+	}
+}
+
+func TestNameServerValidate(t *testing.T) {
+	assert.NoError(t, NewNameServer("ns1.denic.de").Validate())
+	assert.NoError(t, NewNameServer("ns1.denic.de.").Validate())
+	assert.NoError(t, NewNameServer("ns1.dönic.de", netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("2001:608:6::5")).Validate())
+
+	assert.Error(t, NewNameServer("").Validate())
+	assert.Error(t, NewNameServer("localhost").Validate())
+	assert.Error(t, NewNameServer("ns_1.denic.de").Validate())
+	assert.Error(t, NewNameServer("-ns1.denic.de").Validate())
+	assert.Error(t, NewNameServer("ns1..denic.de").Validate())
+	assert.Error(t, NewNameServer("ns1.denic.de", netip.Addr{}).Validate())
+	assert.Error(t, NewNameServer("ns1.denic.de", netip.MustParseAddr("0.0.0.0")).Validate())
+	assert.Error(t, NewNameServer("ns1.denic.de", netip.MustParseAddr("fe80::1%eth0")).Validate())
+	assert.Error(t, NewNameServer("ns1.denic.de", netip.MustParseAddr("::ffff:81.91.170.1")).Validate())
+	assert.Error(t, NewNameServer("ns1.denic.de", netip.MustParseAddr("81.91.170.1"), netip.MustParseAddr("81.91.170.1")).Validate())
+}
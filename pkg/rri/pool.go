@@ -0,0 +1,313 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// QuerySender is implemented by Client and Pool to send queries to a RRI server.
+type QuerySender interface {
+	// SendQuery sends a query to the server and returns the response.
+	SendQuery(query *Query) (*Response, error)
+	// SendQueryContext sends a query to the server and returns the response. The query is aborted when the context is done.
+	SendQueryContext(ctx context.Context, query *Query) (*Response, error)
+}
+
+// PoolHealthCheck is called for sessions that have been idle for a while before they are handed out again.
+// Return an error to discard the session and use a new one instead.
+type PoolHealthCheck func(ctx context.Context, client *Client) error
+
+// DefaultPoolHealthCheck sends a CHECK query for denic.de as cheap round trip. Sessions that are no longer logged in,
+// whose connection cannot be restored or that receive an error response are reported as unhealthy.
+func DefaultPoolHealthCheck(ctx context.Context, client *Client) error {
+	if !client.IsLoggedIn() {
+		return fmt.Errorf("session is not logged in")
+	}
+	response, err := client.SendQueryContext(ctx, NewCheckDomainQuery("denic.de"))
+	if err != nil {
+		return err
+	}
+	return response.Err()
+}
+
+// PoolConfig can be used to further configure the RRI session pool.
+type PoolConfig struct {
+	// ClientConfig is used for all clients of the pool.
+	ClientConfig *ClientConfig
+	// Size denotes the maximum number of concurrent sessions. Defaults to 4.
+	Size int
+	// MaxIdleTime denotes the time after which idle sessions are logged out and discarded. Defaults to 5 minutes.
+	// There is no background reaper, expired sessions are discarded when a session is acquired or the pool is closed.
+	MaxIdleTime time.Duration
+	// HealthCheckInterval denotes the idle time after which HealthCheck is called before a session is used again. Defaults to 30 seconds.
+	HealthCheckInterval time.Duration
+	// HealthCheck is used to check sessions after HealthCheckInterval. Defaults to DefaultPoolHealthCheck.
+	HealthCheck PoolHealthCheck
+	// LogoutTimeout denotes how long to wait for the LOGOUT of sessions discarded by the pool. Defaults to 1 second.
+	LogoutTimeout time.Duration
+}
+
+// Pool keeps multiple authenticated sessions to the same RRI server and distributes queries among them.
+//
+// A Pool is safe for concurrent use and can be used in place of a single Client to send queries in parallel.
+type Pool struct {
+	address             string
+	user, pass          string
+	clientConfig        *ClientConfig
+	maxIdleTime         time.Duration
+	healthCheckInterval time.Duration
+	healthCheck         PoolHealthCheck
+	logoutTimeout       time.Duration
+	// slots limits the number of sessions in use.
+	slots chan struct{}
+
+	m        sync.Mutex
+	idle     []*pooledClient
+	open     int
+	isClosed bool
+}
+
+type pooledClient struct {
+	client   *Client
+	lastUsed time.Time
+}
+
+// NewPool returns a new session pool for the given RRI server and credentials. A first session is established
+// immediately to verify the connection and credentials.
+func NewPool(address, user, pass string, conf *PoolConfig) (*Pool, error) {
+	return NewPoolContext(context.Background(), address, user, pass, conf)
+}
+
+// NewPoolContext returns a new session pool for the given RRI server and credentials. The context is only used to establish the first session.
+func NewPoolContext(ctx context.Context, address, user, pass string, conf *PoolConfig) (*Pool, error) {
+	var actualConf PoolConfig
+	if conf != nil {
+		// create copy of config to operate on
+		actualConf = *conf
+	}
+	if actualConf.Size <= 0 {
+		actualConf.Size = 4
+	}
+	if actualConf.MaxIdleTime <= 0 {
+		actualConf.MaxIdleTime = 5 * time.Minute
+	}
+	if actualConf.HealthCheckInterval <= 0 {
+		actualConf.HealthCheckInterval = 30 * time.Second
+	}
+	if actualConf.HealthCheck == nil {
+		actualConf.HealthCheck = DefaultPoolHealthCheck
+	}
+	if actualConf.LogoutTimeout <= 0 {
+		actualConf.LogoutTimeout = time.Second
+	}
+
+	pool := &Pool{
+		address:             address,
+		user:                user,
+		pass:                pass,
+		clientConfig:        actualConf.ClientConfig,
+		maxIdleTime:         actualConf.MaxIdleTime,
+		healthCheckInterval: actualConf.HealthCheckInterval,
+		healthCheck:         actualConf.HealthCheck,
+		logoutTimeout:       actualConf.LogoutTimeout,
+		slots:               make(chan struct{}, actualConf.Size),
+	}
+
+	client, err := pool.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pool.open = 1
+	pool.idle = append(pool.idle, &pooledClient{client, time.Now()})
+
+	return pool, nil
+}
+
+func (pool *Pool) newClient(ctx context.Context) (*Client, error) {
+	client, err := NewClientContext(ctx, pool.address, pool.clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.LoginContext(ctx, pool.user, pool.pass); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// RemoteAddress returns the RRI server address and port.
+func (pool *Pool) RemoteAddress() string {
+	return pool.address
+}
+
+// Size returns the maximum number of concurrent sessions.
+func (pool *Pool) Size() int {
+	return cap(pool.slots)
+}
+
+// OpenSessions returns the number of currently established sessions.
+func (pool *Pool) OpenSessions() int {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+	return pool.open
+}
+
+// IdleSessions returns the number of established sessions that are currently not in use.
+func (pool *Pool) IdleSessions() int {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+	return len(pool.idle)
+}
+
+// SendQuery sends a query using one of the pooled sessions and returns the response.
+//
+// Only technical errors are returned. You need to check Response.Result to check for RRI error responses.
+func (pool *Pool) SendQuery(query *Query) (*Response, error) {
+	return pool.SendQueryContext(context.Background(), query)
+}
+
+// SendQueryContext sends a query using one of the pooled sessions and returns the response. Waits for a free session
+// if all are in use. The query is aborted when the context is done.
+//
+// Only technical errors are returned. You need to check Response.Result to check for RRI error responses.
+func (pool *Pool) SendQueryContext(ctx context.Context, query *Query) (*Response, error) {
+	if query.Action() == ActionLogin || query.Action() == ActionLogout {
+		return nil, fmt.Errorf("sessions of a pool are managed automatically, cannot send action %s", query.Action())
+	}
+
+	pc, err := pool.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := pc.client.SendQueryContext(ctx, query)
+	// sessions with technical errors are discarded, the client already tried to restore the session
+	pool.release(pc, err == nil)
+	return response, err
+}
+
+// acquire blocks until a session slot is available and returns an idle or new session.
+func (pool *Pool) acquire(ctx context.Context) (*pooledClient, error) {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		pool.m.Lock()
+		if pool.isClosed {
+			pool.m.Unlock()
+			<-pool.slots
+			return nil, ErrPoolClosed
+		}
+		expired := pool.takeExpired()
+		// use the most recently used session first to let others expire
+		var pc *pooledClient
+		if len(pool.idle) > 0 {
+			pc = pool.idle[len(pool.idle)-1]
+			pool.idle = pool.idle[:len(pool.idle)-1]
+		} else {
+			pool.open++
+		}
+		pool.m.Unlock()
+
+		for _, expiredPC := range expired {
+			pool.discard(expiredPC)
+		}
+		if pc == nil {
+			break
+		}
+
+		if time.Since(pc.lastUsed) >= pool.healthCheckInterval {
+			if err := pool.healthCheck(ctx, pc.client); err != nil {
+				if ctx.Err() != nil {
+					// the health check has been aborted and does not tell anything about the session
+					pool.putIdle(pc)
+					<-pool.slots
+					return nil, ctx.Err()
+				}
+				pool.discard(pc)
+				continue
+			}
+		}
+		return pc, nil
+	}
+
+	// no idle session available, open a new one
+	client, err := pool.newClient(ctx)
+	if err != nil {
+		pool.m.Lock()
+		pool.open--
+		pool.m.Unlock()
+		<-pool.slots
+		return nil, err
+	}
+	return &pooledClient{client, time.Now()}, nil
+}
+
+// takeExpired removes and returns all idle sessions that exceeded the maximum idle time. pool.m must be held.
+func (pool *Pool) takeExpired() []*pooledClient {
+	// sessions are appended on release, so the least recently used ones come first
+	n := 0
+	for n < len(pool.idle) && time.Since(pool.idle[n].lastUsed) >= pool.maxIdleTime {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	expired := append([]*pooledClient(nil), pool.idle[:n]...)
+	pool.idle = append(pool.idle[:0], pool.idle[n:]...)
+	return expired
+}
+
+// putIdle returns a session to the idle list without changing its last usage or discards it if the pool is closed.
+func (pool *Pool) putIdle(pc *pooledClient) {
+	pool.m.Lock()
+	if !pool.isClosed {
+		pool.idle = append(pool.idle, pc)
+		pool.m.Unlock()
+		return
+	}
+	pool.m.Unlock()
+	pool.discard(pc)
+}
+
+// release returns a session to the pool or closes it if it is broken.
+func (pool *Pool) release(pc *pooledClient, reuse bool) {
+	defer func() { <-pool.slots }()
+
+	if reuse {
+		pc.lastUsed = time.Now()
+		pool.putIdle(pc)
+		return
+	}
+	pool.discard(pc)
+}
+
+// discard logs out and closes a session that is not in the idle list anymore. The LOGOUT is sent directly without
+// restoring the session, so it fails fast or times out after the logout timeout if the connection is broken.
+func (pool *Pool) discard(pc *pooledClient) {
+	pool.m.Lock()
+	pool.open--
+	pool.m.Unlock()
+
+	// ignore errors, the session is not used anymore
+	pc.client.close(true, pool.logoutTimeout)
+}
+
+// Close logs out and closes all idle sessions. Sessions currently in use are closed once their query is done.
+func (pool *Pool) Close() error {
+	pool.m.Lock()
+	pool.isClosed = true
+	idle := pool.idle
+	pool.idle = nil
+	pool.m.Unlock()
+
+	for _, pc := range idle {
+		pool.discard(pc)
+	}
+	return nil
+}
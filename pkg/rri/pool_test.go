@@ -0,0 +1,257 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		var m sync.Mutex
+		sessions := make(map[*Session]bool)
+		var active, maxActive int32
+		// the first queries wait until all sessions are in use
+		allActive := make(chan struct{})
+		var allActiveOnce sync.Once
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			m.Lock()
+			sessions[session] = true
+			m.Unlock()
+
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				max := atomic.LoadInt32(&maxActive)
+				if current <= max || atomic.CompareAndSwapInt32(&maxActive, max, current) {
+					break
+				}
+			}
+			if current == 3 {
+				allActiveOnce.Do(func() { close(allActive) })
+			}
+			<-allActive
+
+			fields := NewResponseFieldList()
+			fields.Add("Domain", query.FirstField(QueryFieldNameDomainIDN))
+			return NewResponse(ResultSuccess, fields), nil
+		}
+
+		_, err := NewPool(server.Address(), "DENIC-1000011-TEST", "wrong", &PoolConfig{ClientConfig: &ClientConfig{Insecure: true}})
+		assert.Error(t, err)
+
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{ClientConfig: &ClientConfig{Insecure: true}, Size: 3})
+		require.NoError(t, err)
+		defer pool.Close()
+		assert.Equal(t, 3, pool.Size())
+		assert.Equal(t, 1, pool.OpenSessions())
+
+		var sender QuerySender = pool
+		var wg sync.WaitGroup
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				domain := fmt.Sprintf("domain-%d.de", i)
+				response, err := sender.SendQuery(NewInfoDomainQuery(domain))
+				if assert.NoError(t, err) {
+					assert.Equal(t, domain, response.FirstField("Domain"))
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(3), atomic.LoadInt32(&maxActive))
+		m.Lock()
+		assert.Len(t, sessions, 3)
+		m.Unlock()
+		assert.Equal(t, 3, pool.OpenSessions())
+		assert.Equal(t, 3, pool.IdleSessions())
+
+		_, err = pool.SendQuery(NewLogoutQuery())
+		assert.Error(t, err)
+	})
+}
+
+func TestPoolReplaceBrokenSession(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			if query.FirstField(QueryFieldNameDomainIDN) == "broken.de" {
+				return nil, ErrCloseConnection
+			}
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{ClientConfig: &ClientConfig{Insecure: true}, Size: 2})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		_, err = pool.SendQuery(NewInfoDomainQuery("broken.de"))
+		assert.Error(t, err)
+		assert.Equal(t, 0, pool.OpenSessions())
+
+		response, err := pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.True(t, response.IsSuccessful())
+		assert.Equal(t, 1, pool.OpenSessions())
+	})
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		var checkedClients []*Client
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{
+			ClientConfig:        &ClientConfig{Insecure: true},
+			HealthCheckInterval: time.Nanosecond,
+			HealthCheck: func(ctx context.Context, client *Client) error {
+				checkedClients = append(checkedClients, client)
+				if len(checkedClients) == 1 {
+					return fmt.Errorf("unhealthy")
+				}
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		_, err = pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		require.Len(t, checkedClients, 1)
+		assert.Equal(t, 1, pool.OpenSessions())
+
+		_, err = pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		require.Len(t, checkedClients, 2)
+		assert.NotSame(t, checkedClients[0], checkedClients[1], "unhealthy session must be replaced")
+	})
+}
+
+func TestPoolDefaultHealthCheck(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		var unhealthy int32
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			if query.Action() == ActionCheck && atomic.LoadInt32(&unhealthy) != 0 {
+				return NewResponse(ResultFailure, nil), nil
+			}
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{
+			ClientConfig:        &ClientConfig{Insecure: true},
+			HealthCheckInterval: time.Nanosecond,
+		})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		_, err = pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.Equal(t, []QueryAction{ActionLogin, ActionCheck, ActionInfo}, queryActions(server.Queries()))
+
+		server.ResetQueries()
+		atomic.StoreInt32(&unhealthy, 1)
+		_, err = pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		// the session has been logged out and replaced after the failed CHECK
+		assert.Equal(t, []QueryAction{ActionCheck, ActionLogout, ActionLogin, ActionInfo}, queryActions(server.Queries()))
+		assert.Equal(t, 1, pool.OpenSessions())
+	})
+}
+
+func TestPoolExpiredSession(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{
+			ClientConfig: &ClientConfig{Insecure: true},
+			MaxIdleTime:  time.Nanosecond,
+		})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		_, err = pool.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		// the expired session has been logged out and replaced
+		assert.Equal(t, []QueryAction{ActionLogin, ActionLogout, ActionLogin, ActionInfo}, queryActions(server.Queries()))
+		assert.Equal(t, 1, pool.OpenSessions())
+	})
+}
+
+func TestPoolHealthCheckAborted(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{
+			ClientConfig:        &ClientConfig{Insecure: true},
+			HealthCheckInterval: time.Nanosecond,
+			HealthCheck: func(ctx context.Context, client *Client) error {
+				cancel()
+				return ctx.Err()
+			},
+		})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		_, err = pool.SendQueryContext(ctx, NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, context.Canceled)
+		// the session is kept, the health check did not tell anything about it
+		assert.Equal(t, 1, pool.OpenSessions())
+		assert.Equal(t, 1, pool.IdleSessions())
+		assert.Equal(t, []QueryAction{ActionLogin}, queryActions(server.Queries()))
+	})
+}
+
+func queryActions(queries []*Query) []QueryAction {
+	actions := make([]QueryAction, len(queries))
+	for i, query := range queries {
+		actions[i] = query.Action()
+	}
+	return actions
+}
+
+func TestPoolContext(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		entered := make(chan struct{}, 1)
+		release := make(chan struct{})
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			entered <- struct{}{}
+			<-release
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		pool, err := NewPool(server.Address(), "DENIC-1000011-TEST", "secret", &PoolConfig{ClientConfig: &ClientConfig{Insecure: true}, Size: 1})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		blockingQueryDone := make(chan struct{})
+		go func() {
+			defer close(blockingQueryDone)
+			_, err := pool.SendQuery(NewInfoDomainQuery("denic.de"))
+			assert.NoError(t, err)
+		}()
+		<-entered
+
+		// the only session is in use, waiting for it must respect the context
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = pool.SendQueryContext(ctx, NewInfoDomainQuery("denic.de"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+		<-blockingQueryDone
+		assert.Equal(t, 1, pool.IdleSessions())
+	})
+}
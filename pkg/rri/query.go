@@ -40,6 +40,8 @@ const (
 	QueryFieldNameAbuseContact QueryFieldName = "abusecontact"
 	// QueryFieldNameNameServer denotes the query field name for name servers.
 	QueryFieldNameNameServer QueryFieldName = "nserver"
+	// QueryFieldNameDNSKey denotes the query field name for DNSKEY records.
+	QueryFieldNameDNSKey QueryFieldName = "dnskey"
 	// QueryFieldNameHandle denotes the query field name for denic handles.
 	QueryFieldNameHandle QueryFieldName = "handle"
 	// QueryFieldNameDisconnect denotes the query field name for disconnect.
@@ -150,7 +152,7 @@ func (q QueryFieldName) Normalize() QueryFieldName {
 	return QueryFieldName(strings.ToLower(string(q)))
 }
 
-// QueryFieldEntity represents an entity field of a query
+// QueryFieldEntity represents the name of a query entity.
 type QueryFieldEntity string
 
 func (q QueryFieldEntity) String() string {
@@ -180,6 +182,8 @@ func ParseContactType(str string) (ContactType, error) {
 		return ContactTypePerson, nil
 	case "ORG":
 		return ContactTypeOrganisation, nil
+	case "REQUEST":
+		return ContactTypeRequest, nil
 	default:
 		return "", fmt.Errorf("invalid contact type")
 	}
@@ -241,7 +245,8 @@ type DomainData struct {
 	HolderHandles         []DenicHandle
 	GeneralRequestHandles []DenicHandle
 	AbuseContactHandles   []DenicHandle
-	NameServers           []string
+	NameServers           []NameServer
+	DNSKeys               []DNSKey
 }
 
 func (domainData *DomainData) PutToQueryFields(fields *QueryFieldList) {
@@ -256,7 +261,12 @@ func (domainData *DomainData) PutToQueryFields(fields *QueryFieldList) {
 	putHandlesToQueryFields(QueryFieldNameHolder, domainData.HolderHandles)
 	putHandlesToQueryFields(QueryFieldNameGeneralRequest, domainData.GeneralRequestHandles)
 	putHandlesToQueryFields(QueryFieldNameAbuseContact, domainData.AbuseContactHandles)
-	fields.Add(QueryFieldNameNameServer, domainData.NameServers...)
+	for _, ns := range domainData.NameServers {
+		fields.Add(QueryFieldNameNameServer, ns.String())
+	}
+	for _, key := range domainData.DNSKeys {
+		fields.Add(QueryFieldNameDNSKey, key.String())
+	}
 }
 
 // ContactData holds information of a contact handle.
@@ -274,6 +284,8 @@ type ContactData struct {
 	VerificationInformation []VerificationInformation
 }
 
+// PutToQueryFields appends the contact fields to the main section of a query. The verification information is not
+// included, add QueryEntities to the query with Query.WithEntities.
 func (contactData *ContactData) PutToQueryFields(fields *QueryFieldList) {
 	fields.Add(QueryFieldNameType, string(contactData.Type.Normalize()))
 	fields.Add(QueryFieldNameName, contactData.Name)
@@ -284,19 +296,60 @@ func (contactData *ContactData) PutToQueryFields(fields *QueryFieldList) {
 	fields.Add(QueryFieldNameCountryCode, contactData.CountryCode)
 	fields.Add(QueryFieldNameEMail, contactData.EMail...)
 	fields.Add(QueryFieldNamePhone, contactData.Phone)
+}
 
-	for _, verificationInfo := range contactData.VerificationInformation {
-		verificationInfo.PutToQueryFields(fields)
+// QueryEntities returns one entity per verification information. They are not included by PutToQueryFields.
+func (contactData *ContactData) QueryEntities() []QueryEntity {
+	entities := make([]QueryEntity, len(contactData.VerificationInformation))
+	for i := range contactData.VerificationInformation {
+		entities[i] = contactData.VerificationInformation[i].QueryEntity()
 	}
+	return entities
 }
 
 func splitLines(str string) []string {
 	return strings.Split(strings.ReplaceAll(strings.ReplaceAll(str, "\r\n", "\n"), "\r", "\n"), "\n")
 }
 
+// QueryEntity represents a section of a query that groups related fields, like VerificationInformation.
+type QueryEntity struct {
+	name   QueryFieldEntity
+	fields QueryFieldList
+}
+
+// NewQueryEntity returns a new QueryEntity with a copy of the given fields.
+func NewQueryEntity(name QueryFieldEntity, fields QueryFieldList) QueryEntity {
+	newFields := NewQueryFieldList()
+	if fields != nil {
+		fields.CopyTo(&newFields)
+	}
+	return QueryEntity{name, newFields}
+}
+
+// Name returns the name of this query entity.
+func (e *QueryEntity) Name() QueryFieldEntity {
+	return e.name
+}
+
+// Fields returns all fields of this query entity.
+func (e *QueryEntity) Fields() QueryFieldList {
+	return e.fields
+}
+
+// Field returns all values defined for a field name.
+func (e *QueryEntity) Field(fieldName QueryFieldName) []string {
+	return e.fields.Values(fieldName)
+}
+
+// FirstField returns the first field value or an empty string for a field name.
+func (e *QueryEntity) FirstField(fieldName QueryFieldName) string {
+	return e.fields.FirstValue(fieldName)
+}
+
 // Query represents a RRI request.
 type Query struct {
-	fields QueryFieldList
+	fields   QueryFieldList
+	entities []QueryEntity
 }
 
 // Version returns the query version.
@@ -319,29 +372,51 @@ func (q *Query) String() string {
 	return fmt.Sprintf("%s{%s}", q.Action(), sb.String())
 }
 
-// EncodeKV returns the Key-Value representation as used for RRI communication.
+// EncodeKV returns the Key-Value representation as used for RRI communication. Entities are appended as sections
+// starting with the entity name in square brackets.
 func (q *Query) EncodeKV() string {
 	var sb strings.Builder
-	for _, f := range q.fields {
+	writeLine := func(line string) {
 		if sb.Len() > 0 {
 			sb.WriteString("\n")
 		}
+		sb.WriteString(line)
+	}
 
-		if f.Name != QueryFieldNameEntity {
-			sb.WriteString(string(f.Name))
-			sb.WriteString(": ")
+	for _, f := range q.fields {
+		writeLine(fmt.Sprintf("%s: %s", f.Name, f.Value))
+	}
+	for _, e := range q.entities {
+		writeLine(e.name.String())
+		for _, f := range e.fields {
+			writeLine(fmt.Sprintf("%s: %s", f.Name, f.Value))
 		}
-
-		sb.WriteString(f.Value)
 	}
 	return sb.String()
 }
 
-// Fields returns all additional response fields.
+// Fields returns all fields of the query, excluding the fields of entities.
 func (q *Query) Fields() QueryFieldList {
 	return q.fields
 }
 
+// Entities returns a list of entities contained in this query.
+func (q *Query) Entities() []QueryEntity {
+	return q.entities
+}
+
+// WithEntity appends an entity with a copy of the given fields and returns the query to allow chaining.
+func (q *Query) WithEntity(name QueryFieldEntity, fields QueryFieldList) *Query {
+	q.entities = append(q.entities, NewQueryEntity(name, fields))
+	return q
+}
+
+// WithEntities appends entities and returns the query to allow chaining.
+func (q *Query) WithEntities(entities ...QueryEntity) *Query {
+	q.entities = append(q.entities, entities...)
+	return q
+}
+
 // Field returns all values defined for a field name.
 func (q *Query) Field(fieldName QueryFieldName) []string {
 	return q.fields.Values(fieldName)
@@ -352,7 +427,8 @@ func (q *Query) FirstField(fieldName QueryFieldName) string {
 	return q.fields.FirstValue(fieldName)
 }
 
-// NewQuery returns a query with the given parameters.
+// NewQuery returns a query with the given parameters. For compatibility, fields following a field named
+// QueryFieldNameEntity are moved to an entity named by its value. Use Query.WithEntity to add entities instead.
 func NewQuery(version Version, action QueryAction, fields QueryFieldList) *Query {
 	newFields := NewQueryFieldList()
 	newFields.Add(QueryFieldNameVersion, string(version.Normalize()))
@@ -360,7 +436,28 @@ func NewQuery(version Version, action QueryAction, fields QueryFieldList) *Query
 	if fields != nil {
 		fields.CopyTo(&newFields)
 	}
-	return &Query{newFields}
+	newFields, entities := splitQueryEntities(newFields)
+	return &Query{newFields, entities}
+}
+
+// splitQueryEntities moves all fields following a field named QueryFieldNameEntity to an entity named by its value,
+// like "[VerificationInformation]".
+func splitQueryEntities(fields QueryFieldList) (QueryFieldList, []QueryEntity) {
+	mainFields := NewQueryFieldList()
+	var entities []QueryEntity
+	for _, f := range fields {
+		if f.Name == QueryFieldNameEntity {
+			name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(f.Value), "["), "]")
+			entities = append(entities, QueryEntity{QueryFieldEntity(name), NewQueryFieldList()})
+			continue
+		}
+		if len(entities) > 0 {
+			entities[len(entities)-1].fields.Add(f.Name, f.Value)
+		} else {
+			mainFields.Add(f.Name, f.Value)
+		}
+	}
+	return mainFields, entities
 }
 
 // NewLoginQuery returns a login query for the given credentials.
@@ -381,7 +478,7 @@ func NewCreateContactQuery(handle DenicHandle, contactData ContactData) *Query {
 	fields := NewQueryFieldList()
 	fields.Add(QueryFieldNameHandle, handle.String())
 	contactData.PutToQueryFields(&fields)
-	return NewQuery(LatestVersion, ActionCreate, fields)
+	return NewQuery(LatestVersion, ActionCreate, fields).WithEntities(contactData.QueryEntities()...)
 }
 
 // NewCheckHandleQuery returns a check query for a contact or request contact handle.
@@ -533,6 +630,7 @@ func NewQueueDeleteQuery(msgID, msgType string) *Query {
 func ParseQueryKV(str string) (*Query, error) {
 	lines := strings.Split(str, "\n")
 	fields := NewQueryFieldList()
+	var entities []QueryEntity
 	for _, line := range lines {
 		// trim spaces and ignore empty lines
 		line = strings.TrimSpace(line)
@@ -540,6 +638,12 @@ func ParseQueryKV(str string) (*Query, error) {
 			continue
 		}
 
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			// begin of new entity
+			entities = append(entities, QueryEntity{QueryFieldEntity(line[1 : len(line)-1]), NewQueryFieldList()})
+			continue
+		}
+
 		parts := strings.SplitN(line, ":", 2)
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("query line must be key-value separated by ':'")
@@ -548,30 +652,45 @@ func ParseQueryKV(str string) (*Query, error) {
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 
-		fields.Add(QueryFieldName(key), value)
+		if len(entities) > 0 {
+			entities[len(entities)-1].fields.Add(QueryFieldName(key), value)
+		} else {
+			fields.Add(QueryFieldName(key), value)
+		}
+	}
+
+	if err := validateQueryFields(fields); err != nil {
+		return nil, err
 	}
 
+	return &Query{fields, entities}, nil
+}
+
+// validateQueryFields checks the mandatory fields of a parsed query.
+func validateQueryFields(fields QueryFieldList) error {
 	versionValues := fields.Values(QueryFieldNameVersion)
 	if len(versionValues) == 0 {
-		return nil, fmt.Errorf("%s key is missing", QueryFieldNameVersion)
+		return fmt.Errorf("%s key is missing", QueryFieldNameVersion)
 	}
 	if len(versionValues) > 1 {
-		return nil, fmt.Errorf("multiple %s values", QueryFieldNameVersion)
+		return fmt.Errorf("multiple %s values", QueryFieldNameVersion)
 	}
 
 	actionValues := fields.Values(QueryFieldNameAction)
 	if len(actionValues) == 0 {
-		return nil, fmt.Errorf("%s key is missing", QueryFieldNameAction)
+		return fmt.Errorf("%s key is missing", QueryFieldNameAction)
 	}
 	if len(actionValues) > 1 {
-		return nil, fmt.Errorf("multiple %s values", QueryFieldNameAction)
+		return fmt.Errorf("multiple %s values", QueryFieldNameAction)
 	}
 
-	return &Query{fields}, nil
+	return nil
 }
 
 // ParseQuery tries to detect the query format (KV or XML) and returns the parsed query.
 func ParseQuery(str string) (*Query, error) {
-	//TODO detect type
+	if IsXML(str) {
+		return ParseQueryXML(str)
+	}
 	return ParseQueryKV(str)
 }
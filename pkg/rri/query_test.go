@@ -29,6 +29,85 @@ func TestQueryEncodeKV(t *testing.T) {
 	assert.Equal(t, "version: 5.0\naction: update\naddress: foo\ndomain: denic.de\naddress: bar", query.EncodeKV())
 }
 
+func TestQueryEntities(t *testing.T) {
+	entityFields := NewQueryFieldList()
+	entityFields.Add(QueryFieldNameVerifiedClaim, "name")
+	query := NewCheckHandleQuery(NewDenicHandle(1000011, "SOME-DUDE")).
+		WithEntity(QueryEntityVerificationInformation, entityFields).
+		WithEntity("Empty", nil)
+	expected := "version: 5.0\naction: CHECK\nhandle: DENIC-1000011-SOME-DUDE\n[VerificationInformation]\nverifiedclaim: name\n[Empty]"
+	assert.Equal(t, expected, query.EncodeKV())
+	assert.Len(t, query.Fields(), 3)
+
+	// entity fields are copied
+	entityFields.Add(QueryFieldNameVerifiedClaim, "address")
+	assert.Len(t, query.Entities()[0].Fields(), 1)
+
+	parsed, err := ParseQuery(query.EncodeKV())
+	require.NoError(t, err)
+	assert.Equal(t, query.Fields(), parsed.Fields())
+	assert.Equal(t, query.Entities(), parsed.Entities())
+	assert.Equal(t, expected, parsed.EncodeKV())
+}
+
+func TestContactDataPutToQueryFields(t *testing.T) {
+	contactData := validContactData()
+	fields := NewQueryFieldList()
+	contactData.PutToQueryFields(&fields)
+	assert.Equal(t, []string{contactData.Name}, fields.Values(QueryFieldNameName))
+	assert.Empty(t, fields.Values(QueryFieldNameEntity))
+	assert.Empty(t, fields.Values(QueryFieldNameVerifiedClaim))
+
+	// fields appended afterwards stay in the main section
+	fields.Add(QueryFieldNameHandle, "DENIC-1000011-SOME-DUDE")
+	query := NewQuery(LatestVersion, ActionUpdate, fields).WithEntities(contactData.QueryEntities()...)
+	assert.Equal(t, []string{"DENIC-1000011-SOME-DUDE"}, query.Field(QueryFieldNameHandle))
+	assert.Equal(t, contactData.QueryEntities(), query.Entities())
+	for _, entity := range query.Entities() {
+		assert.Empty(t, entity.Field(QueryFieldNameHandle))
+	}
+	assert.Equal(t, NewCreateContactQuery(NewDenicHandle(1000011, "SOME-DUDE"), contactData).Entities(), query.Entities())
+}
+
+func TestQueryEntitiesLegacyFields(t *testing.T) {
+	vi := validContactData().VerificationInformation[0]
+	fields := NewQueryFieldList()
+	fields.Add(QueryFieldNameHandle, "DENIC-1000011-SOME-DUDE")
+	vi.PutToQueryFields(&fields)
+	query := NewQuery(LatestVersion, ActionUpdate, fields)
+	require.Len(t, query.Entities(), 1)
+	assert.Equal(t, vi.QueryEntity(), query.Entities()[0])
+	assert.Empty(t, query.Field(QueryFieldNameEntity))
+}
+
+func TestQueryExtractVerificationInformation(t *testing.T) {
+	contactData := validContactData()
+	second := contactData.VerificationInformation[0]
+	second.VerifiedClaim = []VerificationClaim{VerificationClaimEMail}
+	second.VerificationEvidence = ""
+	second.VerificationMethod = ""
+	second.TrustFramework = ""
+	contactData.VerificationInformation = append(contactData.VerificationInformation, second)
+
+	query := NewCreateContactQuery(NewDenicHandle(1000011, "SOME-DUDE"), contactData)
+	require.Len(t, query.Entities(), 2)
+	for _, msg := range []string{query.EncodeKV(), mustEncodeQueryXML(t, query)} {
+		parsed, err := ParseQuery(msg)
+		require.NoError(t, err)
+		verificationInformation, err := parsed.ExtractVerificationInformation()
+		require.NoError(t, err)
+		require.Len(t, verificationInformation, 2)
+		for i, vi := range verificationInformation {
+			vi.VerificationTimestamp = vi.VerificationTimestamp.UTC()
+			assert.Equal(t, contactData.VerificationInformation[i], *vi)
+		}
+	}
+
+	contactData.VerificationInformation[1].VerificationMethod = "telepathy"
+	_, err := NewCreateContactQuery(NewDenicHandle(1000011, "SOME-DUDE"), contactData).ExtractVerificationInformation()
+	assert.Error(t, err)
+}
+
 func TestNewLoginQuery(t *testing.T) {
 	query := NewLoginQuery("DENIC-1000011-TEST", "secret")
 	require.NotNil(t, query)
@@ -92,7 +171,7 @@ func TestNewCreateDomainQuery(t *testing.T) {
 		HolderHandles:         []DenicHandle{NewDenicHandle(1000011, "HOLDER-DUDE")},
 		GeneralRequestHandles: []DenicHandle{NewDenicHandle(1000011, "REQUEST-DUDE")},
 		AbuseContactHandles:   []DenicHandle{NewDenicHandle(1000011, "ABUSE-DUDE")},
-		NameServers:           []string{"ns1.denic.de", "ns2.denic.de"},
+		NameServers:           []NameServer{NewNameServer("ns1.denic.de"), NewNameServer("ns2.denic.de")},
 	})
 	require.NotNil(t, query)
 	assert.Equal(t, LatestVersion, query.Version())
@@ -113,7 +192,7 @@ func TestNewUpdateDomainQuery(t *testing.T) {
 		HolderHandles:         []DenicHandle{NewDenicHandle(1000011, "HOLDER-DUDE")},
 		GeneralRequestHandles: []DenicHandle{NewDenicHandle(1000011, "REQUEST-DUDE")},
 		AbuseContactHandles:   []DenicHandle{NewDenicHandle(1000011, "ABUSE-DUDE")},
-		NameServers:           []string{"ns1.denic.de", "ns2.denic.de"},
+		NameServers:           []NameServer{NewNameServer("ns1.denic.de"), NewNameServer("ns2.denic.de")},
 	})
 	require.NotNil(t, query)
 	assert.Equal(t, LatestVersion, query.Version())
@@ -134,7 +213,7 @@ func TestNewChangeHolderQuery(t *testing.T) {
 		HolderHandles:         []DenicHandle{NewDenicHandle(1000011, "HOLDER-DUDE")},
 		GeneralRequestHandles: []DenicHandle{NewDenicHandle(1000011, "REQUEST-DUDE")},
 		AbuseContactHandles:   []DenicHandle{NewDenicHandle(1000011, "ABUSE-DUDE")},
-		NameServers:           []string{"ns1.denic.de", "ns2.denic.de"},
+		NameServers:           []NameServer{NewNameServer("ns1.denic.de"), NewNameServer("ns2.denic.de")},
 	})
 	require.NotNil(t, query)
 	assert.Equal(t, LatestVersion, query.Version())
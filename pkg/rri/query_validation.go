@@ -0,0 +1,405 @@
+package rri
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	versionPattern      = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+	contactCodePattern  = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+	authInfoHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	// phonePattern matches E.164 numbers with an optional dot after the country code like +49.6927235.
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{0,2}\.?[0-9]+$`)
+)
+
+// queryFieldRule defines how often a field may occur in a query section and how its values are checked.
+type queryFieldRule struct {
+	name     QueryFieldName
+	required bool
+	multiple bool
+	check    func(value string) error
+}
+
+// queryRules defines the allowed fields and entities for a specific kind of query.
+type queryRules struct {
+	fields []queryFieldRule
+	// entities maps normalized entity names to the rules of their fields.
+	entities map[QueryFieldEntity][]queryFieldRule
+	// checks are called for the main section to check dependencies between fields.
+	checks []func(fields QueryFieldList) []QueryViolation
+}
+
+var (
+	baseQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameVersion, required: true, check: checkVersion},
+		{name: QueryFieldNameAction, required: true},
+	}
+	domainQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameDomainIDN, check: checkDomainName},
+		{name: QueryFieldNameDomainACE, check: checkDomainName},
+	}
+	domainDataQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameHolder, required: true, multiple: true, check: checkDenicHandle},
+		{name: QueryFieldNameGeneralRequest, required: true, multiple: true, check: checkDenicHandle},
+		{name: QueryFieldNameAbuseContact, required: true, multiple: true, check: checkDenicHandle},
+		{name: QueryFieldNameNameServer, multiple: true, check: checkNameServer},
+		{name: QueryFieldNameDNSKey, multiple: true, check: checkDNSKey},
+	}
+	handleQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameHandle, required: true, check: checkDenicHandle},
+	}
+	contactDataQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameType, required: true, check: checkContactType},
+		{name: QueryFieldNameName},
+		{name: QueryFieldNameOrganisation, multiple: true},
+		{name: QueryFieldNameAddress, multiple: true},
+		{name: QueryFieldNamePostalCode},
+		{name: QueryFieldNameCity},
+		{name: QueryFieldNameCountryCode, check: checkCountryCode},
+		{name: QueryFieldNameEMail, multiple: true, check: checkEMail},
+		{name: QueryFieldNamePhone, check: checkPhone},
+	}
+	verificationInformationQueryFieldRules = []queryFieldRule{
+		{name: QueryFieldNameVerifiedClaim, required: true, multiple: true, check: checkParsed(ParseVerificationClaim)},
+		{name: QueryFieldNameVerificationResult, required: true, check: checkParsed(ParseVerificationResult)},
+		{name: QueryFieldNameVerificationReference},
+		{name: QueryFieldNameVerificationTimestamp, required: true, check: checkVerificationTimestamp},
+		{name: QueryFieldNameVerificationEvidence, check: checkParsed(ParseVerificationEvidence)},
+		{name: QueryFieldNameVerificationMethod, check: checkParsed(ParseVerificationMethod)},
+		{name: QueryFieldNameTrustFramework, check: checkParsed(ParseTrustFramework)},
+	}
+)
+
+// Validate checks the query against the RRI specification before it is sent. It knows the required and allowed fields
+// for every QueryAction and checks the syntax of domains, handles, name servers, DNSKEYs, contact data and verification
+// information. Returns a *ValidationError holding all violations or nil if the query is valid.
+func (q *Query) Validate() error {
+	var violations []QueryViolation
+
+	rules, ok := rulesForQuery(q)
+	if !ok {
+		// only the mandatory fields can be checked for unknown actions
+		violations = append(violations, checkQueryFields("", q.fields, baseQueryFieldRules, false)...)
+		if action := q.Action(); len(action) > 0 {
+			violations = append(violations, QueryViolation{Field: QueryFieldNameAction, Msg: fmt.Sprintf("unknown action %s", action)})
+		}
+		return newValidationError(violations)
+	}
+
+	violations = append(violations, checkQueryFields("", q.fields, rules.fields, true)...)
+	for _, check := range rules.checks {
+		violations = append(violations, check(q.fields)...)
+	}
+
+	for _, entity := range q.entities {
+		entityRules, ok := rules.entities[entity.name.Normalize()]
+		if !ok {
+			violations = append(violations, QueryViolation{Entity: entity.name, Msg: fmt.Sprintf("entity is not allowed for action %s", q.Action())})
+			continue
+		}
+		violations = append(violations, checkQueryFields(entity.name, entity.fields, entityRules, true)...)
+	}
+
+	return newValidationError(violations)
+}
+
+func newValidationError(violations []QueryViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{violations}
+}
+
+// rulesForQuery returns the rules for the action of the query and whether the action is known.
+func rulesForQuery(q *Query) (queryRules, bool) {
+	isHandle := len(q.FirstField(QueryFieldNameHandle)) > 0
+
+	switch q.Action() {
+	case ActionLogin:
+		return newQueryRules([]queryFieldRule{
+			{name: QueryFieldNameUser, required: true},
+			{name: QueryFieldNamePassword, required: true},
+		}), true
+
+	case ActionLogout:
+		return newQueryRules(), true
+
+	case ActionCheck, ActionInfo:
+		if isHandle {
+			return newQueryRules(handleQueryFieldRules), true
+		}
+		return newDomainQueryRules(), true
+
+	case ActionCreate, ActionUpdate:
+		if isHandle {
+			rules := newQueryRules(handleQueryFieldRules, contactDataQueryFieldRules)
+			rules.entities = map[QueryFieldEntity][]queryFieldRule{
+				QueryEntityVerificationInformation.Normalize(): verificationInformationQueryFieldRules,
+			}
+			rules.checks = append(rules.checks, checkContactData)
+			return rules, true
+		}
+		return newDomainQueryRules(domainDataQueryFieldRules), true
+
+	case ActionChangeHolder:
+		return newDomainQueryRules(domainDataQueryFieldRules), true
+
+	case ActionChangeProvider:
+		return newDomainQueryRules(domainDataQueryFieldRules, []queryFieldRule{
+			{name: QueryFieldNameAuthInfo, required: true},
+		}), true
+
+	case ActionDelete, ActionRestore, ActionCreateAuthInfo2:
+		return newDomainQueryRules(), true
+
+	case ActionTransit:
+		return newDomainQueryRules([]queryFieldRule{
+			{name: QueryFieldNameDisconnect, required: true, check: checkBool},
+		}), true
+
+	case ActionCreateAuthInfo1:
+		return newDomainQueryRules([]queryFieldRule{
+			{name: QueryFieldNameAuthInfoHash, required: true, check: checkAuthInfoHash},
+			{name: QueryFieldNameAuthInfoExpire, required: true, check: checkAuthInfoExpire},
+		}), true
+
+	case ActionQueueRead:
+		return newQueryRules([]queryFieldRule{
+			{name: QueryFieldNameMsgType},
+		}), true
+
+	case ActionQueueDelete:
+		return newQueryRules([]queryFieldRule{
+			{name: QueryFieldNameMsgID, required: true},
+			{name: QueryFieldNameMsgType},
+		}), true
+
+	default:
+		return queryRules{}, false
+	}
+}
+
+func newQueryRules(fieldRules ...[]queryFieldRule) queryRules {
+	rules := queryRules{fields: append([]queryFieldRule{}, baseQueryFieldRules...)}
+	for _, r := range fieldRules {
+		rules.fields = append(rules.fields, r...)
+	}
+	return rules
+}
+
+func newDomainQueryRules(fieldRules ...[]queryFieldRule) queryRules {
+	rules := newQueryRules(append([][]queryFieldRule{domainQueryFieldRules}, fieldRules...)...)
+	rules.checks = append(rules.checks, checkDomainFields)
+	return rules
+}
+
+// checkQueryFields checks the fields of a single section. Empty values are treated like absent fields, as they are
+// added for unset optional values. Unknown fields are only reported if strict is set.
+func checkQueryFields(entity QueryFieldEntity, fields QueryFieldList, rules []queryFieldRule, strict bool) []QueryViolation {
+	var violations []QueryViolation
+	for _, f := range fields {
+		if len(f.Value) == 0 {
+			continue
+		}
+		rule, ok := findQueryFieldRule(rules, f.Name)
+		if !ok {
+			if strict {
+				violations = append(violations, QueryViolation{entity, f.Name, "field is not allowed"})
+			}
+			continue
+		}
+		if rule.check != nil {
+			if err := rule.check(f.Value); err != nil {
+				violations = append(violations, QueryViolation{entity, f.Name, err.Error()})
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		count := countQueryFieldValues(fields, rule.name)
+		if rule.required && count == 0 {
+			violations = append(violations, QueryViolation{entity, rule.name, "field is required"})
+		}
+		if !rule.multiple && count > 1 {
+			violations = append(violations, QueryViolation{entity, rule.name, "field must not be specified multiple times"})
+		}
+	}
+	return violations
+}
+
+func findQueryFieldRule(rules []queryFieldRule, fieldName QueryFieldName) (queryFieldRule, bool) {
+	for _, rule := range rules {
+		if rule.name == fieldName {
+			return rule, true
+		}
+	}
+	return queryFieldRule{}, false
+}
+
+// countQueryFieldValues returns the number of non-empty values for the given field name.
+func countQueryFieldValues(fields QueryFieldList, fieldName QueryFieldName) int {
+	count := 0
+	for _, value := range fields.Values(fieldName) {
+		if len(value) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// checkDomainFields requires the IDN or ACE domain name and checks that both match if given.
+func checkDomainFields(fields QueryFieldList) []QueryViolation {
+	domain := fields.FirstValue(QueryFieldNameDomainIDN)
+	domainACE := fields.FirstValue(QueryFieldNameDomainACE)
+	if len(domain) == 0 && len(domainACE) == 0 {
+		return []QueryViolation{{Field: QueryFieldNameDomainIDN, Msg: "field is required"}}
+	}
+	if len(domain) > 0 && len(domainACE) > 0 {
+		ace, err := idna.Lookup.ToASCII(domain)
+		if err == nil && !strings.EqualFold(ace, domainACE) {
+			return []QueryViolation{{Field: QueryFieldNameDomainACE, Msg: fmt.Sprintf("does not match domain %q", domain)}}
+		}
+	}
+	return nil
+}
+
+// checkContactData requires the address data for persons and organisations and a contact option for request contacts.
+func checkContactData(fields QueryFieldList) []QueryViolation {
+	var violations []QueryViolation
+	if ContactType(fields.FirstValue(QueryFieldNameType)).Normalize() == ContactTypeRequest {
+		if countQueryFieldValues(fields, QueryFieldNameEMail) == 0 && countQueryFieldValues(fields, QueryFieldNamePhone) == 0 {
+			violations = append(violations, QueryViolation{Field: QueryFieldNameEMail, Msg: "email or phone is required for request contacts"})
+		}
+		return violations
+	}
+
+	for _, fieldName := range []QueryFieldName{QueryFieldNameName, QueryFieldNameAddress, QueryFieldNamePostalCode, QueryFieldNameCity, QueryFieldNameCountryCode} {
+		if countQueryFieldValues(fields, fieldName) == 0 {
+			violations = append(violations, QueryViolation{Field: fieldName, Msg: "field is required"})
+		}
+	}
+	return violations
+}
+
+func checkVersion(value string) error {
+	if !versionPattern.MatchString(value) {
+		return fmt.Errorf("invalid version %q", value)
+	}
+	return nil
+}
+
+// checkDomainName checks for a valid IDN or ACE second level domain below .de.
+func checkDomainName(value string) error {
+	ace, err := idna.Lookup.ToASCII(strings.TrimSuffix(value, "."))
+	if err != nil {
+		return fmt.Errorf("invalid domain %q: %s", value, err.Error())
+	}
+	labels := strings.Split(ace, ".")
+	if len(labels) != 2 || labels[1] != "de" {
+		return fmt.Errorf("domain %q must be a second level domain below .de", value)
+	}
+	if !isValidHostNameLabel(labels[0]) {
+		return fmt.Errorf("domain %q contains invalid label %q", value, labels[0])
+	}
+	return nil
+}
+
+func checkDenicHandle(value string) error {
+	handle, err := ParseDenicHandle(value)
+	if err != nil || handle.RegAccID <= 0 || !contactCodePattern.MatchString(handle.ContactCode) {
+		return fmt.Errorf("invalid handle %q", value)
+	}
+	return nil
+}
+
+func checkNameServer(value string) error {
+	ns, err := ParseNameServer(value)
+	if err != nil {
+		return err
+	}
+	return ns.Validate()
+}
+
+func checkDNSKey(value string) error {
+	key, err := ParseDNSKey(value)
+	if err != nil {
+		return err
+	}
+	return key.Validate()
+}
+
+func checkContactType(value string) error {
+	switch ContactType(value).Normalize() {
+	case ContactTypePerson, ContactTypeOrganisation, ContactTypeRequest:
+		return nil
+	default:
+		return fmt.Errorf("invalid contact type %q", value)
+	}
+}
+
+func checkCountryCode(value string) error {
+	if !isISOCountryCode(value) {
+		return fmt.Errorf("invalid ISO 3166-1 alpha-2 country code %q", value)
+	}
+	return nil
+}
+
+func checkEMail(value string) error {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		return fmt.Errorf("invalid email address %q", value)
+	}
+	return nil
+}
+
+// checkPhone checks for E.164 numbers with at most 15 digits.
+func checkPhone(value string) error {
+	if !phonePattern.MatchString(value) || len(strings.ReplaceAll(value, ".", "")) > 16 {
+		return fmt.Errorf("phone number %q must be in E.164 format like +49.6927235", value)
+	}
+	return nil
+}
+
+func checkVerificationTimestamp(value string) error {
+	if _, err := time.Parse(VerificationInformationTimestampFormat, value); err != nil {
+		return fmt.Errorf("invalid timestamp %q", value)
+	}
+	return nil
+}
+
+func checkBool(value string) error {
+	if value != "true" && value != "false" {
+		return fmt.Errorf("value must be true or false")
+	}
+	return nil
+}
+
+func checkAuthInfoHash(value string) error {
+	if !authInfoHashPattern.MatchString(value) {
+		return fmt.Errorf("value must be a hex encoded SHA-256 hash")
+	}
+	return nil
+}
+
+func checkAuthInfoExpire(value string) error {
+	if _, err := time.Parse("20060102", value); err != nil {
+		return fmt.Errorf("invalid date %q", value)
+	}
+	return nil
+}
+
+// checkParsed returns a check for the given enum parse function.
+func checkParsed[T any](parse func(string) (T, error)) func(string) error {
+	return func(value string) error {
+		if _, err := parse(value); err != nil {
+			return fmt.Errorf("%s %q", err.Error(), value)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,201 @@
+package rri
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validContactData() ContactData {
+	return ContactData{
+		Type:        ContactTypePerson,
+		Name:        "Dagobert Duck",
+		Address:     "Im Geldspeicher",
+		PostalCode:  "64542",
+		City:        "Entenhausen",
+		CountryCode: "DE",
+		EMail:       []string{"dagobert.duck@duck-industries.de"},
+		Phone:       "+49.6927235",
+		VerificationInformation: []VerificationInformation{{
+			VerifiedClaim:         []VerificationClaim{VerificationClaimName, VerificationClaimAddress},
+			VerificationResult:    VerificationResultSuccess,
+			VerificationTimestamp: time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC),
+			VerificationEvidence:  VerificationEvidenceIDCard,
+			VerificationMethod:    VerificationMethodEDoc,
+			TrustFramework:        TrustFrameworkDenic,
+		}},
+	}
+}
+
+func validDomainData() DomainData {
+	return DomainData{
+		HolderHandles:         []DenicHandle{NewDenicHandle(1000011, "HOLDER")},
+		GeneralRequestHandles: []DenicHandle{NewDenicHandle(1000011, "REQUEST")},
+		AbuseContactHandles:   []DenicHandle{NewDenicHandle(1000011, "ABUSE")},
+		NameServers:           []NameServer{NewNameServer("ns1.dönic.de", netip.MustParseAddr("81.91.170.1")), NewNameServer("ns2.denic.de")},
+		DNSKeys:               []DNSKey{{257, 3, 8, "AwEAAb1Xh6Y="}},
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	handle := NewDenicHandle(1000011, "SOME-DUDE")
+	queries := []*Query{
+		NewLoginQuery("DENIC-1000011-TEST", "secret"),
+		NewLogoutQuery(),
+		NewCheckDomainQuery("dönic.de"),
+		NewCheckDomainQuery("xn--dnic-5qa.de"),
+		NewInfoDomainQuery("denic.de"),
+		NewCheckHandleQuery(handle),
+		NewInfoHandleQuery(handle),
+		NewCreateContactQuery(handle, validContactData()),
+		NewCreateContactQuery(handle, ContactData{Type: ContactTypeRequest, EMail: []string{"request@denic.de"}}),
+		NewCreateDomainQuery("dönic.de", validDomainData()),
+		NewUpdateDomainQuery("denic.de", validDomainData()),
+		NewChangeHolderQuery("denic.de", validDomainData()),
+		NewChangeProviderQuery("denic.de", "secret", validDomainData()),
+		NewDeleteDomainQuery("denic.de"),
+		NewRestoreDomainQuery("denic.de"),
+		NewTransitDomainQuery("denic.de", true),
+		NewCreateAuthInfo1Query("denic.de", "secret", time.Now()),
+		NewCreateAuthInfo2Query("denic.de"),
+		NewQueueReadQuery(""),
+		NewQueueDeleteQuery("4711", string(QueueMessageTypeExpire)),
+	}
+
+	for _, query := range queries {
+		assert.NoError(t, query.Validate(), query.EncodeKV())
+	}
+}
+
+func TestQueryValidateViolations(t *testing.T) {
+	contactData := validContactData()
+	contactData.CountryCode = "XY"
+	contactData.EMail = []string{"dagobert", "Dagobert <dagobert@duck-industries.de>"}
+	contactData.Phone = "06927235"
+	contactData.VerificationInformation[0].VerificationResult = "maybe"
+	query := NewCreateContactQuery(NewDenicHandle(1000011, "SOME_DUDE"), contactData)
+	query.entities[0].fields.Add("foo", "bar")
+
+	err := query.Validate()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []QueryViolation{
+		{"", QueryFieldNameHandle, "invalid handle \"DENIC-1000011-SOME_DUDE\""},
+		{"", QueryFieldNameCountryCode, "invalid ISO 3166-1 alpha-2 country code \"XY\""},
+		{"", QueryFieldNameEMail, "invalid email address \"dagobert\""},
+		{"", QueryFieldNameEMail, "invalid email address \"Dagobert <dagobert@duck-industries.de>\""},
+		{"", QueryFieldNamePhone, "phone number \"06927235\" must be in E.164 format like +49.6927235"},
+		{"VerificationInformation", QueryFieldNameVerificationResult, "invalid verification result \"maybe\""},
+		{"VerificationInformation", "foo", "field is not allowed"},
+	}, validationErr.Violations)
+	assert.Contains(t, err.Error(), "[VerificationInformation] foo: field is not allowed")
+}
+
+func TestQueryValidateRequiredFields(t *testing.T) {
+	err := NewCreateDomainQuery("denic.de", DomainData{}).Validate()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []QueryViolation{
+		{"", QueryFieldNameHolder, "field is required"},
+		{"", QueryFieldNameGeneralRequest, "field is required"},
+		{"", QueryFieldNameAbuseContact, "field is required"},
+	}, validationErr.Violations)
+
+	err = NewCreateContactQuery(NewDenicHandle(1000011, "SOME-DUDE"), ContactData{Type: ContactTypeOrganisation}).Validate()
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Violations, 5)
+
+	err = NewQuery(LatestVersion, ActionQueueDelete, nil).Validate()
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []QueryViolation{{"", QueryFieldNameMsgID, "field is required"}}, validationErr.Violations)
+
+	err = NewQuery(LatestVersion, ActionDelete, nil).Validate()
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []QueryViolation{{"", QueryFieldNameDomainIDN, "field is required"}}, validationErr.Violations)
+
+	err = NewQuery("5", "FOO", nil).Validate()
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []QueryViolation{
+		{"", QueryFieldNameVersion, "invalid version \"5\""},
+		{"", QueryFieldNameAction, "unknown action FOO"},
+	}, validationErr.Violations)
+}
+
+func TestQueryValidateDomain(t *testing.T) {
+	for _, domain := range []string{"denic.de", "DENIC.de", "dönic.de", "xn--dnic-5qa.de", "1.de", "denic.de."} {
+		assert.NoError(t, NewCheckDomainQuery(domain).Validate(), domain)
+	}
+	for _, domain := range []string{"denic.com", "sub.denic.de", "de", "-denic.de", "de_nic.de", "xn--zz.de", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.de"} {
+		assert.Error(t, NewCheckDomainQuery(domain).Validate(), domain)
+	}
+
+	fields := NewQueryFieldList()
+	fields.Add(QueryFieldNameDomainIDN, "dönic.de")
+	fields.Add(QueryFieldNameDomainACE, "denic.de")
+	assert.Error(t, NewQuery(LatestVersion, ActionCheck, fields).Validate())
+}
+
+func TestQueryValidateDomainData(t *testing.T) {
+	domainData := validDomainData()
+	domainData.HolderHandles = append(domainData.HolderHandles, DenicHandle{RegAccID: -1, ContactCode: "X"})
+	domainData.NameServers = append(domainData.NameServers, NewNameServer("localhost"))
+	domainData.DNSKeys = append(domainData.DNSKeys, DNSKey{257, 3, 1, "AwEAAb1Xh6Y="})
+
+	err := NewUpdateDomainQuery("denic.de", domainData).Validate()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Violations, 3)
+	assert.Equal(t, QueryFieldNameHolder, validationErr.Violations[0].Field)
+	assert.Equal(t, QueryFieldNameNameServer, validationErr.Violations[1].Field)
+	assert.Equal(t, QueryFieldNameDNSKey, validationErr.Violations[2].Field)
+
+	query := NewDeleteDomainQuery("denic.de")
+	query.fields.Add(QueryFieldNameHolder, "DENIC-1000011-HOLDER")
+	assert.Error(t, query.Validate())
+}
+
+func TestQueryValidateContactFormats(t *testing.T) {
+	assert.True(t, isISOCountryCode("DE"))
+	assert.True(t, isISOCountryCode("at"))
+	assert.False(t, isISOCountryCode("EU"))
+	assert.Len(t, isoCountryCodes, 249)
+
+	assert.NoError(t, checkPhone("+49.6927235"))
+	assert.NoError(t, checkPhone("+496927235"))
+	assert.Error(t, checkPhone("+49 69 27235"))
+	assert.Error(t, checkPhone("+49.1234567890123456"))
+	assert.Error(t, checkPhone("+0.6927235"))
+
+	assert.NoError(t, checkEMail("info@denic.de"))
+	assert.Error(t, checkEMail("info@denic"))
+	assert.Error(t, checkEMail("info@@denic.de"))
+}
+
+func TestClientValidateQueries(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		queryCount := 0
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			queryCount++
+			return NewResponse(ResultSuccess, nil), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		client.ValidateQueries = true
+
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.com"))
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, 0, queryCount)
+
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, queryCount)
+	})
+}
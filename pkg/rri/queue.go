@@ -0,0 +1,192 @@
+package rri
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ResponseFieldNameMsgID denotes the response field name for the message id.
+	ResponseFieldNameMsgID ResponseFieldName = "msgid"
+	// ResponseFieldNameMsgType denotes the response field name for the message type.
+	ResponseFieldNameMsgType ResponseFieldName = "msgtype"
+	// ResponseFieldNameMsgTime denotes the response field name for the message timestamp.
+	ResponseFieldNameMsgTime ResponseFieldName = "msgtime"
+	// ResponseFieldNameExpire denotes the response field name for an expiration timestamp.
+	ResponseFieldNameExpire ResponseFieldName = "expire"
+
+	// ResponseEntityNameMsg denotes the entity name of a queue message.
+	ResponseEntityNameMsg ResponseEntityName = "msg"
+
+	// QueueMessageTypeChangeProvider denotes a message about a domain that has been transferred to another registrar.
+	QueueMessageTypeChangeProvider QueueMessageType = "chprovAuthInfo"
+	// QueueMessageTypeExpireWarning denotes a message about a domain that is going to expire.
+	QueueMessageTypeExpireWarning QueueMessageType = "expireWarning"
+	// QueueMessageTypeExpire denotes a message about an expired domain.
+	QueueMessageTypeExpire QueueMessageType = "expire"
+	// QueueMessageTypeAuthInfoExpire denotes a message about an expired AuthInfo1.
+	QueueMessageTypeAuthInfoExpire QueueMessageType = "authInfoExpire"
+	// QueueMessageTypeAuthInfo2Notify denotes a message about an AuthInfo2 that has been requested for a domain.
+	QueueMessageTypeAuthInfo2Notify QueueMessageType = "authInfo2Notify"
+	// QueueMessageTypeAuthInfo2Delete denotes a message about an AuthInfo2 that has been deleted.
+	QueueMessageTypeAuthInfo2Delete QueueMessageType = "authInfo2Delete"
+)
+
+// QueueMessageType represents the type of a registry message queue entry.
+type QueueMessageType string
+
+// Normalize returns the normalized representation of the given QueueMessageType for comparison.
+func (t QueueMessageType) Normalize() QueueMessageType {
+	return QueueMessageType(strings.ToLower(string(t)))
+}
+
+// QueuePayload is implemented by all typed queue message payloads.
+type QueuePayload interface {
+	// DomainName returns the domain the message refers to.
+	DomainName() string
+}
+
+// ChangeProviderPayload is the payload of a QueueMessageTypeChangeProvider message.
+type ChangeProviderPayload struct {
+	Domain string
+	// RegAccID denotes the registrar the domain has been transferred to.
+	RegAccID string
+}
+
+// DomainName returns the domain the message refers to.
+func (p ChangeProviderPayload) DomainName() string {
+	return p.Domain
+}
+
+// ExpirePayload is the payload of QueueMessageTypeExpireWarning and QueueMessageTypeExpire messages.
+type ExpirePayload struct {
+	Domain string
+	// Expire denotes the expiration timestamp and may be zero.
+	Expire time.Time
+}
+
+// DomainName returns the domain the message refers to.
+func (p ExpirePayload) DomainName() string {
+	return p.Domain
+}
+
+// AuthInfoPayload is the payload of AuthInfo related messages.
+type AuthInfoPayload struct {
+	Domain string
+	// Expire denotes the expiration timestamp of the AuthInfo and may be zero.
+	Expire time.Time
+}
+
+// DomainName returns the domain the message refers to.
+func (p AuthInfoPayload) DomainName() string {
+	return p.Domain
+}
+
+// GenericPayload is used for unknown message types.
+type GenericPayload struct {
+	Fields ResponseFieldList
+}
+
+// DomainName returns the domain the message refers to or an empty string.
+func (p GenericPayload) DomainName() string {
+	return p.Fields.FirstValue(ResponseFieldNameDomainIDN)
+}
+
+// QueueMessage represents an entry of the registry message queue.
+type QueueMessage struct {
+	ID        string
+	Type      QueueMessageType
+	Timestamp time.Time
+	Payload   QueuePayload
+	// Fields contains all raw fields of the message.
+	Fields ResponseFieldList
+}
+
+// QueueMessage returns the message of a successful QUEUE-READ response or nil if the queue is empty.
+func (r *Response) QueueMessage() (*QueueMessage, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	fields := r.Fields()
+	for _, entity := range r.Entities() {
+		if entity.Name().Normalize() == ResponseEntityNameMsg {
+			fields = entity.Fields()
+			break
+		}
+	}
+
+	msgID := fields.FirstValue(ResponseFieldNameMsgID)
+	if len(msgID) == 0 {
+		// empty queue
+		return nil, nil
+	}
+
+	msg := &QueueMessage{
+		ID:     msgID,
+		Type:   QueueMessageType(fields.FirstValue(ResponseFieldNameMsgType)),
+		Fields: fields,
+	}
+
+	if msgTime := fields.FirstValue(ResponseFieldNameMsgTime); len(msgTime) > 0 {
+		var err error
+		msg.Timestamp, err = time.Parse(time.RFC3339, msgTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message timestamp %q", msgTime)
+		}
+	}
+
+	// the payload is either contained in an entity named like the message type or in the message fields
+	payloadFields := fields
+	for _, entity := range r.Entities() {
+		if string(entity.Name().Normalize()) == string(msg.Type.Normalize()) {
+			payloadFields = entity.Fields()
+			break
+		}
+	}
+
+	var err error
+	msg.Payload, err = parseQueuePayload(msg.Type, payloadFields)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func parseQueuePayload(msgType QueueMessageType, fields ResponseFieldList) (QueuePayload, error) {
+	domain := fields.FirstValue(ResponseFieldNameDomainIDN)
+	parseExpire := func() (time.Time, error) {
+		expire := fields.FirstValue(ResponseFieldNameExpire)
+		if len(expire) == 0 {
+			return time.Time{}, nil
+		}
+		t, err := time.Parse(time.RFC3339, expire)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expire timestamp %q", expire)
+		}
+		return t, nil
+	}
+
+	switch msgType.Normalize() {
+	case QueueMessageTypeChangeProvider.Normalize():
+		return ChangeProviderPayload{domain, fields.FirstValue(ResponseFieldNameRegAccID)}, nil
+
+	case QueueMessageTypeExpireWarning.Normalize(), QueueMessageTypeExpire.Normalize():
+		expire, err := parseExpire()
+		if err != nil {
+			return nil, err
+		}
+		return ExpirePayload{domain, expire}, nil
+
+	case QueueMessageTypeAuthInfoExpire.Normalize(), QueueMessageTypeAuthInfo2Notify.Normalize(), QueueMessageTypeAuthInfo2Delete.Normalize():
+		expire, err := parseExpire()
+		if err != nil {
+			return nil, err
+		}
+		return AuthInfoPayload{domain, expire}, nil
+
+	default:
+		return GenericPayload{fields}, nil
+	}
+}
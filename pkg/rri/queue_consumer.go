@@ -0,0 +1,124 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QueueHandler is called for every message read by a QueueConsumer. The message is only deleted from the queue if
+// nil is returned, otherwise it is handled again later.
+type QueueHandler func(ctx context.Context, msg *QueueMessage) error
+
+// QueueConsumerConfig can be used to further configure the queue consumer.
+type QueueConsumerConfig struct {
+	// MsgType restricts the consumer to messages of the given type. All messages are processed if empty.
+	MsgType QueueMessageType
+	// MinBackoff denotes the delay before the queue is read again after it was empty or an error occurred. Defaults to 1 second.
+	MinBackoff time.Duration
+	// MaxBackoff denotes the maximum delay the backoff is doubled up to. Defaults to 1 minute.
+	MaxBackoff time.Duration
+	// ErrorPrinter is called for errors that are skipped by the consumer loop.
+	ErrorPrinter ErrorPrinter
+}
+
+// QueueConsumer reads messages from the registry message queue, passes them to a handler and deletes them afterwards.
+//
+// Messages are delivered at least once: If the handler fails or the message cannot be deleted, it is read and passed
+// to the handler again.
+type QueueConsumer struct {
+	sender       QuerySender
+	handler      QueueHandler
+	msgType      QueueMessageType
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	errorPrinter ErrorPrinter
+}
+
+// NewQueueConsumer returns a new queue consumer that uses sender to read and delete messages. The sender must be logged in.
+func NewQueueConsumer(sender QuerySender, handler QueueHandler, conf *QueueConsumerConfig) *QueueConsumer {
+	var actualConf QueueConsumerConfig
+	if conf != nil {
+		// create copy of config to operate on
+		actualConf = *conf
+	}
+	if actualConf.MinBackoff <= 0 {
+		actualConf.MinBackoff = time.Second
+	}
+	if actualConf.MaxBackoff < actualConf.MinBackoff {
+		actualConf.MaxBackoff = time.Minute
+		if actualConf.MaxBackoff < actualConf.MinBackoff {
+			actualConf.MaxBackoff = actualConf.MinBackoff
+		}
+	}
+
+	return &QueueConsumer{
+		sender:       sender,
+		handler:      handler,
+		msgType:      actualConf.MsgType,
+		minBackoff:   actualConf.MinBackoff,
+		maxBackoff:   actualConf.MaxBackoff,
+		errorPrinter: actualConf.ErrorPrinter,
+	}
+}
+
+// ProcessNext reads a single message, passes it to the handler and deletes it. Returns false if the queue is empty.
+func (consumer *QueueConsumer) ProcessNext(ctx context.Context) (bool, error) {
+	response, err := consumer.sender.SendQueryContext(ctx, NewQueueReadQuery(string(consumer.msgType)))
+	if err != nil {
+		return false, err
+	}
+	msg, err := response.QueueMessage()
+	if err != nil {
+		return false, err
+	}
+	if msg == nil {
+		return false, nil
+	}
+
+	if err := consumer.handler(ctx, msg); err != nil {
+		return true, fmt.Errorf("failed to handle message %s: %s", msg.ID, err.Error())
+	}
+
+	response, err = consumer.sender.SendQueryContext(ctx, NewQueueDeleteQuery(msg.ID, string(consumer.msgType)))
+	if err != nil {
+		return true, err
+	}
+	if err := response.Err(); err != nil {
+		return true, fmt.Errorf("failed to delete message %s: %w", msg.ID, err)
+	}
+	return true, nil
+}
+
+// Run processes messages until the context is done and returns the context error. Errors are passed to the
+// ErrorPrinter and processing continues after a backoff.
+func (consumer *QueueConsumer) Run(ctx context.Context) error {
+	backoff := consumer.minBackoff
+	for {
+		processed, err := consumer.ProcessNext(ctx)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil && consumer.errorPrinter != nil {
+			consumer.errorPrinter(err)
+		}
+
+		if processed && err == nil {
+			backoff = consumer.minBackoff
+			continue
+		}
+
+		// wait for new messages or recovery from errors
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > consumer.maxBackoff {
+			backoff = consumer.maxBackoff
+		}
+	}
+}
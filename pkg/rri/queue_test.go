@@ -0,0 +1,167 @@
+package rri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseQueueMessage(t *testing.T) {
+	response, err := ParseResponse("RESULT: success\nSTID: 8792891a-c366-11eb-bca6-bbfdc472082a\n\n[Msg]\nmsgid: 5c214b14-c919-11eb-a37b-0242ac130003\nmsgtype: expireWarning\nmsgtime: 2021-06-09T10:00:00+02:00\n\n[expireWarning]\nDomain: denic.de\nExpire: 2021-07-01T00:00:00+02:00\n")
+	require.NoError(t, err)
+
+	msg, err := response.QueueMessage()
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	assert.Equal(t, "5c214b14-c919-11eb-a37b-0242ac130003", msg.ID)
+	assert.Equal(t, QueueMessageTypeExpireWarning, msg.Type)
+	assert.True(t, time.Date(2021, time.June, 9, 8, 0, 0, 0, time.UTC).Equal(msg.Timestamp))
+	payload, ok := msg.Payload.(ExpirePayload)
+	require.True(t, ok)
+	assert.Equal(t, "denic.de", payload.DomainName())
+	assert.True(t, time.Date(2021, time.June, 30, 22, 0, 0, 0, time.UTC).Equal(payload.Expire))
+}
+
+func TestResponseQueueMessageFlat(t *testing.T) {
+	response, err := ParseResponse("RESULT: success\n\nmsgid: 1234\nmsgtype: chprovAuthInfo\nDomain: denic.de\nRegAccId: DENIC-1000006")
+	require.NoError(t, err)
+	msg, err := response.QueueMessage()
+	require.NoError(t, err)
+	assert.Equal(t, ChangeProviderPayload{"denic.de", "DENIC-1000006"}, msg.Payload)
+
+	response, err = ParseResponse("RESULT: success\n\nmsgid: 1234\nmsgtype: somethingNew\nDomain: denic.de")
+	require.NoError(t, err)
+	msg, err = response.QueueMessage()
+	require.NoError(t, err)
+	payload, ok := msg.Payload.(GenericPayload)
+	require.True(t, ok)
+	assert.Equal(t, "denic.de", payload.DomainName())
+
+	response, err = ParseResponse("RESULT: success\nINFO: 83000000 Queue is empty")
+	require.NoError(t, err)
+	msg, err = response.QueueMessage()
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	response, err = ParseResponse("RESULT: success\n\nmsgid: 1234\nmsgtype: authInfoExpire\nExpire: tomorrow")
+	require.NoError(t, err)
+	_, err = response.QueueMessage()
+	assert.Error(t, err)
+}
+
+// mockQueue is a QuerySender that answers QUEUE-READ and QUEUE-DELETE queries.
+type mockQueue struct {
+	m        sync.Mutex
+	messages []string
+	types    []string
+	reads    int
+	deletes  int
+}
+
+func (q *mockQueue) SendQuery(query *Query) (*Response, error) {
+	return q.SendQueryContext(context.Background(), query)
+}
+
+func (q *mockQueue) SendQueryContext(ctx context.Context, query *Query) (*Response, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	msgType := query.FirstField(QueryFieldNameMsgType)
+	index := -1
+	for i := range q.messages {
+		if len(msgType) == 0 || q.types[i] == msgType {
+			index = i
+			break
+		}
+	}
+
+	switch query.Action() {
+	case ActionQueueRead:
+		q.reads++
+		if index < 0 {
+			return NewResponse(ResultSuccess, nil), nil
+		}
+		fields := NewResponseFieldList()
+		fields.Add(ResponseFieldNameMsgID, q.messages[index])
+		fields.Add(ResponseFieldNameMsgType, q.types[index])
+		fields.Add(ResponseFieldNameDomainIDN, "denic.de")
+		return NewResponse(ResultSuccess, fields), nil
+
+	case ActionQueueDelete:
+		q.deletes++
+		if index < 0 || q.messages[index] != query.FirstField(QueryFieldNameMsgID) {
+			return NewResponseWithError(ResultFailure, nil, NewBusinessMessage(53000000, "Message not found")), nil
+		}
+		q.messages = append(q.messages[:index], q.messages[index+1:]...)
+		q.types = append(q.types[:index], q.types[index+1:]...)
+		return NewResponse(ResultSuccess, nil), nil
+
+	default:
+		return nil, fmt.Errorf("unexpected action %s", query.Action())
+	}
+}
+
+func TestQueueConsumer(t *testing.T) {
+	queue := &mockQueue{
+		messages: []string{"1", "2", "3", "4"},
+		types:    []string{"expireWarning", "chprovAuthInfo", "expireWarning", "expireWarning"},
+	}
+
+	var handled []string
+	failOnce := true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var errs []error
+	consumer := NewQueueConsumer(queue, func(ctx context.Context, msg *QueueMessage) error {
+		assert.Equal(t, QueueMessageTypeExpireWarning, msg.Type)
+		if msg.ID == "3" && failOnce {
+			failOnce = false
+			return fmt.Errorf("temporary failure")
+		}
+		handled = append(handled, msg.ID)
+		if len(handled) == 3 {
+			cancel()
+		}
+		return nil
+	}, &QueueConsumerConfig{
+		MsgType:    QueueMessageTypeExpireWarning,
+		MinBackoff: time.Millisecond,
+		ErrorPrinter: func(err error) {
+			errs = append(errs, err)
+		},
+	})
+
+	err := consumer.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	// failed messages are handled again
+	assert.Equal(t, []string{"1", "3", "4"}, handled)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "temporary failure")
+	assert.Equal(t, []string{"2"}, queue.messages)
+}
+
+func TestQueueConsumerBackoff(t *testing.T) {
+	queue := &mockQueue{}
+	consumer := NewQueueConsumer(queue, func(ctx context.Context, msg *QueueMessage) error {
+		return nil
+	}, &QueueConsumerConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	processed, err := consumer.ProcessNext(context.Background())
+	require.NoError(t, err)
+	assert.False(t, processed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, consumer.Run(ctx), context.DeadlineExceeded)
+	queue.m.Lock()
+	defer queue.m.Unlock()
+	// backoff of 10ms, 20ms, 20ms, ... limits the number of reads
+	assert.GreaterOrEqual(t, queue.reads, 3)
+	assert.Less(t, queue.reads, 10)
+	assert.Equal(t, 0, queue.deletes)
+}
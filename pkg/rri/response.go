@@ -84,6 +84,15 @@ type ResponseEntity struct {
 	fields ResponseFieldList
 }
 
+// NewResponseEntity returns a new ResponseEntity with a copy of the given fields.
+func NewResponseEntity(name ResponseEntityName, fields ResponseFieldList) ResponseEntity {
+	newFields := NewResponseFieldList()
+	if fields != nil {
+		fields.CopyTo(&newFields)
+	}
+	return ResponseEntity{name, newFields}
+}
+
 // Response represents an RRI response.
 type Response struct {
 	fields   ResponseFieldList
@@ -95,6 +104,14 @@ func (r *Response) IsSuccessful() bool {
 	return r.Result() == ResultSuccess
 }
 
+// Err returns a *BusinessError if the response is not successful and nil otherwise.
+func (r *Response) Err() error {
+	if r.IsSuccessful() {
+		return nil
+	}
+	return NewBusinessError(r)
+}
+
 // Result returns the returned result.
 func (r *Response) Result() Result {
 	return Result(r.FirstField(ResponseFieldNameResult)).Normalize()
@@ -144,19 +161,36 @@ func (r *Response) String() string {
 	return r.EncodeKV()
 }
 
-// EncodeKV returns the Key-Value representation as used for RRI communication.
+// EncodeKV returns the Key-Value representation as used for RRI communication. Entities are appended as sections
+// separated by empty lines.
 func (r *Response) EncodeKV() string {
 	var sb strings.Builder
-	for _, f := range r.fields {
+	encodeResponseFieldsKV(&sb, r.fields)
+	for _, e := range r.entities {
 		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString("[")
+		sb.WriteString(string(e.name))
+		sb.WriteString("]")
+		if len(e.fields) > 0 {
+			sb.WriteString("\n")
+			encodeResponseFieldsKV(&sb, e.fields)
+		}
+	}
+	return sb.String()
+}
+
+// encodeResponseFieldsKV writes the fields as key-value lines without trailing line break.
+func encodeResponseFieldsKV(sb *strings.Builder, fields ResponseFieldList) {
+	for i, f := range fields {
+		if i > 0 {
 			sb.WriteString("\n")
 		}
 		sb.WriteString(string(f.Name))
 		sb.WriteString(": ")
 		sb.WriteString(f.Value)
 	}
-	//TODO encode entities
-	return sb.String()
 }
 
 // Fields returns all additional response fields.
@@ -235,6 +269,24 @@ func NewResponseWithError(result Result, fields ResponseFieldList, errors ...Bus
 	return &Response{newFields, nil}
 }
 
+// WithField appends values for a field and returns the response to allow chaining.
+func (r *Response) WithField(fieldName ResponseFieldName, values ...string) *Response {
+	r.fields.Add(fieldName, values...)
+	return r
+}
+
+// WithEntity appends an entity with a copy of the given fields and returns the response to allow chaining.
+func (r *Response) WithEntity(name ResponseEntityName, fields ResponseFieldList) *Response {
+	r.entities = append(r.entities, NewResponseEntity(name, fields))
+	return r
+}
+
+// WithEntities appends entities and returns the response to allow chaining.
+func (r *Response) WithEntities(entities ...ResponseEntity) *Response {
+	r.entities = append(r.entities, entities...)
+	return r
+}
+
 // ParseResponseKV parses a response object from the given key-value response string.
 func ParseResponseKV(msg string) (*Response, error) {
 	lines := strings.Split(msg, "\n")
@@ -264,32 +316,41 @@ func ParseResponseKV(msg string) (*Response, error) {
 		}
 	}
 
+	if err := validateResponseFields(fields); err != nil {
+		return nil, err
+	}
+
+	return &Response{fields, entities}, nil
+}
+
+// validateResponseFields checks the mandatory fields and business messages of a parsed response.
+func validateResponseFields(fields ResponseFieldList) error {
 	resultValues := fields.Values(ResponseFieldNameResult)
 	if len(resultValues) == 0 {
-		return nil, fmt.Errorf("%s key is missing", ResponseFieldNameResult)
+		return fmt.Errorf("%s key is missing", ResponseFieldNameResult)
 	}
 	if len(resultValues) > 1 {
-		return nil, fmt.Errorf("multiple %s values", ResponseFieldNameResult)
+		return fmt.Errorf("multiple %s values", ResponseFieldNameResult)
 	}
 
 	stidValues := fields.Values(ResponseFieldNameSTID)
 	if len(stidValues) > 1 {
-		return nil, fmt.Errorf("multiple %s values", ResponseFieldNameSTID)
+		return fmt.Errorf("multiple %s values", ResponseFieldNameSTID)
 	}
 
 	for _, msg := range fields.Values(ResponseFieldNameInfo) {
 		if _, err := ParseBusinessMessageKV(msg); err != nil {
-			return nil, fmt.Errorf("invalid info message: %s", err.Error())
+			return fmt.Errorf("invalid info message: %s", err.Error())
 		}
 	}
 
 	for _, msg := range fields.Values(ResponseFieldNameError) {
 		if _, err := ParseBusinessMessageKV(msg); err != nil {
-			return nil, fmt.Errorf("invalid error message: %s", err.Error())
+			return fmt.Errorf("invalid error message: %s", err.Error())
 		}
 	}
 
-	return &Response{fields, entities}, nil
+	return nil
 }
 
 // ParseBusinessMessageKV parses a BusinessMessage from a single KV entry.
@@ -307,7 +368,9 @@ func ParseBusinessMessageKV(str string) (BusinessMessage, error) {
 
 // ParseResponse tries to detect the response format (KV or XML) and returns the parsed response.
 func ParseResponse(str string) (*Response, error) {
-	//TODO detect type
+	if IsXML(str) {
+		return ParseResponseXML(str)
+	}
 	return ParseResponseKV(str)
 }
 
@@ -13,6 +13,63 @@ func TestResponseEncodeKV(t *testing.T) {
 	assert.Equal(t, "RESULT: success\nINFO: 13000000011 foo\nSTID: 554c2cd7-0885-11eb-a619-610f86f60bcb\nINFO: 13000000011 bar", response.EncodeKV())
 }
 
+func TestResponseEncodeKVEntities(t *testing.T) {
+	holderFields := NewResponseFieldList()
+	holderFields.Add(ResponseFieldNameHandle, "DENIC-1000006-DENIC")
+	holderFields.Add(ResponseFieldNameName, "DENIC eG")
+	response := NewResponse(ResultSuccess, nil).
+		WithField(ResponseFieldNameDomainIDN, "denic.de").
+		WithEntity("Holder", holderFields).
+		WithEntity("Holder", nil)
+
+	assert.Equal(t, "RESULT: success\nDOMAIN: denic.de\n\n[Holder]\nHANDLE: DENIC-1000006-DENIC\nNAME: DENIC eG\n\n[Holder]", response.EncodeKV())
+
+	// entity fields are copied
+	holderFields.Add(ResponseFieldNameType, "ORG")
+	assert.Len(t, response.Entities()[0].Fields(), 2)
+}
+
+func TestResponseKVRoundTrip(t *testing.T) {
+	for _, msg := range []string{
+		"RESULT: success\nSTID: 10459b07-861a-11ea-b33a-d9ddb946cb7c\n\nDomain: dönic.de\nNserver: ns1.dönic.de. 81.91.170.1 2001:608:6::5\nNserver: ns2.denic.de.\nDnskey: 257 3 8 AwEAAb1 Xh6Y=\n\n[Holder]\nHandle: DENIC-1000006-DENIC\nType: ORG\nName: DENIC eG\n\n[Holder]\nHandle: DENIC-1000006-OTHER\n\n[GeneralRequest]\nHandle: DENIC-1000006-REQUEST\n\n[AbuseContact]\nHandle: DENIC-1000006-ABUSE\n",
+		"RESULT: success\nSTID: 8792891a-c366-11eb-bca6-bbfdc472082a\n\n[Msg]\nmsgid: 5c214b14-c919-11eb-a37b-0242ac130003\nmsgtype: expireWarning\nmsgtime: 2021-06-09T10:00:00+02:00\n\n[expireWarning]\nDomain: denic.de\nExpire: 2021-07-01T00:00:00+02:00\n",
+		"RESULT: success\n\nHandle: DENIC-1000006-DUDE\nType: PERSON\n\n[VerificationInformation]\nverifiedClaim: name\nverifiedClaim: address\nverificationResult: success\n\n[VerificationInformation]\nverifiedClaim: phone\n\n[Empty]",
+	} {
+		response, err := ParseResponseKV(msg)
+		require.NoError(t, err)
+		require.NotEmpty(t, response.Entities())
+
+		parsed, err := ParseResponseKV(response.EncodeKV())
+		require.NoError(t, err)
+		assert.Equal(t, response.Fields(), parsed.Fields())
+		assert.Equal(t, response.Entities(), parsed.Entities())
+	}
+}
+
+func TestResponseEntitiesOverKV(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			holderFields := NewResponseFieldList()
+			holderFields.Add(ResponseFieldNameHandle, "DENIC-1000011-HOLDER")
+			return NewResponse(ResultSuccess, nil).
+				WithField(ResponseFieldNameDomainIDN, query.FirstField(QueryFieldNameDomainIDN)).
+				WithEntity(ResponseEntityNameHolder, holderFields), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		response, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		require.Len(t, response.Entities(), 1)
+		assert.Equal(t, ResponseEntityNameHolder, response.Entities()[0].Name())
+		assert.Equal(t, "DENIC-1000011-HOLDER", response.Entities()[0].FirstField(ResponseFieldNameHandle))
+	})
+}
+
 func TestResponseInfoMessages(t *testing.T) {
 	response, err := ParseResponse("RESULT: success\nINFO: 13000000011 Request was processed in test environment - not valid in real world [testing platform]\nSTID: 554c2cd7-0885-11eb-a619-610f86f60bcb")
 	require.NoError(t, err)
@@ -0,0 +1,135 @@
+package rri
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryDecision is called after a failed attempt to decide whether the query is sent again. preSend denotes whether
+// the error provably occurred before the query has been sent completely, so it cannot have been processed by the server.
+type RetryDecision func(action QueryAction, err error, preSend bool) bool
+
+// RetryPolicy controls how queries are retried after technical errors. The connection and session are always
+// restored before a retry.
+type RetryPolicy struct {
+	// MaxAttempts denotes the maximum number of attempts including the first one. Defaults to 2.
+	MaxAttempts int
+	// InitialBackoff denotes the delay before the first retry. Defaults to 100 milliseconds, use a negative value to
+	// retry immediately.
+	InitialBackoff time.Duration
+	// MaxBackoff denotes the maximum delay between two attempts. Defaults to 5 seconds.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the delay after every retry. Defaults to 2.
+	Multiplier float64
+	// Jitter denotes the fraction of the delay that is randomly subtracted to spread retries of concurrent clients. Values are between 0 and 1, defaults to 0.2.
+	// Use a negative value to disable jitter.
+	Jitter float64
+	// ShouldRetry decides whether a failed query is retried. Uses DefaultRetryDecision if not set.
+	ShouldRetry RetryDecision
+}
+
+// DefaultRetryPolicy returns the retry policy that is used if none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		ShouldRetry:    DefaultRetryDecision,
+	}
+}
+
+// NoRetryPolicy returns a retry policy that never retries a query.
+func NoRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 1
+	return policy
+}
+
+// DefaultRetryDecision retries idempotent actions after any error. All other actions are only retried if the error
+// provably occurred before the query has been sent.
+func DefaultRetryDecision(action QueryAction, err error, preSend bool) bool {
+	return preSend || IsIdempotentAction(action)
+}
+
+// IsIdempotentAction returns whether the action can safely be sent multiple times without changing the result.
+func IsIdempotentAction(action QueryAction) bool {
+	switch action.Normalize() {
+	case ActionLogin, ActionCheck, ActionInfo, ActionQueueRead:
+		return true
+	default:
+		return false
+	}
+}
+
+// withDefaults returns a copy of the policy with defaults for all unset values.
+func (policy *RetryPolicy) withDefaults() RetryPolicy {
+	defaultPolicy := DefaultRetryPolicy()
+	if policy == nil {
+		return defaultPolicy
+	}
+
+	actualPolicy := *policy
+	if actualPolicy.MaxAttempts <= 0 {
+		actualPolicy.MaxAttempts = defaultPolicy.MaxAttempts
+	}
+	if actualPolicy.InitialBackoff == 0 {
+		actualPolicy.InitialBackoff = defaultPolicy.InitialBackoff
+	} else if actualPolicy.InitialBackoff < 0 {
+		actualPolicy.InitialBackoff = 0
+	}
+	if actualPolicy.MaxBackoff <= 0 {
+		actualPolicy.MaxBackoff = defaultPolicy.MaxBackoff
+	}
+	if actualPolicy.Multiplier < 1 {
+		actualPolicy.Multiplier = defaultPolicy.Multiplier
+	}
+	if actualPolicy.Jitter == 0 {
+		actualPolicy.Jitter = defaultPolicy.Jitter
+	} else if actualPolicy.Jitter < 0 {
+		actualPolicy.Jitter = 0
+	} else if actualPolicy.Jitter > 1 {
+		actualPolicy.Jitter = 1
+	}
+	if actualPolicy.ShouldRetry == nil {
+		actualPolicy.ShouldRetry = defaultPolicy.ShouldRetry
+	}
+	return actualPolicy
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts, not including jitter.
+func (policy RetryPolicy) Backoff(failedAttempts int) time.Duration {
+	backoff := float64(policy.InitialBackoff)
+	for i := 1; i < failedAttempts; i++ {
+		backoff *= policy.Multiplier
+		if backoff >= float64(policy.MaxBackoff) {
+			return policy.MaxBackoff
+		}
+	}
+	if backoff > float64(policy.MaxBackoff) {
+		return policy.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// wait blocks for the jittered backoff or until the context is done.
+func (policy RetryPolicy) wait(ctx context.Context, failedAttempts int) error {
+	backoff := policy.Backoff(failedAttempts)
+	if policy.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * policy.Jitter * float64(backoff))
+	}
+	if backoff <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package rri
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	var nilPolicy *RetryPolicy
+	policy := nilPolicy.withDefaults()
+	assert.Equal(t, 2, policy.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, policy.InitialBackoff)
+	assert.NotNil(t, policy.ShouldRetry)
+
+	assert.Equal(t, 0.2, policy.Jitter)
+
+	policy = (&RetryPolicy{MaxAttempts: 5, Multiplier: 0.5, Jitter: 3}).withDefaults()
+	assert.Equal(t, 5, policy.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, policy.InitialBackoff)
+	assert.Equal(t, 5*time.Second, policy.MaxBackoff)
+	assert.Equal(t, 2.0, policy.Multiplier)
+	assert.Equal(t, 1.0, policy.Jitter)
+
+	// negative values disable backoff and jitter
+	policy = (&RetryPolicy{InitialBackoff: -1, Jitter: -1}).withDefaults()
+	assert.Equal(t, time.Duration(0), policy.InitialBackoff)
+	assert.Equal(t, 0.0, policy.Jitter)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 300*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 900*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, time.Second, policy.Backoff(4))
+	assert.Equal(t, time.Second, policy.Backoff(100))
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2, Jitter: 0.5}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, policy.wait(ctx, 1), context.DeadlineExceeded)
+
+	policy = RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Second, Multiplier: 2, Jitter: 0.5}
+	assert.NoError(t, policy.wait(context.Background(), 1))
+}
+
+func TestDefaultRetryDecision(t *testing.T) {
+	err := fmt.Errorf("broken pipe")
+	for _, action := range []QueryAction{ActionLogin, ActionCheck, ActionInfo, ActionQueueRead} {
+		assert.True(t, IsIdempotentAction(action), action)
+		assert.True(t, DefaultRetryDecision(action, err, false), action)
+	}
+	for _, action := range []QueryAction{ActionCreate, ActionChangeProvider, ActionDelete, ActionUpdate, ActionQueueDelete} {
+		assert.False(t, IsIdempotentAction(action), action)
+		assert.False(t, DefaultRetryDecision(action, err, false), action)
+		assert.True(t, DefaultRetryDecision(action, err, true), action)
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		var queryCount int32
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			atomic.AddInt32(&queryCount, 1)
+			return nil, ErrCloseConnection
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{
+			Insecure:    true,
+			RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		// idempotent queries are retried up to MaxAttempts
+		_, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&queryCount))
+
+		// non-idempotent queries might have been processed and are not retried
+		atomic.StoreInt32(&queryCount, 0)
+		_, err = client.SendQuery(NewDeleteDomainQuery("denic.de"))
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&queryCount))
+	})
+}
+
+func TestClientRetryPolicyPreSend(t *testing.T) {
+	login := prepareMessage(NewLoginQuery("DENIC-1000011-RRI", "secret").EncodeKV())
+	create := prepareMessage(NewDeleteDomainQuery("denic.de").EncodeKV())
+	conn := newMockReadWriteCloser(t, []readResponse{
+		{[]byte{0, 0, 0, 15}, nil},
+		{[]byte("RESULT: success"), nil},
+		{[]byte{0, 0, 0, 15}, nil},
+		{[]byte("RESULT: success"), nil},
+		{[]byte{0, 0, 0, 15}, nil},
+		{[]byte("RESULT: success"), nil},
+	}, []writeResponse{
+		{login, nil},
+		{create, fmt.Errorf("broken pipe")},
+		{login, nil},
+		{create, nil},
+	})
+
+	var decisions []bool
+	client, err := NewClient("localhost", &ClientConfig{
+		TLSDialHandler: func(network, addr string, config *tls.Config) (TLSConnection, error) {
+			return conn, nil
+		},
+		RetryPolicy: &RetryPolicy{
+			ShouldRetry: func(action QueryAction, err error, preSend bool) bool {
+				assert.Equal(t, ActionDelete, action)
+				decisions = append(decisions, preSend)
+				return DefaultRetryDecision(action, err, preSend)
+			},
+		},
+	})
+	require.NoError(t, err)
+	// the mocked connection does not expect a LOGOUT
+	defer client.CloseNoLogout()
+
+	require.NoError(t, client.Login("DENIC-1000011-RRI", "secret"))
+	response, err := client.SendQuery(NewDeleteDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+	assert.Equal(t, []bool{true}, decisions)
+	conn.AssertComplete()
+}
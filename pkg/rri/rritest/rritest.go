@@ -0,0 +1,138 @@
+// Package rritest provides utilities for testing RRI clients against a mock server.
+package rritest
+
+import (
+	"testing"
+
+	"github.com/DENICeG/go-rriclient/pkg/rri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockServer wraps an rri.MockServer running on a random free port and offers assertions on received queries.
+type MockServer struct {
+	*rri.MockServer
+	tb testing.TB
+}
+
+// NewMockServer starts a new mock server on a random free port and waits until it accepts connections. The server is
+// closed when the test finishes.
+func NewMockServer(tb testing.TB) *MockServer {
+	tb.Helper()
+
+	mockServer, err := rri.NewMockServer(0)
+	require.NoError(tb, err, "failed to create mock server")
+
+	runError := make(chan error, 1)
+	go func() {
+		runError <- mockServer.Run()
+	}()
+	select {
+	case <-mockServer.Ready():
+	case err := <-runError:
+		mockServer.Close()
+		require.NoError(tb, err, "failed to start mock server")
+	}
+
+	tb.Cleanup(func() {
+		mockServer.Close()
+		assert.NoError(tb, <-runError, "mock server failed")
+	})
+
+	return &MockServer{MockServer: mockServer, tb: tb}
+}
+
+// NewClient returns a new client connected to the mock server that accepts its self-signed certificate. The client is
+// closed when the test finishes.
+func (server *MockServer) NewClient() *rri.Client {
+	server.tb.Helper()
+	return server.NewClientWithConfig(nil)
+}
+
+// NewClientWithConfig is like NewClient but allows to customize the client configuration. Insecure is always set.
+func (server *MockServer) NewClientWithConfig(conf *rri.ClientConfig) *rri.Client {
+	server.tb.Helper()
+
+	var clientConf rri.ClientConfig
+	if conf != nil {
+		clientConf = *conf
+	}
+	clientConf.Insecure = true
+
+	client, err := rri.NewClient(server.Address(), &clientConf)
+	require.NoError(server.tb, err, "failed to connect to mock server")
+	server.tb.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+// NewLoggedInClient registers the given user on the mock server and returns a new client that is logged in as this
+// user.
+func (server *MockServer) NewLoggedInClient(user, pass string) *rri.Client {
+	server.tb.Helper()
+
+	server.AddUser(user, pass)
+	client := server.NewClient()
+	require.NoError(server.tb, client.Login(user, pass), "failed to login to mock server")
+	return client
+}
+
+// QueriesWithAction returns all received queries with the given action in order.
+func (server *MockServer) QueriesWithAction(action rri.QueryAction) []*rri.Query {
+	action = action.Normalize()
+	queries := make([]*rri.Query, 0)
+	for _, query := range server.Queries() {
+		if query.Action() == action {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+// LastQuery returns the most recently received query or nil.
+func (server *MockServer) LastQuery() *rri.Query {
+	queries := server.Queries()
+	if len(queries) == 0 {
+		return nil
+	}
+	return queries[len(queries)-1]
+}
+
+// AssertQueryCount asserts that exactly count queries with the given action have been received. Counts all queries if
+// action is empty.
+func (server *MockServer) AssertQueryCount(action rri.QueryAction, count int) bool {
+	server.tb.Helper()
+	if len(action) == 0 {
+		return assert.Len(server.tb, server.Queries(), count, "unexpected number of queries")
+	}
+	return assert.Len(server.tb, server.QueriesWithAction(action), count, "unexpected number of %s queries", action)
+}
+
+// AssertReceived asserts that a query with the same action and fields as expected has been received.
+func (server *MockServer) AssertReceived(expected *rri.Query) bool {
+	server.tb.Helper()
+	expectedMsg := expected.EncodeKV()
+	for _, query := range server.Queries() {
+		if query.EncodeKV() == expectedMsg {
+			return true
+		}
+	}
+	return assert.Fail(server.tb, "query has not been received", "expected query:\n%s", expectedMsg)
+}
+
+// AssertNotReceived asserts that no query with the given action has been received.
+func (server *MockServer) AssertNotReceived(action rri.QueryAction) bool {
+	server.tb.Helper()
+	return assert.Empty(server.tb, server.QueriesWithAction(action), "unexpected %s query", action)
+}
+
+// AssertLastQuery asserts that the most recently received query has the same action and fields as expected.
+func (server *MockServer) AssertLastQuery(expected *rri.Query) bool {
+	server.tb.Helper()
+	lastQuery := server.LastQuery()
+	if !assert.NotNil(server.tb, lastQuery, "no query has been received") {
+		return false
+	}
+	return assert.Equal(server.tb, expected.EncodeKV(), lastQuery.EncodeKV(), "unexpected last query")
+}
@@ -0,0 +1,78 @@
+package rritest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DENICeG/go-rriclient/pkg/rri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockServer(t *testing.T) {
+	t.Parallel()
+
+	server := NewMockServer(t)
+	server.SetHandler(func(user string, session *rri.Session, query *rri.Query) (*rri.Response, error) {
+		return rri.NewResponse(rri.ResultSuccess, nil), nil
+	})
+
+	client := server.NewLoggedInClient("DENIC-1000011-TEST", "secret")
+	response, err := client.SendQuery(rri.NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+
+	server.AssertQueryCount("", 2)
+	server.AssertQueryCount(rri.ActionLogin, 1)
+	server.AssertQueryCount("info", 1)
+	server.AssertReceived(rri.NewLoginQuery("DENIC-1000011-TEST", "secret"))
+	server.AssertLastQuery(rri.NewInfoDomainQuery("denic.de"))
+	server.AssertNotReceived(rri.ActionDelete)
+
+	server.ResetQueries()
+	assert.Nil(t, server.LastQuery())
+}
+
+func TestMockServerParallel(t *testing.T) {
+	t.Parallel()
+
+	// every mock server listens on its own port
+	server1 := NewMockServer(t)
+	server2 := NewMockServer(t)
+	assert.NotEqual(t, server1.Address(), server2.Address())
+
+	server1.NewLoggedInClient("DENIC-1000011-TEST", "secret")
+	server2.NewClientWithConfig(&rri.ClientConfig{RetryPolicy: &rri.RetryPolicy{MaxAttempts: 1}})
+	server1.AssertQueryCount(rri.ActionLogin, 1)
+	server2.AssertQueryCount("", 0)
+}
+
+func TestMockServerAssertions(t *testing.T) {
+	server := NewMockServer(t)
+	client := server.NewLoggedInClient("DENIC-1000011-TEST", "secret")
+	_, err := client.SendQuery(rri.NewCheckDomainQuery("denic.de"))
+	require.NoError(t, err)
+
+	// run assertions against a recording test to check that they fail
+	recorder := &recordingTB{TB: t}
+	failing := &MockServer{MockServer: server.MockServer, tb: recorder}
+	assert.False(t, failing.AssertQueryCount(rri.ActionCheck, 2))
+	assert.False(t, failing.AssertReceived(rri.NewCheckDomainQuery("denic.com")))
+	assert.False(t, failing.AssertNotReceived(rri.ActionCheck))
+	assert.False(t, failing.AssertLastQuery(rri.NewLogoutQuery()))
+	assert.Len(t, recorder.failures, 4)
+
+	assert.True(t, server.AssertQueryCount(rri.ActionCheck, 1))
+}
+
+// recordingTB records failures instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.failures = append(tb.failures, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,115 @@
+package rri
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// QueryObjectNone denotes queries that do not refer to a domain or handle, like LOGIN or QUEUE-READ.
+	QueryObjectNone QueryObject = ""
+	// QueryObjectDomain denotes queries that refer to a domain.
+	QueryObjectDomain QueryObject = "domain"
+	// QueryObjectHandle denotes queries that refer to a contact handle.
+	QueryObjectHandle QueryObject = "handle"
+)
+
+// QueryObject denotes the type of object a query refers to. Actions like CREATE or INFO are used for domains and
+// handles alike.
+type QueryObject string
+
+// Object returns the type of object the query refers to, determined by the presence of a handle or domain field.
+func (q *Query) Object() QueryObject {
+	if len(q.FirstField(QueryFieldNameHandle)) > 0 {
+		return QueryObjectHandle
+	}
+	if len(q.FirstField(QueryFieldNameDomainIDN)) > 0 || len(q.FirstField(QueryFieldNameDomainACE)) > 0 {
+		return QueryObjectDomain
+	}
+	return QueryObjectNone
+}
+
+// HandlerMiddleware wraps a QueryHandler to intercept queries and responses on the server side. Call next to pass the
+// query on or return a response directly to short-circuit handling.
+type HandlerMiddleware func(next QueryHandler) QueryHandler
+
+type serveMuxKey struct {
+	action QueryAction
+	object QueryObject
+}
+
+// ServeMux routes queries to handlers registered per action and optionally per object type. Handlers registered for
+// an action and object type take precedence over handlers for the action only. Queries without a matching handler
+// are passed to the fallback. Use ServeQuery as Server.Handler.
+//
+// A ServeMux is safe for concurrent use. Handlers and middlewares can be registered while the server is running.
+type ServeMux struct {
+	mutex       sync.RWMutex
+	handlers    map[serveMuxKey]QueryHandler
+	fallback    QueryHandler
+	middlewares []HandlerMiddleware
+}
+
+// NewServeMux returns a new ServeMux without handlers. Queries are rejected with ErrNoQueryHandler, which closes the
+// connection, until a fallback is set.
+func NewServeMux() *ServeMux {
+	return &ServeMux{handlers: make(map[serveMuxKey]QueryHandler)}
+}
+
+// Handle registers the handler for all queries with the given action. An existing handler is replaced.
+func (mux *ServeMux) Handle(action QueryAction, handler QueryHandler) {
+	mux.HandleObject(action, QueryObjectNone, handler)
+}
+
+// HandleObject registers the handler for queries with the given action that refer to the given object type. An
+// existing handler is replaced. Pass QueryObjectNone to match all queries with the action.
+func (mux *ServeMux) HandleObject(action QueryAction, object QueryObject, handler QueryHandler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.handlers[serveMuxKey{action.Normalize(), object}] = handler
+}
+
+// HandleFallback registers the handler for all queries without a matching handler.
+func (mux *ServeMux) HandleFallback(handler QueryHandler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.fallback = handler
+}
+
+// Use appends middlewares to the chain that wraps all handlers, including the fallback. The first middleware is the
+// outermost one.
+func (mux *ServeMux) Use(middlewares ...HandlerMiddleware) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.middlewares = append(mux.middlewares, middlewares...)
+}
+
+// ServeQuery passes the query through all middlewares to the matching handler.
+func (mux *ServeMux) ServeQuery(session *Session, query *Query) (*Response, error) {
+	mux.mutex.RLock()
+	handler := mux.route
+	for i := len(mux.middlewares) - 1; i >= 0; i-- {
+		handler = mux.middlewares[i](handler)
+	}
+	mux.mutex.RUnlock()
+
+	return handler(session, query)
+}
+
+// route passes the query to the matching handler.
+func (mux *ServeMux) route(session *Session, query *Query) (*Response, error) {
+	mux.mutex.RLock()
+	handler, ok := mux.handlers[serveMuxKey{query.Action(), query.Object()}]
+	if !ok {
+		handler, ok = mux.handlers[serveMuxKey{query.Action(), QueryObjectNone}]
+	}
+	if !ok {
+		handler = mux.fallback
+	}
+	mux.mutex.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("%w for %s query", ErrNoQueryHandler, query.Action())
+	}
+	return handler(session, query)
+}
@@ -0,0 +1,81 @@
+package rri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSession() *Session {
+	return &Session{values: make(map[string]interface{})}
+}
+
+func respondWith(msg string) QueryHandler {
+	return func(session *Session, query *Query) (*Response, error) {
+		return NewResponseWithInfo(ResultSuccess, nil, NewBusinessMessage(1, msg)), nil
+	}
+}
+
+func TestQueryObject(t *testing.T) {
+	assert.Equal(t, QueryObjectDomain, NewInfoDomainQuery("denic.de").Object())
+	assert.Equal(t, QueryObjectHandle, NewInfoHandleQuery(NewDenicHandle(1000011, "SOME-DUDE")).Object())
+	assert.Equal(t, QueryObjectNone, NewLoginQuery("user", "secret").Object())
+	assert.Equal(t, QueryObjectNone, NewQueueReadQuery("").Object())
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle(ActionInfo, respondWith("info"))
+	mux.HandleObject("create", QueryObjectHandle, respondWith("create handle"))
+	mux.HandleObject(ActionCreate, QueryObjectDomain, respondWith("create domain"))
+
+	serve := func(query *Query) string {
+		response, err := mux.ServeQuery(newTestSession(), query)
+		require.NoError(t, err)
+		return response.InfoMessages()[0].Message()
+	}
+
+	handle := NewDenicHandle(1000011, "SOME-DUDE")
+	assert.Equal(t, "info", serve(NewInfoDomainQuery("denic.de")))
+	assert.Equal(t, "info", serve(NewInfoHandleQuery(handle)))
+	assert.Equal(t, "create handle", serve(NewCreateContactQuery(handle, ContactData{})))
+	assert.Equal(t, "create domain", serve(NewCreateDomainQuery("denic.de", DomainData{})))
+
+	_, err := mux.ServeQuery(newTestSession(), NewDeleteDomainQuery("denic.de"))
+	assert.ErrorIs(t, err, ErrNoQueryHandler)
+
+	mux.HandleFallback(respondWith("fallback"))
+	assert.Equal(t, "fallback", serve(NewDeleteDomainQuery("denic.de")))
+	assert.Equal(t, "fallback", serve(NewLogoutQuery()))
+}
+
+func TestServeMuxMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) HandlerMiddleware {
+		return func(next QueryHandler) QueryHandler {
+			return func(session *Session, query *Query) (*Response, error) {
+				calls = append(calls, name)
+				return next(session, query)
+			}
+		}
+	}
+
+	mux := NewServeMux()
+	mux.HandleFallback(respondWith("fallback"))
+	mux.Use(trace("outer"), trace("inner"))
+	mux.Handle(ActionInfo, func(session *Session, query *Query) (*Response, error) {
+		calls = append(calls, "handler")
+		return NewResponse(ResultSuccess, nil), nil
+	})
+
+	_, err := mux.ServeQuery(newTestSession(), NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+
+	// middlewares also wrap the fallback
+	calls = nil
+	_, err = mux.ServeQuery(newTestSession(), NewCheckDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+}
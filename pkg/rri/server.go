@@ -1,9 +1,17 @@
 package rri
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -11,13 +19,38 @@ var (
 	ErrCloseConnection = fmt.Errorf("gracefully shutdown connection to client")
 )
 
+// sessionKeyUser denotes the session value that holds the name of the authenticated user.
+const sessionKeyUser = "user"
+
 // QueryHandler is called for incoming RRI queryies by the server and expects a result as return value.
 // If an error is returned instead, it is written to log and the connection is closed immmediately.
 type QueryHandler func(*Session, *Query) (*Response, error)
 
 // Session is used to keep the state of an RRI connection.
 type Session struct {
-	values map[string]interface{}
+	values         map[string]interface{}
+	queryFormat    MessageFormat
+	responseFormat MessageFormat
+}
+
+// QueryFormat returns the format of the most recently received query.
+func (s *Session) QueryFormat() MessageFormat {
+	return s.queryFormat
+}
+
+// SetResponseFormat forces all following responses of this session to be sent in the given format.
+// Use MessageFormatAuto to answer in the same format as the incoming query, which is the default. The connection is
+// closed if a response cannot be represented in the XML schema.
+func (s *Session) SetResponseFormat(format MessageFormat) {
+	s.responseFormat = format
+}
+
+// ResponseFormat returns the format for the response to the most recently received query.
+func (s *Session) ResponseFormat() MessageFormat {
+	if s.responseFormat != MessageFormatAuto {
+		return s.responseFormat
+	}
+	return s.queryFormat
 }
 
 // Set sets a value for the current session across multiple queries.
@@ -41,6 +74,11 @@ func (s *Session) GetString(key string) (string, bool) {
 	return "", false
 }
 
+// User returns the name of the user authenticated by AuthMiddleware or MockServer.
+func (s *Session) User() (string, bool) {
+	return s.GetString(sessionKeyUser)
+}
+
 // GetInt returns an integer value previously set for the current session.
 func (s *Session) GetInt(key string) (int, bool) {
 	if value, ok := s.values[key]; ok {
@@ -61,11 +99,40 @@ func (s *Session) GetBool(key string) (bool, bool) {
 	return false, false
 }
 
-// Server represents a basic RRI client to receive RRI queries and send responses.
+// ConnectionErrorHandler is called by Server for errors that caused a client connection to be closed.
+type ConnectionErrorHandler func(remoteAddr net.Addr, err error)
+
+// Server represents a basic RRI server to receive RRI queries and send responses.
 type Server struct {
-	listener net.Listener
-	isClosed bool
-	Handler  QueryHandler
+	listener    net.Listener
+	isClosed    atomic.Bool
+	closing     chan struct{}
+	closingOnce sync.Once
+	ready       chan struct{}
+	readyOnce   sync.Once
+	connMutex   sync.Mutex
+	connections map[*serverConn]struct{}
+	Handler     QueryHandler
+	// IdleTimeout denotes how long to wait for the next query of a connection before closing it. No timeout if 0.
+	IdleTimeout time.Duration
+	// ReadTimeout denotes the maximum duration to receive a query after its first byte has arrived. No timeout if 0.
+	ReadTimeout time.Duration
+	// ErrorLog is used to log errors that caused a connection to be closed. Errors are not logged if nil.
+	ErrorLog *log.Logger
+	// ConnectionErrorHandler is called for errors that caused a connection to be closed, like failed query handlers or
+	// malformed queries. Regular disconnects, idle timeouts and ErrCloseConnection are not reported.
+	ConnectionErrorHandler ConnectionErrorHandler
+	// MaxMessageSize denotes the maximum size of queries and responses in bytes. Uses DefaultMaxMessageSize if not set.
+	// Connections sending larger queries are closed.
+	MaxMessageSize int
+	// FaultInjector can be set to inject failures for testing. Must not be changed while the server is running.
+	FaultInjector *FaultInjector
+}
+
+// serverConn tracks the state of a client connection. active is guarded by Server.connMutex.
+type serverConn struct {
+	conn   net.Conn
+	active bool
 }
 
 // NewServer returns a new RRI server for the given TLS config listening on the given port.
@@ -75,61 +142,264 @@ func NewServer(listenAddress string, tlsConfig *tls.Config) (*Server, error) {
 		return nil, err
 	}
 
-	return &Server{listener, false, nil}, nil
+	return &Server{
+		listener:    listener,
+		closing:     make(chan struct{}),
+		ready:       make(chan struct{}),
+		connections: make(map[*serverConn]struct{}),
+	}, nil
 }
 
-// Close gracefully shuts down the server.
+// Addr returns the address the server is listening on. Use it to determine the actual port when listening on port 0.
+func (srv *Server) Addr() net.Addr {
+	return srv.listener.Addr()
+}
+
+// Ready returns a channel that is closed as soon as Run accepts client connections.
+func (srv *Server) Ready() <-chan struct{} {
+	return srv.ready
+}
+
+// Close immediately stops accepting connections and closes all open connections, including those with queries in
+// flight. Use Shutdown to wait for pending queries.
 func (srv *Server) Close() error {
-	srv.isClosed = true
-	return srv.listener.Close()
+	srv.markClosed()
+	err := srv.listener.Close()
+
+	srv.connMutex.Lock()
+	defer srv.connMutex.Unlock()
+	for sc := range srv.connections {
+		sc.conn.Close()
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down the server. It stops accepting connections, waits for queries in flight to be
+// answered and closes idle connections. Queries that have started to arrive are in flight and responses delayed by
+// FaultDelay are sent immediately. If ctx expires before, all remaining connections are closed and the context
+// error is returned.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.markClosed()
+	err := srv.listener.Close()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if srv.closeIdleConnections() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			srv.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// markClosed stops accepting new queries and aborts pending response delays.
+func (srv *Server) markClosed() {
+	srv.isClosed.Store(true)
+	srv.closingOnce.Do(func() { close(srv.closing) })
+}
+
+// closeIdleConnections closes all connections without queries in flight and returns whether all connections are gone.
+func (srv *Server) closeIdleConnections() bool {
+	srv.connMutex.Lock()
+	defer srv.connMutex.Unlock()
+	for sc := range srv.connections {
+		if !sc.active {
+			sc.conn.Close()
+		}
+	}
+	return len(srv.connections) == 0
+}
+
+// trackConnection adds or removes a connection and returns false if the server is already closed.
+func (srv *Server) trackConnection(sc *serverConn, add bool) bool {
+	srv.connMutex.Lock()
+	defer srv.connMutex.Unlock()
+	if !add {
+		delete(srv.connections, sc)
+		return true
+	}
+	if srv.isClosed.Load() {
+		return false
+	}
+	srv.connections[sc] = struct{}{}
+	return true
+}
+
+// setActive marks whether a query is in flight for the connection and returns false if the server is shutting down
+// and the connection must not process further queries. Active connections are not closed by Shutdown, so a query
+// that has started to arrive before its connection was closed as idle is always processed.
+func (srv *Server) setActive(sc *serverConn, active bool) bool {
+	srv.connMutex.Lock()
+	defer srv.connMutex.Unlock()
+	sc.active = active
+	return !srv.isClosed.Load()
 }
 
 // Run starts accepting client connections to pass to the configured query handler and blocks until the server is stopped.
 func (srv *Server) Run() error {
+	srv.readyOnce.Do(func() { close(srv.ready) })
 	for {
 		conn, err := srv.listener.Accept()
 		if err != nil {
-			if srv.isClosed {
+			if srv.isClosed.Load() {
 				return nil
 			}
 			return err
 		}
 
+		sc := &serverConn{conn: conn}
+		if !srv.trackConnection(sc, true) {
+			conn.Close()
+			continue
+		}
+
 		go func() {
-			session := &Session{make(map[string]interface{})}
-
-			if err := func() error {
-				for {
-					msg, err := readMessage(conn)
-					if err != nil {
-						return err
-					}
-
-					if srv.Handler != nil {
-						query, err := ParseQuery(string(msg))
-						if err != nil {
-							return err
-						}
-
-						response, err := srv.Handler(session, query)
-						if err != nil {
-							return err
-						}
-
-						//TODO answer in same type as the query (KV or XML)
-						responseMsg := prepareMessage(response.EncodeKV())
-						if _, err := conn.Write([]byte(responseMsg)); err != nil {
-							return err
-						}
-					} else {
-						return fmt.Errorf("no RRI query handler defined")
-					}
-				}
-			}(); err != nil {
-				//TODO handle error
-			}
+			defer srv.trackConnection(sc, false)
+			defer conn.Close()
 
-			conn.Close()
+			if err := srv.serve(sc); err != nil && !errors.Is(err, ErrCloseConnection) && !srv.isClosed.Load() {
+				srv.logError(conn.RemoteAddr(), err)
+			}
 		}()
 	}
 }
+
+func (srv *Server) logError(remoteAddr net.Addr, err error) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf("closed connection from %s: %s", remoteAddr, err)
+	}
+	if srv.ConnectionErrorHandler != nil {
+		srv.ConnectionErrorHandler(remoteAddr, err)
+	}
+}
+
+// serve handles the queries of a connection until it is closed.
+func (srv *Server) serve(sc *serverConn) error {
+	conn := sc.conn
+	if fault := srv.FaultInjector.nextConnectionFault(); fault != nil {
+		failHandshake(conn)
+		return nil
+	}
+
+	session := &Session{values: make(map[string]interface{})}
+	reader := &queryReader{conn: conn, readTimeout: srv.ReadTimeout, onStart: func() { srv.setActive(sc, true) }}
+	frames := NewFrameReader(reader, srv.MaxMessageSize)
+	for {
+		if err := reader.reset(srv.IdleTimeout); err != nil {
+			return err
+		}
+		msg, err := frames.ReadFrame()
+		if err != nil {
+			if !reader.started && (errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded)) {
+				// client disconnected or idle timeout expired
+				return nil
+			}
+			return err
+		}
+
+		// the connection was marked active with the first byte of the query and is thus not closed by a concurrent
+		// shutdown until the query is answered
+		if err := srv.handleQuery(session, conn, msg); err != nil {
+			return err
+		}
+		if !srv.setActive(sc, false) {
+			// do not wait for further queries during shutdown
+			return nil
+		}
+	}
+}
+
+// handleQuery passes a query to the handler and writes the response.
+func (srv *Server) handleQuery(session *Session, conn net.Conn, msg string) error {
+	if srv.Handler == nil {
+		return fmt.Errorf("no RRI query handler defined")
+	}
+
+	session.queryFormat = DetectMessageFormat(msg)
+	query, err := ParseQuery(msg)
+	if err != nil {
+		return err
+	}
+
+	fault := srv.FaultInjector.nextQueryFault(query)
+	if fault != nil && fault.Type == FaultCloseBeforeProcessing {
+		return ErrCloseConnection
+	}
+
+	response, err := srv.Handler(session, query)
+	if err != nil {
+		return err
+	}
+
+	responseMsg, err := response.Encode(session.ResponseFormat())
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	if fault != nil {
+		if fault.Type == FaultCloseAfterProcessing {
+			return ErrCloseConnection
+		}
+		if fault.Type == FaultDelay {
+			srv.delay(fault.Delay)
+		}
+		closeConn, err := writeFaultyResponse(conn, fault, prepareMessage(responseMsg))
+		if err == nil && closeConn {
+			return ErrCloseConnection
+		}
+		return err
+	}
+
+	return NewFrameWriter(conn, srv.MaxMessageSize).WriteFrame(responseMsg)
+}
+
+// delay waits for the given duration or until the server is closed.
+func (srv *Server) delay(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-srv.closing:
+	}
+}
+
+// queryReader applies the idle timeout until the first byte of a query has been received and the read timeout
+// afterwards. onStart is called as soon as the first byte of a query has been received.
+type queryReader struct {
+	conn        net.Conn
+	readTimeout time.Duration
+	onStart     func()
+	started     bool
+}
+
+// reset prepares reading the next query.
+func (r *queryReader) reset(idleTimeout time.Duration) error {
+	r.started = false
+	return r.conn.SetReadDeadline(deadlineAfter(idleTimeout))
+}
+
+func (r *queryReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	if n > 0 && !r.started {
+		r.started = true
+		if r.onStart != nil {
+			r.onStart()
+		}
+		if deadlineErr := r.conn.SetReadDeadline(deadlineAfter(r.readTimeout)); err == nil {
+			err = deadlineErr
+		}
+	}
+	return n, err
+}
+
+// deadlineAfter returns the deadline for the given timeout or the zero time for no timeout.
+func deadlineAfter(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
@@ -0,0 +1,132 @@
+package rri
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	// MessageLoginRequired is sent by AuthMiddleware for failed logins and queries of unauthenticated sessions.
+	MessageLoginRequired = NewBusinessMessage(83000000010, "Please login first")
+	// MessageRateLimitExceeded is sent by RateLimitMiddleware for queries exceeding the rate limit.
+	MessageRateLimitExceeded = NewBusinessMessage(83000000020, "Too many requests")
+)
+
+// Authenticator checks the credentials of a LOGIN query.
+type Authenticator func(user, pass string) bool
+
+// AuthMiddleware returns a middleware that answers LOGIN queries by checking the credentials with authenticate and
+// closes the connection on LOGOUT. All other queries are only passed on for authenticated sessions and answered with
+// MessageLoginRequired otherwise. Use Session.User to get the name of the authenticated user.
+func AuthMiddleware(authenticate Authenticator) HandlerMiddleware {
+	return func(next QueryHandler) QueryHandler {
+		return func(session *Session, query *Query) (*Response, error) {
+			switch query.Action() {
+			case ActionLogin:
+				user := query.FirstField(QueryFieldNameUser)
+				pass := query.FirstField(QueryFieldNamePassword)
+				if authenticate(user, pass) {
+					session.Set(sessionKeyUser, user)
+					return NewResponse(ResultSuccess, nil), nil
+				}
+				return NewResponseWithError(ResultFailure, nil, MessageLoginRequired), nil
+
+			case ActionLogout:
+				return nil, ErrCloseConnection
+
+			default:
+				if _, ok := session.User(); !ok {
+					return NewResponseWithError(ResultFailure, nil, MessageLoginRequired), nil
+				}
+				return next(session, query)
+			}
+		}
+	}
+}
+
+// LoggingMiddleware returns a middleware that logs every query with the authenticated user, the result and the
+// processing time.
+func LoggingMiddleware(logger *log.Logger) HandlerMiddleware {
+	return func(next QueryHandler) QueryHandler {
+		return func(session *Session, query *Query) (*Response, error) {
+			start := time.Now()
+			response, err := next(session, query)
+
+			user, ok := session.User()
+			if !ok {
+				user = "-"
+			}
+			var result string
+			switch {
+			case err != nil:
+				result = fmt.Sprintf("error: %s", err)
+			case response != nil:
+				result = string(response.Result())
+			}
+			logger.Printf("%s query of %s: %s (%s)", query.Action(), user, result, time.Since(start))
+			return response, err
+		}
+	}
+}
+
+// RecoveryMiddleware returns a middleware that recovers from panics in the following handlers. The panic is returned
+// as error, so the connection is closed and the panic is reported to Server.ErrorLog and Server.ConnectionErrorHandler.
+func RecoveryMiddleware() HandlerMiddleware {
+	return func(next QueryHandler) QueryHandler {
+		return func(session *Session, query *Query) (response *Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					response = nil
+					err = fmt.Errorf("panic in %s query handler: %v\n%s", query.Action(), r, debug.Stack())
+				}
+			}()
+			return next(session, query)
+		}
+	}
+}
+
+type rateLimitBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+// RateLimitMiddleware returns a middleware that limits the number of queries per authenticated user to queriesPerSecond
+// on average with bursts of up to burst queries. Queries exceeding the limit are answered with MessageRateLimitExceeded.
+// Place it after AuthMiddleware, as unauthenticated sessions share a single limit.
+func RateLimitMiddleware(queriesPerSecond float64, burst int) HandlerMiddleware {
+	var mutex sync.Mutex
+	buckets := make(map[string]*rateLimitBucket)
+
+	allow := func(user string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := time.Now()
+		bucket, ok := buckets[user]
+		if !ok {
+			bucket = &rateLimitBucket{tokens: float64(burst), lastUpdate: now}
+			buckets[user] = bucket
+		}
+		bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.lastUpdate).Seconds()*queriesPerSecond)
+		bucket.lastUpdate = now
+		if bucket.tokens < 1 {
+			return false
+		}
+		bucket.tokens--
+		return true
+	}
+
+	return func(next QueryHandler) QueryHandler {
+		return func(session *Session, query *Query) (*Response, error) {
+			user, _ := session.User()
+			if !allow(user) {
+				return NewResponseWithError(ResultFailure, nil, MessageRateLimitExceeded), nil
+			}
+			return next(session, query)
+		}
+	}
+}
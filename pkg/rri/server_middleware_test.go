@@ -0,0 +1,112 @@
+package rri
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := AuthMiddleware(func(user, pass string) bool {
+		return user == "DENIC-1000011-TEST" && pass == "secret"
+	})(respondWith("authenticated"))
+	session := newTestSession()
+
+	response, err := handler(session, NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, []BusinessMessage{MessageLoginRequired}, response.ErrorMessages())
+
+	response, err = handler(session, NewLoginQuery("DENIC-1000011-TEST", "wrong"))
+	require.NoError(t, err)
+	assert.False(t, response.IsSuccessful())
+	_, ok := session.User()
+	assert.False(t, ok)
+
+	response, err = handler(session, NewLoginQuery("DENIC-1000011-TEST", "secret"))
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+	user, _ := session.User()
+	assert.Equal(t, "DENIC-1000011-TEST", user)
+
+	response, err = handler(session, NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, "authenticated", response.InfoMessages()[0].Message())
+
+	_, err = handler(session, NewLogoutQuery())
+	assert.ErrorIs(t, err, ErrCloseConnection)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buffer bytes.Buffer
+	handler := LoggingMiddleware(log.New(&buffer, "", 0))(respondWith("logged"))
+	session := newTestSession()
+	session.Set(sessionKeyUser, "DENIC-1000011-TEST")
+
+	_, err := handler(session, NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "INFO query of DENIC-1000011-TEST: success (")
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware()(func(session *Session, query *Query) (*Response, error) {
+		panic("oops")
+	})
+
+	response, err := handler(newTestSession(), NewInfoDomainQuery("denic.de"))
+	assert.Nil(t, response)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic in INFO query handler: oops")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimitMiddleware(0.001, 2)(respondWith("allowed"))
+	session1 := newTestSession()
+	session1.Set(sessionKeyUser, "DENIC-1000011-TEST")
+	session2 := newTestSession()
+	session2.Set(sessionKeyUser, "DENIC-1000022-TEST")
+
+	for i := 0; i < 2; i++ {
+		response, err := handler(session1, NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		assert.True(t, response.IsSuccessful())
+	}
+	response, err := handler(session1, NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, []BusinessMessage{MessageRateLimitExceeded}, response.ErrorMessages())
+
+	// limits apply per user
+	response, err = handler(session2, NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+}
+
+func TestServeMuxServer(t *testing.T) {
+	mux := NewServeMux()
+	mux.Use(RecoveryMiddleware(), AuthMiddleware(func(user, pass string) bool { return pass == "secret" }))
+	mux.HandleObject(ActionInfo, QueryObjectDomain, func(session *Session, query *Query) (*Response, error) {
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	mux.HandleObject(ActionInfo, QueryObjectHandle, func(session *Session, query *Query) (*Response, error) {
+		panic("not implemented")
+	})
+
+	server := newTestServer(t, mux.ServeQuery)
+	runTestServer(server)
+	defer server.Close()
+
+	noRetry := NoRetryPolicy()
+	client, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+	response, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+
+	_, err = client.SendQuery(NewInfoHandleQuery(NewDenicHandle(1000011, "SOME-DUDE")))
+	assert.Error(t, err, "panics must close the connection")
+}
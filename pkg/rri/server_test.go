@@ -1,8 +1,13 @@
 package rri
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,20 +16,22 @@ import (
 )
 
 func TestServer(t *testing.T) {
-	port := 31298
 	tlsConfig, err := NewMockTLSConfig()
 	if err != nil {
 		panic(err)
 	}
-	server, err := NewServer(fmt.Sprintf(":%d", port), tlsConfig)
+	server, err := NewServer("localhost:0", tlsConfig)
 	if err != nil {
 		panic(err)
 	}
 
+	var m sync.Mutex
 	queryCount := 0
 	var lastQuery *Query
 
 	server.Handler = func(s *Session, q *Query) (*Response, error) {
+		m.Lock()
+		defer m.Unlock()
 		queryCount++
 		lastQuery = q
 		return NewResponse(ResultSuccess, nil), nil
@@ -34,8 +41,9 @@ func TestServer(t *testing.T) {
 		assert.NoError(t, server.Run())
 	}()
 	defer server.Close()
+	<-server.Ready()
 
-	client := &Client{address: fmt.Sprintf("localhost:%d", port)}
+	client := &Client{address: localAddress(server)}
 	client.tlsConfig = &tls.Config{
 		MinVersion:         tls.VersionTLS13,
 		InsecureSkipVerify: true,
@@ -45,37 +53,39 @@ func TestServer(t *testing.T) {
 	require.NoError(t, err)
 	client.connection.Write(prepareMessage("version: 5.0\naction: LOGIN\nuser: user\npassword: secret"))
 
-	// let some time pass for the query to be processed
-	time.Sleep(50 * time.Millisecond)
-
-	require.Equal(t, 1, queryCount, "expected to receive exactly one query")
-	assert.Equal(t, ActionLogin, lastQuery.Action())
-	assert.Equal(t, "user", lastQuery.FirstField(QueryFieldNameUser))
-	assert.Equal(t, "secret", lastQuery.FirstField(QueryFieldNamePassword))
-
+	// the query has been processed as soon as the response is received
 	msg, err := readMessage(client.connection)
 	require.NoError(t, err)
 	response, err := ParseResponse(msg)
 	require.NoError(t, err)
 	assert.Equal(t, ResultSuccess, response.Result())
+
+	m.Lock()
+	defer m.Unlock()
+	require.Equal(t, 1, queryCount, "expected to receive exactly one query")
+	assert.Equal(t, ActionLogin, lastQuery.Action())
+	assert.Equal(t, "user", lastQuery.FirstField(QueryFieldNameUser))
+	assert.Equal(t, "secret", lastQuery.FirstField(QueryFieldNamePassword))
 }
 
 func TestServerSession(t *testing.T) {
-	port := 31298
 	tlsConfig, err := NewMockTLSConfig()
 	if err != nil {
 		panic(err)
 	}
-	server, err := NewServer(fmt.Sprintf(":%d", port), tlsConfig)
+	server, err := NewServer("localhost:0", tlsConfig)
 	if err != nil {
 		panic(err)
 	}
 
 	expectedUser := "captain-kirk"
+	var m sync.Mutex
 	loginQueryCount := 0
 	logoutQueryCount := 0
 
 	server.Handler = func(s *Session, q *Query) (*Response, error) {
+		m.Lock()
+		defer m.Unlock()
 		if q.Action() == ActionLogin {
 			loginQueryCount++
 			_, ok := s.GetString("user")
@@ -96,30 +106,35 @@ func TestServerSession(t *testing.T) {
 		assert.NoError(t, server.Run())
 	}()
 	defer server.Close()
+	<-server.Ready()
 
-	client, err := NewClient(fmt.Sprintf("localhost:%d", port), &ClientConfig{Insecure: true})
+	client, err := NewClient(localAddress(server), &ClientConfig{Insecure: true})
 	require.NoError(t, err)
 	require.NoError(t, client.Login(expectedUser, "secret"))
 	require.NoError(t, client.Logout())
+	m.Lock()
+	defer m.Unlock()
 	assert.Equal(t, 1, loginQueryCount)
 	assert.Equal(t, 1, logoutQueryCount)
 }
 
 func TestServerConcurrentConnections(t *testing.T) {
-	port := 31298
 	tlsConfig, err := NewMockTLSConfig()
 	if err != nil {
 		panic(err)
 	}
-	server, err := NewServer(fmt.Sprintf(":%d", port), tlsConfig)
+	server, err := NewServer("localhost:0", tlsConfig)
 	if err != nil {
 		panic(err)
 	}
 
+	var m sync.Mutex
 	loggedIn := make(map[string]int)
 	loggedOut := make(map[string]int)
 
 	server.Handler = func(s *Session, q *Query) (*Response, error) {
+		m.Lock()
+		defer m.Unlock()
 		if q.Action() == ActionLogin {
 			num := loggedIn[q.FirstField(QueryFieldNameUser)]
 			loggedIn[q.FirstField(QueryFieldNameUser)] = num + 1
@@ -141,13 +156,14 @@ func TestServerConcurrentConnections(t *testing.T) {
 		assert.NoError(t, server.Run())
 	}()
 	defer server.Close()
+	<-server.Ready()
 
-	client1, err := NewClient(fmt.Sprintf("localhost:%d", port), &ClientConfig{Insecure: true})
+	client1, err := NewClient(localAddress(server), &ClientConfig{Insecure: true})
 	if err != nil {
 		panic(err)
 	}
 
-	client2, err := NewClient(fmt.Sprintf("localhost:%d", port), &ClientConfig{Insecure: true})
+	client2, err := NewClient(localAddress(server), &ClientConfig{Insecure: true})
 	if err != nil {
 		panic(err)
 	}
@@ -158,6 +174,8 @@ func TestServerConcurrentConnections(t *testing.T) {
 	defer client2.Close()
 	require.NoError(t, client1.Logout())
 	require.NoError(t, client2.Logout())
+	m.Lock()
+	defer m.Unlock()
 	require.Len(t, loggedIn, 2)
 	require.Len(t, loggedOut, 2)
 	require.Contains(t, loggedIn, "user1")
@@ -169,3 +187,359 @@ func TestServerConcurrentConnections(t *testing.T) {
 	assert.Equal(t, 1, loggedOut["user1"])
 	assert.Equal(t, 1, loggedOut["user2"])
 }
+
+func TestServerResponseFormat(t *testing.T) {
+	tlsConfig, err := NewMockTLSConfig()
+	if err != nil {
+		panic(err)
+	}
+	server, err := NewServer("localhost:0", tlsConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	server.Handler = func(s *Session, q *Query) (*Response, error) {
+		if q.Action() == ActionLogin && q.FirstField(QueryFieldNameUser) == "xml-user" {
+			s.SetResponseFormat(MessageFormatXML)
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	}
+
+	go func() {
+		assert.NoError(t, server.Run())
+	}()
+	defer server.Close()
+	<-server.Ready()
+
+	sendAndReceive := func(conn *tls.Conn, msg string) string {
+		_, err := conn.Write(prepareMessage(msg))
+		require.NoError(t, err)
+		response, err := readMessage(conn)
+		require.NoError(t, err)
+		return response
+	}
+
+	tlsClientConfig := &tls.Config{MinVersion: tls.VersionTLS13, InsecureSkipVerify: true}
+
+	conn, err := tls.Dial("tcp", localAddress(server), tlsClientConfig)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, MessageFormatKV, DetectMessageFormat(sendAndReceive(conn, NewLoginQuery("user", "secret").EncodeKV())))
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(sendAndReceive(conn, mustEncodeQueryXML(t, NewInfoDomainQuery("denic.de")))))
+	assert.Equal(t, MessageFormatKV, DetectMessageFormat(sendAndReceive(conn, NewInfoDomainQuery("denic.de").EncodeKV())))
+
+	forcedConn, err := tls.Dial("tcp", localAddress(server), tlsClientConfig)
+	require.NoError(t, err)
+	defer forcedConn.Close()
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(sendAndReceive(forcedConn, NewLoginQuery("xml-user", "secret").EncodeKV())))
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(sendAndReceive(forcedConn, NewInfoDomainQuery("denic.de").EncodeKV())))
+	assert.Equal(t, MessageFormatXML, DetectMessageFormat(sendAndReceive(forcedConn, mustEncodeQueryXML(t, NewInfoDomainQuery("denic.de")))))
+}
+
+func TestServerKVAndXMLClients(t *testing.T) {
+	withMockRegistry(t, func(registry *MockRegistry, client1, client2 *Client) {
+		recordFormats := func(client *Client) *[]MessageFormat {
+			formats := new([]MessageFormat)
+			client.RawQueryPrinter = func(msg string, isOutgoing bool) {
+				*formats = append(*formats, DetectMessageFormat(msg))
+			}
+			return formats
+		}
+		kvFormats := recordFormats(client1)
+		client2.XMLMode = true
+		xmlFormats := recordFormats(client2)
+
+		domainData := createMockHandles(t, client1, 1000011)
+		requireMockSuccess(t, client1, NewCreateDomainQuery("dönic.de", domainData))
+
+		kvDomain, err := requireMockSuccess(t, client1, NewInfoDomainQuery("dönic.de")).DomainInfo()
+		require.NoError(t, err)
+		xmlDomain, err := requireMockSuccess(t, client2, NewInfoDomainQuery("dönic.de")).DomainInfo()
+		require.NoError(t, err)
+		assert.Equal(t, kvDomain, xmlDomain)
+
+		kvContact, err := requireMockSuccess(t, client1, NewInfoHandleQuery(domainData.HolderHandles[0])).ContactInfo()
+		require.NoError(t, err)
+		xmlContact, err := requireMockSuccess(t, client2, NewInfoHandleQuery(domainData.HolderHandles[0])).ContactInfo()
+		require.NoError(t, err)
+		assert.Equal(t, kvContact, xmlContact)
+
+		requireMockFailure(t, client2, NewInfoDomainQuery("denic.de"), MockMessageDomainNotFound)
+		requireMockSuccess(t, client2, NewCreateContactQuery(NewDenicHandle(1000022, "DUDE"), validContactData()))
+
+		// every query and response is sent in the format of the client
+		assert.Len(t, *kvFormats, 2*6)
+		for _, format := range *kvFormats {
+			assert.Equal(t, MessageFormatKV, format)
+		}
+		assert.Len(t, *xmlFormats, 2*4)
+		for _, format := range *xmlFormats {
+			assert.Equal(t, MessageFormatXML, format)
+		}
+	})
+}
+
+func newTestServer(t *testing.T, handler QueryHandler) *Server {
+	tlsConfig, err := NewMockTLSConfig()
+	require.NoError(t, err)
+	server, err := NewServer("localhost:0", tlsConfig)
+	require.NoError(t, err)
+	server.Handler = handler
+	return server
+}
+
+func runTestServer(server *Server) <-chan error {
+	runError := make(chan error, 1)
+	go func() {
+		runError <- server.Run()
+	}()
+	<-server.Ready()
+	return runError
+}
+
+func TestServerShutdown(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		if q.Action() == ActionCheck {
+			close(entered)
+			<-release
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	runError := runTestServer(server)
+	defer server.Close()
+
+	noRetry := NoRetryPolicy()
+	activeClient, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer activeClient.Close()
+	require.NoError(t, activeClient.Login("user", "secret"))
+	idleClient, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer idleClient.Close()
+	require.NoError(t, idleClient.Login("user", "secret"))
+
+	queryDone := make(chan error, 1)
+	go func() {
+		_, err := activeClient.SendQuery(NewCheckDomainQuery("denic.de"))
+		queryDone <- err
+	}()
+	<-entered
+
+	shutdownDone := make(chan error, 1)
+	go func() {
+		shutdownDone <- server.Shutdown(context.Background())
+	}()
+	select {
+	case <-shutdownDone:
+		t.Fatal("shutdown must wait for queries in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-shutdownDone)
+	assert.NoError(t, <-queryDone, "query in flight must be answered")
+	assert.NoError(t, <-runError)
+
+	// idle connections have been closed and no new connections are accepted
+	_, err = idleClient.SendQuery(NewInfoDomainQuery("denic.de"))
+	assert.Error(t, err)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		if q.Action() == ActionCheck {
+			close(entered)
+			<-release
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	runError := runTestServer(server)
+
+	noRetry := NoRetryPolicy()
+	client, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Login("user", "secret"))
+
+	queryDone := make(chan error, 1)
+	go func() {
+		_, err := client.SendQuery(NewCheckDomainQuery("denic.de"))
+		queryDone <- err
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Error(t, <-queryDone, "connection must be closed when the shutdown times out")
+	assert.NoError(t, <-runError)
+}
+
+func TestServerShutdownPartialQuery(t *testing.T) {
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	runError := runTestServer(server)
+	defer server.Close()
+
+	conn, err := tls.Dial("tcp", localAddress(server), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	msg := prepareMessage(NewCheckDomainQuery("denic.de").EncodeKV())
+	_, err = conn.Write(msg[:len(msg)/2])
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		server.connMutex.Lock()
+		defer server.connMutex.Unlock()
+		for sc := range server.connections {
+			if sc.active {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, time.Millisecond, "connection must be active as soon as a query starts to arrive")
+
+	shutdownDone := make(chan error, 1)
+	go func() {
+		shutdownDone <- server.Shutdown(context.Background())
+	}()
+	select {
+	case <-shutdownDone:
+		t.Fatal("shutdown must wait for queries that started to arrive")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the query is answered although it was completed during shutdown
+	_, err = conn.Write(msg[len(msg)/2:])
+	require.NoError(t, err)
+	responseMsg, err := readMessage(conn)
+	require.NoError(t, err)
+	response, err := ParseResponse(responseMsg)
+	require.NoError(t, err)
+	assert.True(t, response.IsSuccessful())
+	require.NoError(t, <-shutdownDone)
+	assert.NoError(t, <-runError)
+}
+
+func TestServerShutdownFaultDelay(t *testing.T) {
+	entered := make(chan struct{})
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		if q.Action() == ActionInfo {
+			close(entered)
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	server.FaultInjector = NewFaultInjector(Fault{Type: FaultDelay, Action: ActionInfo, Delay: time.Hour})
+	runError := runTestServer(server)
+	defer server.Close()
+
+	noRetry := NoRetryPolicy()
+	client, err := NewClient(localAddress(server), &ClientConfig{Insecure: true, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Login("user", "secret"))
+
+	queryDone := make(chan error, 1)
+	go func() {
+		_, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
+		queryDone <- err
+	}()
+	<-entered
+
+	// the delayed response is sent immediately on shutdown
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.NoError(t, <-queryDone)
+	assert.NoError(t, <-runError)
+}
+
+func TestMockServerDefaultHandler(t *testing.T) {
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		query := func(conn *tls.Conn, query *Query) *Response {
+			_, err := conn.Write(prepareMessage(query.EncodeKV()))
+			require.NoError(t, err)
+			msg, err := readMessage(conn)
+			require.NoError(t, err)
+			response, err := ParseResponse(msg)
+			require.NoError(t, err)
+			return response
+		}
+
+		conn, err := tls.Dial("tcp", server.Address(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// without a handler, queries succeed without authentication
+		assert.True(t, query(conn, NewInfoDomainQuery("denic.de")).IsSuccessful())
+		assert.False(t, query(conn, NewLoginQuery("DENIC-1000011-TEST", "wrong")).IsSuccessful())
+
+		// a handler is only called for authenticated sessions
+		server.SetHandler(func(user string, session *Session, q *Query) (*Response, error) {
+			return NewResponse(ResultSuccess, nil), nil
+		})
+		response := query(conn, NewInfoDomainQuery("denic.de"))
+		assert.False(t, response.IsSuccessful())
+		assert.Equal(t, []BusinessMessage{MessageLoginRequired}, response.ErrorMessages())
+		assert.True(t, query(conn, NewLoginQuery("DENIC-1000011-TEST", "secret")).IsSuccessful())
+		assert.True(t, query(conn, NewInfoDomainQuery("denic.de")).IsSuccessful())
+	})
+}
+
+func TestServerConnectionErrors(t *testing.T) {
+	server := newTestServer(t, func(s *Session, q *Query) (*Response, error) {
+		switch q.Action() {
+		case ActionLogout:
+			return nil, ErrCloseConnection
+		case ActionCheck:
+			return nil, fmt.Errorf("handler failed")
+		}
+		return NewResponse(ResultSuccess, nil), nil
+	})
+	connErrors := make(chan error, 10)
+	server.ConnectionErrorHandler = func(remoteAddr net.Addr, err error) {
+		connErrors <- err
+	}
+	server.ReadTimeout = 100 * time.Millisecond
+	server.IdleTimeout = 200 * time.Millisecond
+	runTestServer(server)
+	defer server.Close()
+
+	dial := func() *tls.Conn {
+		conn, err := tls.Dial("tcp", localAddress(server), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		return conn
+	}
+	waitClosed := func(conn *tls.Conn) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := readMessage(conn)
+		require.ErrorIs(t, err, io.EOF)
+	}
+
+	// closing the connection regularly is not reported
+	conn := dial()
+	conn.Write(prepareMessage(NewLogoutQuery().EncodeKV()))
+	waitClosed(conn)
+
+	// idle connections are closed silently
+	conn = dial()
+	waitClosed(conn)
+
+	// errors of the query handler are reported
+	conn = dial()
+	conn.Write(prepareMessage(NewCheckDomainQuery("denic.de").EncodeKV()))
+	waitClosed(conn)
+	assert.EqualError(t, <-connErrors, "handler failed")
+
+	// incomplete queries are aborted after the read timeout
+	conn = dial()
+	conn.Write([]byte{0, 0, 0, 42, 'v'})
+	waitClosed(conn)
+	assert.ErrorIs(t, <-connErrors, os.ErrDeadlineExceeded)
+
+	assert.Empty(t, connErrors)
+}
@@ -0,0 +1,82 @@
+package rri
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// ErrPinMismatch is returned when the server certificate chain does not contain any of the pinned public keys.
+var ErrPinMismatch = fmt.Errorf("server certificate does not match any pinned public key")
+
+// SPKIHash returns the base64 encoded SHA-256 hash of the certificate's SubjectPublicKeyInfo as used for public key pinning.
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// newClientTLSConfig returns the TLS configuration for a client as denoted by the given config.
+func newClientTLSConfig(conf ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         conf.MinTLSVersion,
+		InsecureSkipVerify: conf.Insecure,
+		ServerName:         conf.ServerName,
+		RootCAs:            conf.RootCAs,
+		Certificates:       conf.ClientCertificates,
+	}
+
+	if len(conf.RootCAFiles) > 0 {
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		} else {
+			// do not modify the pool of the caller
+			tlsConfig.RootCAs = tlsConfig.RootCAs.Clone()
+		}
+		for _, file := range conf.RootCAFiles {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read root CA file: %s", err.Error())
+			}
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in root CA file %q", file)
+			}
+		}
+	}
+
+	if len(conf.ClientCertFile) > 0 || len(conf.ClientKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(conf.ClientCertFile, conf.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err.Error())
+		}
+		tlsConfig.Certificates = append(append([]tls.Certificate{}, tlsConfig.Certificates...), cert)
+	}
+
+	if len(conf.PinnedPublicKeys) > 0 {
+		pins := make(map[string]bool)
+		for _, pin := range conf.PinnedPublicKeys {
+			pins[pin] = true
+		}
+		// pins are also checked for insecure connections to allow pinning self-signed certificates
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			// only verified chains are trusted, additional certificates sent by the server could be chosen arbitrarily
+			chains := state.VerifiedChains
+			if conf.Insecure && len(state.PeerCertificates) > 0 {
+				// without verification only the leaf certificate is proven to belong to the server
+				chains = [][]*x509.Certificate{state.PeerCertificates[:1]}
+			}
+			for _, chain := range chains {
+				for _, cert := range chain {
+					if pins[SPKIHash(cert)] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+
+	return tlsConfig, nil
+}
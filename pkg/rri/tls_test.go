@@ -0,0 +1,215 @@
+package rri
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// newTestCertificate creates a certificate signed by parent, or a self-signed CA if parent is nil, and writes it to dir.
+func newTestCertificate(t *testing.T, dir, name string, parent *testCertificate, dnsNames ...string) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	c := &testCertificate{cert, key, filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")}
+	require.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600))
+	return c
+}
+
+// withTLSTestServer runs a server that requires client certificates signed by ca.
+func withTLSTestServer(t *testing.T, serverCert tls.Certificate, ca *testCertificate, f func(address string)) {
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server, err := NewServer("localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	require.NoError(t, err)
+	server.Handler = func(session *Session, query *Query) (*Response, error) {
+		return NewResponse(ResultSuccess, nil), nil
+	}
+	go server.Run()
+	defer server.Close()
+
+	f(fmt.Sprintf("localhost:%d", server.listener.Addr().(*net.TCPAddr).Port))
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca, "localhost", "rri.test")
+	clientCert := newTestCertificate(t, dir, "client", ca)
+
+	withTLSTestServer(t, serverCert.tlsCertificate(), ca, func(address string) {
+		client, err := NewClient(address, &ClientConfig{
+			RootCAFiles:    []string{ca.certFile},
+			ClientCertFile: clientCert.certFile,
+			ClientKeyFile:  clientCert.keyFile,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+
+		// the server certificate is not trusted by the system pool
+		_, err = NewClient(address, &ClientConfig{ClientCertificates: []tls.Certificate{clientCert.tlsCertificate()}})
+		assert.True(t, IsCertificateError(err))
+
+		// the server rejects connections without client certificate
+		client, err = NewClient(address, &ClientConfig{RootCAFiles: []string{ca.certFile}})
+		if err == nil {
+			defer client.Close()
+			client.NoAutoRetry = true
+			err = client.Login("DENIC-1000011-TEST", "secret")
+		}
+		assert.Error(t, err)
+	})
+}
+
+func TestClientServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca, "rri.test")
+	clientCert := newTestCertificate(t, dir, "client", ca)
+
+	withTLSTestServer(t, serverCert.tlsCertificate(), ca, func(address string) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+
+		_, err := NewClient(address, &ClientConfig{RootCAs: roots, ClientCertificates: []tls.Certificate{clientCert.tlsCertificate()}})
+		assert.True(t, IsCertificateError(err))
+
+		client, err := NewClient(address, &ClientConfig{RootCAs: roots, ClientCertificates: []tls.Certificate{clientCert.tlsCertificate()}, ServerName: "rri.test"})
+		require.NoError(t, err)
+		client.Close()
+	})
+}
+
+func TestClientPinnedPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca, "localhost")
+	clientCert := newTestCertificate(t, dir, "client", ca)
+	otherCert := newTestCertificate(t, dir, "other", nil)
+
+	withTLSTestServer(t, serverCert.tlsCertificate(), ca, func(address string) {
+		conf := ClientConfig{
+			RootCAFiles:        []string{ca.certFile},
+			ClientCertificates: []tls.Certificate{clientCert.tlsCertificate()},
+		}
+
+		conf.PinnedPublicKeys = []string{SPKIHash(otherCert.cert)}
+		_, err := NewClient(address, &conf)
+		assert.ErrorIs(t, err, ErrPinMismatch)
+
+		conf.PinnedPublicKeys = []string{SPKIHash(otherCert.cert), SPKIHash(serverCert.cert)}
+		client, err := NewClient(address, &conf)
+		require.NoError(t, err)
+		client.Close()
+
+		// pinning the CA key also accepts the server certificate
+		conf.PinnedPublicKeys = []string{SPKIHash(ca.cert)}
+		client, err = NewClient(address, &conf)
+		require.NoError(t, err)
+		client.Close()
+	})
+}
+
+func TestClientPinnedPublicKeysUnverifiedChain(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca, "localhost")
+	clientCert := newTestCertificate(t, dir, "client", ca)
+	otherCert := newTestCertificate(t, dir, "other", nil)
+
+	// the server sends the pinned certificate as additional chain element that is not part of the verified chain
+	chain := serverCert.tlsCertificate()
+	chain.Certificate = append(chain.Certificate, otherCert.cert.Raw)
+	withTLSTestServer(t, chain, ca, func(address string) {
+		conf := ClientConfig{
+			RootCAFiles:        []string{ca.certFile},
+			ClientCertificates: []tls.Certificate{clientCert.tlsCertificate()},
+			PinnedPublicKeys:   []string{SPKIHash(otherCert.cert)},
+		}
+		_, err := NewClient(address, &conf)
+		assert.ErrorIs(t, err, ErrPinMismatch)
+
+		// without verification only the leaf certificate is compared
+		conf.Insecure = true
+		_, err = NewClient(address, &conf)
+		assert.ErrorIs(t, err, ErrPinMismatch)
+
+		conf.PinnedPublicKeys = []string{SPKIHash(ca.cert)}
+		_, err = NewClient(address, &conf)
+		assert.ErrorIs(t, err, ErrPinMismatch)
+
+		conf.PinnedPublicKeys = []string{SPKIHash(serverCert.cert)}
+		client, err := NewClient(address, &conf)
+		require.NoError(t, err)
+		client.Close()
+	})
+}
+
+func TestClientConfigInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("no certificate"), 0600))
+
+	_, err := NewClient("localhost", &ClientConfig{RootCAFiles: []string{filepath.Join(dir, "missing.pem")}})
+	assert.Error(t, err)
+	_, err = NewClient("localhost", &ClientConfig{RootCAFiles: []string{emptyFile}})
+	assert.Error(t, err)
+	_, err = NewClient("localhost", &ClientConfig{ClientCertFile: emptyFile, ClientKeyFile: emptyFile})
+	assert.Error(t, err)
+}
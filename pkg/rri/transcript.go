@@ -0,0 +1,240 @@
+package rri
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// TranscriptDirectionQuery denotes a message sent by the client.
+	TranscriptDirectionQuery TranscriptDirection = "query"
+	// TranscriptDirectionResponse denotes a message received by the client.
+	TranscriptDirectionResponse TranscriptDirection = "response"
+)
+
+// TranscriptDirection denotes whether a transcript entry has been sent or received by the client.
+type TranscriptDirection string
+
+// TranscriptEntry represents a single raw message of a recorded conversation.
+type TranscriptEntry struct {
+	Direction TranscriptDirection `json:"direction"`
+	Message   string              `json:"message"`
+}
+
+// ReadTranscript reads all entries of a transcript as written by TranscriptWriter.
+func ReadTranscript(r io.Reader) ([]TranscriptEntry, error) {
+	entries := make([]TranscriptEntry, 0)
+	decoder := json.NewDecoder(r)
+	for {
+		var entry TranscriptEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("failed to read transcript entry %d: %w", len(entries)+1, err)
+		}
+		if entry.Direction != TranscriptDirectionQuery && entry.Direction != TranscriptDirectionResponse {
+			return nil, fmt.Errorf("invalid direction %q of transcript entry %d", entry.Direction, len(entries)+1)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// TranscriptWriter records all messages exchanged by a client as JSON lines. Passwords and AuthInfo values are censored
+// using CensorRawMessage.
+//
+// A TranscriptWriter is safe for concurrent use.
+type TranscriptWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewTranscriptWriter returns a TranscriptWriter that writes to w.
+func NewTranscriptWriter(w io.Writer) *TranscriptWriter {
+	return &TranscriptWriter{encoder: json.NewEncoder(w)}
+}
+
+// Write appends a single message to the transcript.
+func (tw *TranscriptWriter) Write(direction TranscriptDirection, msg string) error {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if err := tw.encoder.Encode(TranscriptEntry{direction, CensorRawMessage(msg)}); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// Dialer wraps the given dialer to record all messages sent and received on its connections. Uses the default TLS
+// dialer if dialer is nil. Set the result as ClientConfig.TLSDialContextHandler:
+//
+//	recorder := rri.NewTranscriptWriter(file)
+//	client, err := rri.NewClient(address, &rri.ClientConfig{TLSDialContextHandler: recorder.Dialer(nil)})
+//
+// Failing to write the transcript fails the current query.
+func (tw *TranscriptWriter) Dialer(dialer TLSContextDialer) TLSContextDialer {
+	if dialer == nil {
+		dialer = dialTLS
+	}
+	return func(ctx context.Context, network, addr string, config *tls.Config) (TLSConnection, error) {
+		conn, err := dialer(ctx, network, addr, config)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingConn{TLSConnection: conn, transcript: tw}, nil
+	}
+}
+
+// recordingConn passes all complete frames written to and read from the connection to the transcript.
+type recordingConn struct {
+	TLSConnection
+	transcript        *TranscriptWriter
+	written, received []byte
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	// record queries before sending, so that failing to record does not leave a sent query unrecorded
+	var msgs []string
+	msgs, c.written = splitFrames(append(c.written, p...))
+	for _, msg := range msgs {
+		if err := c.transcript.Write(TranscriptDirectionQuery, msg); err != nil {
+			return 0, err
+		}
+	}
+	return c.TLSConnection.Write(p)
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.TLSConnection.Read(p)
+	var msgs []string
+	msgs, c.received = splitFrames(append(c.received, p[:n]...))
+	for _, msg := range msgs {
+		if recordErr := c.transcript.Write(TranscriptDirectionResponse, msg); recordErr != nil {
+			return n, recordErr
+		}
+	}
+	return n, err
+}
+
+// splitFrames returns the messages of all complete frames in the buffer and the remaining bytes.
+func splitFrames(buffer []byte) ([]string, []byte) {
+	var msgs []string
+	for len(buffer) >= 4 {
+		length := binary.BigEndian.Uint32(buffer[0:4])
+		if uint64(len(buffer)-4) < uint64(length) {
+			break
+		}
+		msgs = append(msgs, string(buffer[4:4+length]))
+		buffer = buffer[4+length:]
+	}
+	return msgs, buffer
+}
+
+// TranscriptReplayer serves the responses of a recorded transcript without connecting to a server. Every query sent
+// must match the next recorded query after censoring passwords, otherwise ErrTranscriptMismatch is returned. The
+// responses recorded after a query are returned in order. A conversation can span multiple connections.
+//
+// Disable retries when replaying, as retried queries are not part of the transcript.
+type TranscriptReplayer struct {
+	mutex    sync.Mutex
+	entries  []TranscriptEntry
+	position int
+}
+
+// NewTranscriptReplayer returns a TranscriptReplayer for the given entries as returned by ReadTranscript.
+func NewTranscriptReplayer(entries []TranscriptEntry) *TranscriptReplayer {
+	return &TranscriptReplayer{entries: entries}
+}
+
+// DialContext returns a new connection that replays the transcript. It can be used as
+// ClientConfig.TLSDialContextHandler. All parameters are ignored.
+func (r *TranscriptReplayer) DialContext(ctx context.Context, network, addr string, config *tls.Config) (TLSConnection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &replayConn{replayer: r}, nil
+}
+
+// Remaining returns the number of entries that have not been replayed yet.
+func (r *TranscriptReplayer) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.entries) - r.position
+}
+
+// replay checks the query against the next recorded query and returns the recorded responses.
+func (r *TranscriptReplayer) replay(query string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.position >= len(r.entries) {
+		return nil, fmt.Errorf("%w: transcript has no more entries", ErrTranscriptMismatch)
+	}
+	expected := r.entries[r.position]
+	if expected.Direction != TranscriptDirectionQuery {
+		return nil, fmt.Errorf("%w: expected response at entry %d", ErrTranscriptMismatch, r.position+1)
+	}
+	if actual := CensorRawMessage(query); actual != expected.Message {
+		return nil, fmt.Errorf("%w: entry %d expected\n%s\nbut got\n%s", ErrTranscriptMismatch, r.position+1, expected.Message, actual)
+	}
+	r.position++
+
+	var responses []string
+	for r.position < len(r.entries) && r.entries[r.position].Direction == TranscriptDirectionResponse {
+		responses = append(responses, r.entries[r.position].Message)
+		r.position++
+	}
+	return responses, nil
+}
+
+// replayConn answers complete frames written to it with the recorded responses. Reads return io.EOF if no response is
+// pending, as the recorded server did not send anything either.
+type replayConn struct {
+	replayer        *TranscriptReplayer
+	written, unread []byte
+	closed          bool
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	var msgs []string
+	msgs, c.written = splitFrames(append(c.written, p...))
+	for _, msg := range msgs {
+		responses, err := c.replayer.replay(msg)
+		if err != nil {
+			return 0, err
+		}
+		for _, response := range responses {
+			c.unread = append(c.unread, prepareMessage(response)...)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(c.unread) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.unread)
+	c.unread = c.unread[n:]
+	return n, nil
+}
+
+func (c *replayConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *replayConn) SetDeadline(t time.Time) error {
+	return nil
+}
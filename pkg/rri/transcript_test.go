@@ -0,0 +1,104 @@
+package rri
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriptRecordAndReplay(t *testing.T) {
+	var transcript bytes.Buffer
+	recorder := NewTranscriptWriter(&transcript)
+
+	var recordedResponse *Response
+	mustWithMockServer(func(server *MockServer) {
+		server.AddUser("DENIC-1000011-TEST", "secret")
+		server.Handler = func(user string, session *Session, query *Query) (*Response, error) {
+			return NewResponse(ResultSuccess, nil).WithField(ResponseFieldNameDomainIDN, query.FirstField(QueryFieldNameDomainIDN)), nil
+		}
+
+		client, err := NewClient(server.Address(), &ClientConfig{Insecure: true, TLSDialContextHandler: recorder.Dialer(nil)})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Login("DENIC-1000011-TEST", "secret"))
+		recordedResponse, err = client.SendQuery(NewInfoDomainQuery("denic.de"))
+		require.NoError(t, err)
+		_, err = client.SendQuery(NewChangeProviderQuery("denic.de", "a-secret-auth-info", DomainData{}))
+		require.NoError(t, err)
+	})
+
+	assert.NotContains(t, transcript.String(), "secret")
+	entries, err := ReadTranscript(strings.NewReader(transcript.String()))
+	require.NoError(t, err)
+	require.Len(t, entries, 7)
+	assert.Equal(t, TranscriptEntry{TranscriptDirectionQuery, CensorRawMessage(NewLoginQuery("DENIC-1000011-TEST", "secret").EncodeKV())}, entries[0])
+	assert.Equal(t, TranscriptDirectionResponse, entries[1].Direction)
+	assert.Equal(t, TranscriptEntry{TranscriptDirectionQuery, NewInfoDomainQuery("denic.de").EncodeKV()}, entries[2])
+	assert.Equal(t, TranscriptDirectionResponse, entries[3].Direction)
+	assert.Equal(t, TranscriptEntry{TranscriptDirectionQuery, CensorRawMessage(NewChangeProviderQuery("denic.de", "a-secret-auth-info", DomainData{}).EncodeKV())}, entries[4])
+	assert.Equal(t, TranscriptDirectionResponse, entries[5].Direction)
+	// the server closes the connection on LOGOUT without response
+	assert.Equal(t, TranscriptEntry{TranscriptDirectionQuery, NewLogoutQuery().EncodeKV()}, entries[6])
+
+	// replay the conversation without a server
+	replayer := NewTranscriptReplayer(entries)
+	noRetry := NoRetryPolicy()
+	client, err := NewClient("replay", &ClientConfig{TLSDialContextHandler: replayer.DialContext, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	require.NoError(t, client.Login("DENIC-1000011-TEST", "another-secret"))
+	response, err := client.SendQuery(NewInfoDomainQuery("denic.de"))
+	require.NoError(t, err)
+	assert.Equal(t, recordedResponse, response)
+	// the AuthInfo is not compared as it is censored in the transcript
+	_, err = client.SendQuery(NewChangeProviderQuery("denic.de", "another-auth-info", DomainData{}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayer.Remaining())
+	require.NoError(t, client.Close())
+	assert.Zero(t, replayer.Remaining())
+}
+
+func TestTranscriptReplayMismatch(t *testing.T) {
+	replayer := NewTranscriptReplayer([]TranscriptEntry{
+		{TranscriptDirectionQuery, CensorRawMessage(NewLoginQuery("DENIC-1000011-TEST", "secret").EncodeKV())},
+		{TranscriptDirectionResponse, NewResponse(ResultSuccess, nil).EncodeKV()},
+		{TranscriptDirectionQuery, NewCheckDomainQuery("denic.de").EncodeKV()},
+		{TranscriptDirectionResponse, NewResponse(ResultSuccess, nil).EncodeKV()},
+	})
+	noRetry := NoRetryPolicy()
+	client, err := NewClient("replay", &ClientConfig{TLSDialContextHandler: replayer.DialContext, RetryPolicy: &noRetry})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// the password is not compared as it is censored in the transcript
+	require.NoError(t, client.Login("DENIC-1000011-TEST", "another-secret"))
+	_, err = client.SendQuery(NewCheckDomainQuery("denic.com"))
+	assert.ErrorIs(t, err, ErrTranscriptMismatch)
+	assert.Equal(t, 2, replayer.Remaining())
+}
+
+func TestTranscriptCensorMixedCase(t *testing.T) {
+	var transcript bytes.Buffer
+	recorder := NewTranscriptWriter(&transcript)
+	require.NoError(t, recorder.Write(TranscriptDirectionQuery, "version: 5.0\nPassword: first-secret\nAUTHINFO: second-secret\nauthInfo: third-secret\nPassWord:\ndomain: denic.de"))
+
+	assert.NotContains(t, transcript.String(), "secret")
+	entries, err := ReadTranscript(strings.NewReader(transcript.String()))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "version: 5.0\nPassword: ******\nAUTHINFO: ******\nauthInfo: ******\nPassWord:\ndomain: denic.de", entries[0].Message)
+}
+
+func TestReadTranscriptErrors(t *testing.T) {
+	_, err := ReadTranscript(strings.NewReader(`{"direction":"query","message":"version: 5.0"}` + "\n" + `{"direction":"unknown"}`))
+	assert.ErrorContains(t, err, "entry 2")
+
+	_, err = ReadTranscript(strings.NewReader(`{"direction":`))
+	assert.Error(t, err)
+
+	entries, err := ReadTranscript(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -19,9 +19,9 @@ type VerificationInformation struct {
 	TrustFramework        TrustFramework
 }
 
-func (verificationInformation *VerificationInformation) PutToQueryFields(fields *QueryFieldList) {
-	fields.Add(QueryFieldNameEntity, QueryEntityVerificationInformation.String())
-
+// QueryEntity returns the verification information as query entity.
+func (verificationInformation *VerificationInformation) QueryEntity() QueryEntity {
+	fields := NewQueryFieldList()
 	verifiedClaimSlice := make([]string, len(verificationInformation.VerifiedClaim))
 	for i := range verificationInformation.VerifiedClaim {
 		verifiedClaimSlice[i] = string(verificationInformation.VerifiedClaim[i])
@@ -34,6 +34,73 @@ func (verificationInformation *VerificationInformation) PutToQueryFields(fields
 	fields.Add(QueryFieldNameVerificationEvidence, string(verificationInformation.VerificationEvidence))
 	fields.Add(QueryFieldNameVerificationMethod, string(verificationInformation.VerificationMethod))
 	fields.Add(QueryFieldNameTrustFramework, string(verificationInformation.TrustFramework))
+	return QueryEntity{QueryEntityVerificationInformation, fields}
+}
+
+// PutToQueryFields appends the verification information as entity marker followed by its fields.
+//
+// Deprecated: The entity is only recognized if the fields are passed to NewQuery. Use QueryEntity and Query.WithEntity
+// instead.
+func (verificationInformation *VerificationInformation) PutToQueryFields(fields *QueryFieldList) {
+	entity := verificationInformation.QueryEntity()
+	fields.Add(QueryFieldNameEntity, entity.name.String())
+	entity.fields.CopyTo(fields)
+}
+
+// ExtractVerificationInformation extracts the VerificationInformation entities from the Query.
+func (q *Query) ExtractVerificationInformation() ([]*VerificationInformation, error) {
+	var verificationInformation []*VerificationInformation
+	for _, eachEntity := range q.Entities() {
+		if eachEntity.Name().Normalize() == QueryEntityVerificationInformation.Normalize() {
+			extractedVerificationInformation, extractErr := eachEntity.ExtractVerificationInformation()
+			if extractErr != nil {
+				return nil, extractErr
+			}
+			verificationInformation = append(verificationInformation, extractedVerificationInformation)
+		}
+	}
+	return verificationInformation, nil
+}
+
+// ExtractVerificationInformation extracts the VerificationInformation from a QueryEntity. In contrast to responses,
+// the optional fields reference, evidence, method and trust framework might be empty.
+func (e *QueryEntity) ExtractVerificationInformation() (*VerificationInformation, error) {
+	var err error
+	verificationInformation := &VerificationInformation{
+		VerificationReference: e.FirstField(QueryFieldNameVerificationReference),
+	}
+
+	for _, claim := range e.Field(QueryFieldNameVerifiedClaim) {
+		verificationClaim, claimErr := ParseVerificationClaim(claim)
+		if claimErr != nil {
+			return nil, claimErr
+		}
+		verificationInformation.VerifiedClaim = append(verificationInformation.VerifiedClaim, verificationClaim)
+	}
+
+	timestamp := e.FirstField(QueryFieldNameVerificationTimestamp)
+	if verificationInformation.VerificationTimestamp, err = time.Parse(VerificationInformationTimestampFormat, timestamp); err != nil {
+		return nil, fmt.Errorf("error while parsing verification timestamp %v: %v", timestamp, err)
+	}
+	if verificationInformation.VerificationResult, err = ParseVerificationResult(e.FirstField(QueryFieldNameVerificationResult)); err != nil {
+		return nil, err
+	}
+	if value := e.FirstField(QueryFieldNameVerificationEvidence); len(value) > 0 {
+		if verificationInformation.VerificationEvidence, err = ParseVerificationEvidence(value); err != nil {
+			return nil, err
+		}
+	}
+	if value := e.FirstField(QueryFieldNameVerificationMethod); len(value) > 0 {
+		if verificationInformation.VerificationMethod, err = ParseVerificationMethod(value); err != nil {
+			return nil, err
+		}
+	}
+	if value := e.FirstField(QueryFieldNameTrustFramework); len(value) > 0 {
+		if verificationInformation.TrustFramework, err = ParseTrustFramework(value); err != nil {
+			return nil, err
+		}
+	}
+	return verificationInformation, nil
 }
 
 type VerificationResult string
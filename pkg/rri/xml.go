@@ -0,0 +1,1034 @@
+package rri
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	xmlNamespaceGlobal      = "http://registry.denic.de/global/5.0"
+	xmlNamespaceTransaction = "http://registry.denic.de/transaction/5.0"
+	xmlNamespaceDomain      = "http://registry.denic.de/domain/5.0"
+	xmlNamespaceContact     = "http://registry.denic.de/contact/5.0"
+	xmlNamespaceDNSEntry    = "http://registry.denic.de/dnsentry/5.0"
+	xmlNamespaceMsg         = "http://registry.denic.de/msg/5.0"
+	xmlNamespaceXSI         = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// xmlNamespacePrefixes lists the prefixes used for encoding in the order of declaration. The global namespace is the
+// default namespace.
+var xmlNamespacePrefixes = []struct{ space, prefix string }{
+	{xmlNamespaceGlobal, ""},
+	{xmlNamespaceTransaction, "tr"},
+	{xmlNamespaceDomain, "domain"},
+	{xmlNamespaceContact, "contact"},
+	{xmlNamespaceDNSEntry, "dnsentry"},
+	{xmlNamespaceMsg, "msg"},
+	{xmlNamespaceXSI, "xsi"},
+}
+
+// xmlFieldMapping maps a key-value field name to an element or attribute name of the XML schema.
+type xmlFieldMapping struct {
+	field string
+	local string
+}
+
+var (
+	xmlLoginFields = []xmlFieldMapping{
+		{string(QueryFieldNameUser), "user"},
+		{string(QueryFieldNamePassword), "password"},
+	}
+	xmlQueryAttributes = []xmlFieldMapping{
+		{string(QueryFieldNameDisconnect), "disconnect"},
+		{string(QueryFieldNameMsgID), "msgid"},
+		{string(QueryFieldNameMsgType), "msgType"},
+	}
+	xmlDomainFields = []xmlFieldMapping{
+		{string(QueryFieldNameDomainIDN), "handle"},
+		{string(QueryFieldNameDomainACE), "ace"},
+		{string(ResponseFieldNameStatus), "status"},
+		{string(ResponseFieldNameRegAccID), "regAccId"},
+		{string(ResponseFieldNameRegAccName), "regAccName"},
+	}
+	xmlDomainTrailingFields = []xmlFieldMapping{
+		{string(QueryFieldNameAuthInfo), "authInfo"},
+		{string(QueryFieldNameAuthInfoHash), "authInfoHash"},
+		{string(QueryFieldNameAuthInfoExpire), "authInfoExpire"},
+		{string(ResponseFieldNameChanged), "changed"},
+	}
+	xmlContactRoles = []string{
+		string(QueryFieldNameHolder),
+		string(QueryFieldNameAbuseContact),
+		string(QueryFieldNameGeneralRequest),
+	}
+	xmlContactFields = []xmlFieldMapping{
+		{string(QueryFieldNameHandle), "handle"},
+		{string(QueryFieldNameType), "type"},
+		{string(QueryFieldNameName), "name"},
+		{string(QueryFieldNameOrganisation), "organisation"},
+	}
+	xmlPostalFields = []xmlFieldMapping{
+		{string(QueryFieldNameAddress), "address"},
+		{string(QueryFieldNamePostalCode), "postalCode"},
+		{string(QueryFieldNameCity), "city"},
+		{string(QueryFieldNameCountryCode), "countryCode"},
+	}
+	xmlContactTrailingFields = []xmlFieldMapping{
+		{string(QueryFieldNamePhone), "phone"},
+		{string(QueryFieldNameEMail), "email"},
+		{string(ResponseFieldNameStatus), "status"},
+		{string(ResponseFieldNameChanged), "changed"},
+	}
+	xmlVerificationFields = []xmlFieldMapping{
+		{string(QueryFieldNameVerifiedClaim), "verifiedClaim"},
+		{string(QueryFieldNameVerificationResult), "verificationResult"},
+		{string(QueryFieldNameVerificationReference), "verificationReference"},
+		{string(QueryFieldNameVerificationTimestamp), "verificationTimestamp"},
+		{string(QueryFieldNameVerificationEvidence), "verificationEvidence"},
+		{string(QueryFieldNameVerificationMethod), "verificationMethod"},
+		{string(QueryFieldNameTrustFramework), "trustFramework"},
+	}
+	xmlQueueMessageAttributes = []xmlFieldMapping{
+		{string(ResponseFieldNameMsgID), "msgid"},
+		{string(ResponseFieldNameMsgType), "msgType"},
+		{string(ResponseFieldNameMsgTime), "msgTime"},
+	}
+	xmlQueuePayloadFields = []xmlFieldMapping{
+		{string(ResponseFieldNameDomainIDN), "domain"},
+		{string(ResponseFieldNameDomainACE), "ace"},
+		{string(ResponseFieldNameRegAccID), "regAccId"},
+		{string(ResponseFieldNameExpire), "expire"},
+	}
+)
+
+// xmlQueryActions maps actions to the element names of the XML schema. Actions on domains and handles share the
+// element name and differ in the namespace.
+var xmlQueryActions = map[QueryAction]string{
+	ActionLogin:           "login",
+	ActionLogout:          "logout",
+	ActionCheck:           "check",
+	ActionInfo:            "info",
+	ActionCreate:          "create",
+	ActionUpdate:          "update",
+	ActionChangeHolder:    "chholder",
+	ActionDelete:          "delete",
+	ActionRestore:         "restore",
+	ActionTransit:         "transit",
+	ActionCreateAuthInfo1: "createAuthInfo1",
+	ActionCreateAuthInfo2: "createAuthInfo2",
+	ActionChangeProvider:  "chprov",
+	ActionQueueRead:       "queue-read",
+	ActionQueueDelete:     "delete",
+}
+
+// xmlActionNamespace returns the namespace of the action element for the given action and object.
+func xmlActionNamespace(action QueryAction, object QueryObject) string {
+	switch action {
+	case ActionLogin, ActionLogout:
+		return xmlNamespaceGlobal
+	case ActionQueueRead, ActionQueueDelete:
+		return xmlNamespaceMsg
+	case ActionCheck, ActionInfo, ActionCreate, ActionUpdate:
+		if object == QueryObjectHandle {
+			return xmlNamespaceContact
+		}
+	}
+	return xmlNamespaceDomain
+}
+
+// xmlQueryAction returns the action denoted by an action element.
+func xmlQueryAction(name xml.Name) (QueryAction, bool) {
+	for action, local := range xmlQueryActions {
+		if local != name.Local {
+			continue
+		}
+		if name.Space == xmlActionNamespace(action, QueryObjectDomain) || name.Space == xmlActionNamespace(action, QueryObjectHandle) {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// xmlElement is a minimal document tree to translate between key-value fields and the XML schema.
+type xmlElement struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*xmlElement
+}
+
+func newXMLElement(space, local string) *xmlElement {
+	return &xmlElement{name: xml.Name{Space: space, Local: local}}
+}
+
+// addChild appends a new child element and returns it.
+func (e *xmlElement) addChild(space, local, text string) *xmlElement {
+	child := newXMLElement(space, local)
+	child.text = text
+	e.children = append(e.children, child)
+	return child
+}
+
+func (e *xmlElement) setAttr(space, local, value string) *xmlElement {
+	e.attrs = append(e.attrs, xml.Attr{Name: xml.Name{Space: space, Local: local}, Value: value})
+	return e
+}
+
+// attr returns the value of the attribute with the given local name or an empty string.
+func (e *xmlElement) attr(local string) string {
+	for _, attr := range e.attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the given name or nil.
+func (e *xmlElement) child(space, local string) *xmlElement {
+	for _, child := range e.children {
+		if child.name.Space == space && child.name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+func (e *xmlElement) value() string {
+	return strings.TrimSpace(e.text)
+}
+
+func (e *xmlElement) is(space, local string) bool {
+	return e.name.Space == space && e.name.Local == local
+}
+
+// encode returns the document with e as root element. All used namespaces are declared at the root element.
+func (e *xmlElement) encode() string {
+	used := make(map[string]bool)
+	e.collectNamespaces(used)
+	var declarations []xml.Attr
+	for _, ns := range xmlNamespacePrefixes {
+		if !used[ns.space] {
+			continue
+		}
+		if len(ns.prefix) == 0 {
+			declarations = append(declarations, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: ns.space})
+		} else {
+			declarations = append(declarations, xml.Attr{Name: xml.Name{Local: "xmlns:" + ns.prefix}, Value: ns.space})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	e.write(&sb, 0, declarations)
+	return sb.String()
+}
+
+func (e *xmlElement) collectNamespaces(used map[string]bool) {
+	used[e.name.Space] = true
+	for _, attr := range e.attrs {
+		if len(attr.Name.Space) > 0 {
+			used[attr.Name.Space] = true
+		}
+	}
+	for _, child := range e.children {
+		child.collectNamespaces(used)
+	}
+}
+
+func (e *xmlElement) write(sb *strings.Builder, depth int, declarations []xml.Attr) {
+	indent := strings.Repeat("\t", depth)
+	sb.WriteString(indent + "<" + xmlQualifiedName(e.name))
+	for _, attr := range append(declarations, e.attrs...) {
+		sb.WriteString(" " + xmlQualifiedName(attr.Name) + "=\"")
+		xml.EscapeText(sb, []byte(attr.Value))
+		sb.WriteString("\"")
+	}
+
+	if len(e.children) == 0 {
+		if len(e.text) == 0 {
+			sb.WriteString("/>")
+			return
+		}
+		sb.WriteString(">")
+		xml.EscapeText(sb, []byte(e.text))
+		sb.WriteString("</" + xmlQualifiedName(e.name) + ">")
+		return
+	}
+
+	sb.WriteString(">\n")
+	for _, child := range e.children {
+		child.write(sb, depth+1, nil)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(indent + "</" + xmlQualifiedName(e.name) + ">")
+}
+
+func xmlQualifiedName(name xml.Name) string {
+	for _, ns := range xmlNamespacePrefixes {
+		if ns.space == name.Space && len(ns.prefix) > 0 {
+			return ns.prefix + ":" + name.Local
+		}
+	}
+	return name.Local
+}
+
+// parseXMLElement parses a document and returns its root element with resolved namespaces.
+func parseXMLElement(str string) (*xmlElement, error) {
+	decoder := xml.NewDecoder(strings.NewReader(str))
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &xmlElement{name: t.Name}
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "xmlns" && !(len(attr.Name.Space) == 0 && attr.Name.Local == "xmlns") {
+					e.attrs = append(e.attrs, attr)
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("root element is missing")
+	}
+	return root, nil
+}
+
+// xmlFields provides the key-value fields of a query or response to the encoder and keeps track of the fields that
+// have been encoded.
+type xmlFields struct {
+	values  func(name string) []string
+	names   []string
+	encoded map[string]bool
+}
+
+func newXMLQueryFields(list QueryFieldList) *xmlFields {
+	names := make([]string, len(list))
+	for i, f := range list {
+		names[i] = string(f.Name)
+	}
+	values := func(name string) []string {
+		return list.Values(QueryFieldName(name))
+	}
+	return &xmlFields{values, names, make(map[string]bool)}
+}
+
+func newXMLResponseFields(list ResponseFieldList) *xmlFields {
+	names := make([]string, len(list))
+	for i, f := range list {
+		names[i] = string(f.Name)
+	}
+	values := func(name string) []string {
+		return list.Values(ResponseFieldName(name))
+	}
+	return &xmlFields{values, names, make(map[string]bool)}
+}
+
+// take returns all values of a field and marks it as encoded.
+func (f *xmlFields) take(name string) []string {
+	f.encoded[strings.ToLower(name)] = true
+	return f.values(name)
+}
+
+func (f *xmlFields) has(name string) bool {
+	return len(f.values(name)) > 0
+}
+
+// check returns an error for the first field that has not been encoded.
+func (f *xmlFields) check() error {
+	for _, name := range f.names {
+		if !f.encoded[strings.ToLower(name)] {
+			return fmt.Errorf("field %q %w", name, ErrXMLUnsupported)
+		}
+	}
+	return nil
+}
+
+// only returns whether all fields that have not been encoded yet are contained in names.
+func (f *xmlFields) only(names ...string) bool {
+	for _, name := range f.names {
+		found := f.encoded[strings.ToLower(name)]
+		for _, n := range names {
+			if strings.EqualFold(name, n) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// putXMLElements appends an element for every value of the mapped fields.
+func putXMLElements(parent *xmlElement, space string, mappings []xmlFieldMapping, fields *xmlFields) {
+	for _, m := range mappings {
+		for _, value := range fields.take(m.field) {
+			parent.addChild(space, m.local, value)
+		}
+	}
+}
+
+// putXMLAttributes sets an attribute for the mapped fields.
+func putXMLAttributes(element *xmlElement, mappings []xmlFieldMapping, fields *xmlFields) error {
+	for _, m := range mappings {
+		values := fields.take(m.field)
+		if len(values) > 1 {
+			return fmt.Errorf("multiple %s values %w", m.field, ErrXMLUnsupported)
+		}
+		if len(values) == 1 {
+			element.setAttr("", m.local, values[0])
+		}
+	}
+	return nil
+}
+
+func lookupXMLField(local string, mappings ...[]xmlFieldMapping) (string, bool) {
+	for _, list := range mappings {
+		for _, m := range list {
+			if m.local == local {
+				return m.field, true
+			}
+		}
+	}
+	return "", false
+}
+
+// xmlFieldSink receives the fields decoded from XML.
+type xmlFieldSink func(name string, values ...string)
+
+func decodeXMLAttributes(element *xmlElement, add xmlFieldSink, mappings ...[]xmlFieldMapping) error {
+	for _, attr := range element.attrs {
+		name, ok := lookupXMLField(attr.Name.Local, mappings...)
+		if !ok || len(attr.Name.Space) > 0 {
+			return fmt.Errorf("unexpected attribute %q of element %q", attr.Name.Local, element.name.Local)
+		}
+		add(name, attr.Value)
+	}
+	return nil
+}
+
+func decodeXMLElements(parent *xmlElement, space string, add xmlFieldSink, mappings ...[]xmlFieldMapping) error {
+	for _, child := range parent.children {
+		name, ok := lookupXMLField(child.name.Local, mappings...)
+		if !ok || child.name.Space != space {
+			return fmt.Errorf("unexpected element %q in %q", child.name.Local, parent.name.Local)
+		}
+		add(name, child.value())
+	}
+	return nil
+}
+
+// encodeXMLDomain appends the domain fields to element. contacts are encoded like the contact fields of a query.
+func encodeXMLDomain(element *xmlElement, fields *xmlFields, contacts []ResponseEntity) error {
+	putXMLElements(element, xmlNamespaceDomain, xmlDomainFields, fields)
+
+	for _, role := range xmlContactRoles {
+		for _, handle := range fields.take(role) {
+			element.addChild(xmlNamespaceDomain, "contact", handle).setAttr("", "role", role)
+		}
+	}
+	for _, entity := range contacts {
+		contact := element.addChild(xmlNamespaceDomain, "contact", "").setAttr("", "role", string(entity.Name().Normalize()))
+		entityFields := newXMLResponseFields(entity.Fields())
+		encodeXMLContact(contact, entityFields)
+		if err := entityFields.check(); err != nil {
+			return fmt.Errorf("%s: %w", entity.Name(), err)
+		}
+	}
+
+	owner := fields.values(string(QueryFieldNameDomainACE))
+	if len(owner) == 0 {
+		owner = fields.values(string(QueryFieldNameDomainIDN))
+	}
+	if len(owner) == 0 {
+		owner = []string{""}
+	}
+	for _, value := range fields.take(string(QueryFieldNameNameServer)) {
+		if err := encodeXMLNameServer(element, owner[0], value); err != nil {
+			return err
+		}
+	}
+	for _, value := range fields.take(string(QueryFieldNameDNSKey)) {
+		if err := encodeXMLDNSKey(element, owner[0], value); err != nil {
+			return err
+		}
+	}
+
+	putXMLElements(element, xmlNamespaceDomain, xmlDomainTrailingFields, fields)
+	return nil
+}
+
+func newXMLDNSEntry(parent *xmlElement, recordType, owner string) *xmlElement {
+	entry := parent.addChild(xmlNamespaceDNSEntry, "dnsentry", "").setAttr(xmlNamespaceXSI, "type", "dnsentry:"+recordType)
+	if len(owner) > 0 && !strings.HasSuffix(owner, ".") {
+		owner += "."
+	}
+	entry.addChild(xmlNamespaceDNSEntry, "owner", owner)
+	return entry.addChild(xmlNamespaceDNSEntry, "rdata", "")
+}
+
+func encodeXMLNameServer(parent *xmlElement, owner, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) == 0 {
+		return fmt.Errorf("name server is empty")
+	}
+	rdata := newXMLDNSEntry(parent, "NS", owner)
+	rdata.addChild(xmlNamespaceDNSEntry, "nameserver", parts[0])
+	for _, addr := range parts[1:] {
+		rdata.addChild(xmlNamespaceDNSEntry, "address", addr)
+	}
+	return nil
+}
+
+func encodeXMLDNSKey(parent *xmlElement, owner, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) < 4 {
+		return fmt.Errorf("dnskey must consist of flags, protocol, algorithm and public key")
+	}
+	rdata := newXMLDNSEntry(parent, "DNSKEY", owner)
+	rdata.addChild(xmlNamespaceDNSEntry, "flags", parts[0])
+	rdata.addChild(xmlNamespaceDNSEntry, "protocol", parts[1])
+	rdata.addChild(xmlNamespaceDNSEntry, "algorithm", parts[2])
+	rdata.addChild(xmlNamespaceDNSEntry, "publicKey", strings.Join(parts[3:], " "))
+	return nil
+}
+
+// decodeXMLDNSEntry returns the field name and value in key-value syntax of a dnsentry element.
+func decodeXMLDNSEntry(entry *xmlElement) (string, string, error) {
+	rdata := entry.child(xmlNamespaceDNSEntry, "rdata")
+	if rdata == nil {
+		return "", "", fmt.Errorf("dnsentry without rdata")
+	}
+	value := func(local string) string {
+		if child := rdata.child(xmlNamespaceDNSEntry, local); child != nil {
+			return child.value()
+		}
+		return ""
+	}
+
+	// the prefix of the type depends on the namespace declarations of the document
+	recordType := entry.attr("type")
+	recordType = recordType[strings.LastIndex(recordType, ":")+1:]
+	switch recordType {
+	case "NS":
+		parts := []string{value("nameserver")}
+		for _, child := range rdata.children {
+			if child.is(xmlNamespaceDNSEntry, "address") {
+				parts = append(parts, child.value())
+			}
+		}
+		if len(parts[0]) == 0 {
+			return "", "", fmt.Errorf("dnsentry without nameserver")
+		}
+		return string(QueryFieldNameNameServer), strings.Join(parts, " "), nil
+
+	case "DNSKEY":
+		parts := []string{value("flags"), value("protocol"), value("algorithm"), value("publicKey")}
+		for _, part := range parts {
+			if len(part) == 0 {
+				return "", "", fmt.Errorf("dnsentry must contain flags, protocol, algorithm and publicKey")
+			}
+		}
+		return string(QueryFieldNameDNSKey), strings.Join(parts, " "), nil
+
+	default:
+		return "", "", fmt.Errorf("unsupported dnsentry type %q", entry.attr("type"))
+	}
+}
+
+// decodeXMLDomain decodes the children of a domain element. contact is called for every contact element.
+func decodeXMLDomain(element *xmlElement, add xmlFieldSink, contact func(role string, e *xmlElement) error) error {
+	for _, child := range element.children {
+		switch {
+		case child.is(xmlNamespaceDomain, "contact"):
+			role := strings.ToLower(child.attr("role"))
+			if !containsString(xmlContactRoles, role) {
+				return fmt.Errorf("unsupported contact role %q", child.attr("role"))
+			}
+			if err := contact(role, child); err != nil {
+				return err
+			}
+
+		case child.is(xmlNamespaceDNSEntry, "dnsentry"):
+			name, value, err := decodeXMLDNSEntry(child)
+			if err != nil {
+				return err
+			}
+			add(name, value)
+
+		default:
+			name, ok := lookupXMLField(child.name.Local, xmlDomainFields, xmlDomainTrailingFields)
+			if !ok || child.name.Space != xmlNamespaceDomain {
+				return fmt.Errorf("unexpected element %q in %q", child.name.Local, element.name.Local)
+			}
+			add(name, child.value())
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeXMLContact appends the contact fields to element.
+func encodeXMLContact(element *xmlElement, fields *xmlFields) {
+	putXMLElements(element, xmlNamespaceContact, xmlContactFields, fields)
+	for _, m := range xmlPostalFields {
+		if fields.has(m.field) {
+			putXMLElements(element.addChild(xmlNamespaceContact, "postal", ""), xmlNamespaceContact, xmlPostalFields, fields)
+			break
+		}
+	}
+	putXMLElements(element, xmlNamespaceContact, xmlContactTrailingFields, fields)
+}
+
+// decodeXMLContact decodes the children of a contact element. verification is called for every verification
+// information and may be nil if none is expected.
+func decodeXMLContact(element *xmlElement, add xmlFieldSink, verification func(e *xmlElement) error) error {
+	for _, child := range element.children {
+		switch {
+		case child.is(xmlNamespaceContact, "postal"):
+			if err := decodeXMLElements(child, xmlNamespaceContact, add, xmlPostalFields); err != nil {
+				return err
+			}
+
+		case child.is(xmlNamespaceContact, "verificationInformation") && verification != nil:
+			if err := verification(child); err != nil {
+				return err
+			}
+
+		default:
+			name, ok := lookupXMLField(child.name.Local, xmlContactFields, xmlContactTrailingFields)
+			if !ok || child.name.Space != xmlNamespaceContact {
+				return fmt.Errorf("unexpected element %q in %q", child.name.Local, element.name.Local)
+			}
+			add(name, child.value())
+		}
+	}
+	return nil
+}
+
+// EncodeXML returns the query in the XML schema of the DENIC registry. An error is returned for fields and entities
+// that have no representation in the schema.
+func (q *Query) EncodeXML() (string, error) {
+	if q.Version() != LatestVersion {
+		return "", fmt.Errorf("version %s %w", q.Version(), ErrXMLUnsupported)
+	}
+	local, ok := xmlQueryActions[q.Action()]
+	if !ok {
+		return "", fmt.Errorf("action %s %w", q.Action(), ErrXMLUnsupported)
+	}
+	space := xmlActionNamespace(q.Action(), q.Object())
+
+	root := newXMLElement(xmlNamespaceGlobal, "registry-request")
+	element := root.addChild(space, local, "")
+	fields := newXMLQueryFields(q.fields)
+	fields.take(string(QueryFieldNameVersion))
+	fields.take(string(QueryFieldNameAction))
+	if err := putXMLAttributes(element, xmlQueryAttributes, fields); err != nil {
+		return "", err
+	}
+
+	switch space {
+	case xmlNamespaceGlobal:
+		putXMLElements(element, xmlNamespaceGlobal, xmlLoginFields, fields)
+	case xmlNamespaceDomain:
+		if err := encodeXMLDomain(element, fields, nil); err != nil {
+			return "", err
+		}
+	case xmlNamespaceContact:
+		encodeXMLContact(element, fields)
+	}
+	if err := fields.check(); err != nil {
+		return "", err
+	}
+
+	for _, entity := range q.entities {
+		if space != xmlNamespaceContact || entity.name.Normalize() != QueryEntityVerificationInformation.Normalize() {
+			return "", fmt.Errorf("entity %q %w", entity.name, ErrXMLUnsupported)
+		}
+		entityFields := newXMLQueryFields(entity.fields)
+		putXMLElements(element.addChild(xmlNamespaceContact, "verificationInformation", ""), xmlNamespaceContact, xmlVerificationFields, entityFields)
+		if err := entityFields.check(); err != nil {
+			return "", fmt.Errorf("%s: %w", entity.name, err)
+		}
+	}
+
+	return root.encode(), nil
+}
+
+// Encode returns the query in the given format. Key-value encoding is used for MessageFormatAuto.
+func (q *Query) Encode(format MessageFormat) (string, error) {
+	if format == MessageFormatXML {
+		return q.EncodeXML()
+	}
+	return q.EncodeKV(), nil
+}
+
+// ParseQueryXML parses a single query in the XML schema of the DENIC registry.
+func ParseQueryXML(str string) (*Query, error) {
+	root, err := parseXMLElement(str)
+	if err != nil {
+		return nil, fmt.Errorf("malformed xml query: %s", err.Error())
+	}
+	if !root.is(xmlNamespaceGlobal, "registry-request") {
+		return nil, fmt.Errorf("unexpected root element %q", root.name.Local)
+	}
+	if len(root.children) != 1 {
+		return nil, fmt.Errorf("query must contain exactly one action")
+	}
+
+	element := root.children[0]
+	action, ok := xmlQueryAction(element.name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported action element %q", element.name.Local)
+	}
+
+	fields := NewQueryFieldList()
+	var entities []QueryEntity
+	add := func(name string, values ...string) {
+		fields.Add(QueryFieldName(name), values...)
+	}
+	if err := decodeXMLAttributes(element, add, xmlQueryAttributes); err != nil {
+		return nil, err
+	}
+
+	switch element.name.Space {
+	case xmlNamespaceGlobal:
+		err = decodeXMLElements(element, xmlNamespaceGlobal, add, xmlLoginFields)
+
+	case xmlNamespaceDomain:
+		err = decodeXMLDomain(element, add, func(role string, e *xmlElement) error {
+			if len(e.children) > 0 {
+				return fmt.Errorf("contact %q must only contain a handle", role)
+			}
+			add(role, e.value())
+			return nil
+		})
+
+	case xmlNamespaceContact:
+		err = decodeXMLContact(element, add, func(e *xmlElement) error {
+			entity := NewQueryEntity(QueryEntityVerificationInformation, NewQueryFieldList())
+			entities = append(entities, entity)
+			return decodeXMLElements(e, xmlNamespaceContact, func(name string, values ...string) {
+				entities[len(entities)-1].fields.Add(QueryFieldName(name), values...)
+			}, xmlVerificationFields)
+		})
+
+	default:
+		if len(element.children) > 0 {
+			err = fmt.Errorf("unexpected content of %q", element.name.Local)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := NewQuery(LatestVersion, action, fields).WithEntities(entities...)
+	if err := validateQueryFields(query.fields); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// xmlMessageTypes maps the business message fields to the message types of the XML schema.
+var xmlMessageTypes = []struct {
+	field       ResponseFieldName
+	messageType string
+}{
+	{ResponseFieldNameInfo, "info"},
+	{ResponseFieldNameWarning, "warning"},
+	{ResponseFieldNameError, "error"},
+}
+
+// EncodeXML returns the response in the XML schema of the DENIC registry. An error is returned for fields and
+// entities that have no representation in the schema.
+func (r *Response) EncodeXML() (string, error) {
+	root := newXMLElement(xmlNamespaceGlobal, "registry-response")
+	transaction := root.addChild(xmlNamespaceTransaction, "transaction", "")
+	fields := newXMLResponseFields(r.fields)
+
+	putXMLElements(transaction, xmlNamespaceTransaction, []xmlFieldMapping{
+		{string(ResponseFieldNameSTID), "stid"},
+		{string(ResponseFieldNameResult), "result"},
+	}, fields)
+	for _, mt := range xmlMessageTypes {
+		for _, msg := range fields.take(string(mt.field)) {
+			bm, err := ParseBusinessMessageKV(msg)
+			if err != nil {
+				return "", fmt.Errorf("%s message %q %w: %s", mt.messageType, msg, ErrXMLUnsupported, err.Error())
+			}
+			message := transaction.addChild(xmlNamespaceTransaction, "message", "")
+			message.setAttr("", "msgcode", strconv.FormatInt(bm.ID(), 10)).setAttr("", "type", mt.messageType)
+			message.addChild(xmlNamespaceTransaction, "text", bm.Message())
+		}
+	}
+
+	data, err := r.encodeXMLData(fields)
+	if err != nil {
+		return "", err
+	}
+	if data != nil {
+		transaction.addChild(xmlNamespaceTransaction, "data", "").children = []*xmlElement{data}
+	}
+	return root.encode(), nil
+}
+
+// encodeXMLData returns the data element of the response or nil if the response contains no data. Responses to CHECK
+// are recognized by their fields and encoded as checkData.
+func (r *Response) encodeXMLData(fields *xmlFields) (*xmlElement, error) {
+	for _, entity := range r.entities {
+		if entity.Name().Normalize() == ResponseEntityNameMsg {
+			data, err := r.encodeXMLQueueMessage(entity)
+			if err != nil {
+				return nil, err
+			}
+			return data, fields.check()
+		}
+	}
+
+	var data *xmlElement
+	switch {
+	case fields.has(string(ResponseFieldNameDomainIDN)) || fields.has(string(ResponseFieldNameDomainACE)):
+		var contacts []ResponseEntity
+		for _, entity := range r.entities {
+			if !containsString(xmlContactRoles, string(entity.Name().Normalize())) {
+				return nil, fmt.Errorf("entity %q %w", entity.Name(), ErrXMLUnsupported)
+			}
+			contacts = append(contacts, entity)
+		}
+		local := "infoData"
+		if len(contacts) == 0 && fields.only(string(ResponseFieldNameDomainIDN), string(ResponseFieldNameDomainACE), string(ResponseFieldNameStatus)) {
+			local = "checkData"
+		}
+		data = newXMLElement(xmlNamespaceDomain, local)
+		if err := encodeXMLDomain(data, fields, contacts); err != nil {
+			return nil, err
+		}
+
+	case fields.has(string(ResponseFieldNameHandle)):
+		local := "infoData"
+		if len(r.entities) == 0 && fields.only(string(ResponseFieldNameHandle), string(ResponseFieldNameStatus)) {
+			local = "checkData"
+		}
+		data = newXMLElement(xmlNamespaceContact, local)
+		encodeXMLContact(data, fields)
+		for _, entity := range r.entities {
+			if entity.Name().Normalize() != ResponseEntityName(QueryEntityVerificationInformation).Normalize() {
+				return nil, fmt.Errorf("entity %q %w", entity.Name(), ErrXMLUnsupported)
+			}
+			entityFields := newXMLResponseFields(entity.Fields())
+			putXMLElements(data.addChild(xmlNamespaceContact, "verificationInformation", ""), xmlNamespaceContact, xmlVerificationFields, entityFields)
+			if err := entityFields.check(); err != nil {
+				return nil, fmt.Errorf("%s: %w", entity.Name(), err)
+			}
+		}
+
+	case len(r.entities) > 0:
+		return nil, fmt.Errorf("entity %q %w", r.entities[0].Name(), ErrXMLUnsupported)
+	}
+
+	if err := fields.check(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// encodeXMLQueueMessage returns the message element for a queue message with the payload contained in the entity
+// named like the message type.
+func (r *Response) encodeXMLQueueMessage(msgEntity ResponseEntity) (*xmlElement, error) {
+	message := newXMLElement(xmlNamespaceMsg, "message")
+	msgFields := newXMLResponseFields(msgEntity.Fields())
+	if err := putXMLAttributes(message, xmlQueueMessageAttributes, msgFields); err != nil {
+		return nil, err
+	}
+	if err := msgFields.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", msgEntity.Name(), err)
+	}
+
+	msgType := msgEntity.Fields().FirstValue(ResponseFieldNameMsgType)
+	for _, entity := range r.entities {
+		if entity.Name().Normalize() == ResponseEntityNameMsg {
+			continue
+		}
+		if len(msgType) == 0 || entity.Name().Normalize() != ResponseEntityName(msgType).Normalize() {
+			return nil, fmt.Errorf("entity %q %w", entity.Name(), ErrXMLUnsupported)
+		}
+		payloadFields := newXMLResponseFields(entity.Fields())
+		putXMLElements(message.addChild(xmlNamespaceMsg, msgType, ""), xmlNamespaceMsg, xmlQueuePayloadFields, payloadFields)
+		if err := payloadFields.check(); err != nil {
+			return nil, fmt.Errorf("%s: %w", entity.Name(), err)
+		}
+	}
+	return message, nil
+}
+
+// Encode returns the response in the given format. Key-value encoding is used for MessageFormatAuto.
+func (r *Response) Encode(format MessageFormat) (string, error) {
+	if format == MessageFormatXML {
+		return r.EncodeXML()
+	}
+	return r.EncodeKV(), nil
+}
+
+// ParseResponseXML parses a response object from the given response string in the XML schema of the DENIC registry.
+func ParseResponseXML(str string) (*Response, error) {
+	root, err := parseXMLElement(str)
+	if err != nil {
+		return nil, fmt.Errorf("malformed xml response: %s", err.Error())
+	}
+	if !root.is(xmlNamespaceGlobal, "registry-response") {
+		return nil, fmt.Errorf("unexpected root element %q", root.name.Local)
+	}
+	transaction := root.child(xmlNamespaceTransaction, "transaction")
+	if transaction == nil || len(root.children) != 1 {
+		return nil, fmt.Errorf("response must contain exactly one transaction")
+	}
+
+	fields := NewResponseFieldList()
+	entities := make([]ResponseEntity, 0)
+	for _, child := range transaction.children {
+		switch {
+		case child.is(xmlNamespaceTransaction, "stid"):
+			fields.Add(ResponseFieldNameSTID, child.value())
+
+		case child.is(xmlNamespaceTransaction, "result"):
+			fields.Add(ResponseFieldNameResult, child.value())
+
+		case child.is(xmlNamespaceTransaction, "message"):
+			field, err := decodeXMLMessage(child)
+			if err != nil {
+				return nil, err
+			}
+			fields.Add(field.Name, field.Value)
+
+		case child.is(xmlNamespaceTransaction, "data"):
+			if len(child.children) != 1 {
+				return nil, fmt.Errorf("data must contain exactly one element")
+			}
+			dataEntities, err := decodeXMLData(child.children[0], &fields)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, dataEntities...)
+
+		default:
+			return nil, fmt.Errorf("unexpected element %q in %q", child.name.Local, transaction.name.Local)
+		}
+	}
+
+	if err := validateResponseFields(fields); err != nil {
+		return nil, err
+	}
+	return &Response{fields, entities}, nil
+}
+
+// decodeXMLMessage returns the business message field of a message element.
+func decodeXMLMessage(message *xmlElement) (ResponseField, error) {
+	id, err := strconv.ParseInt(message.attr("msgcode"), 10, 64)
+	if err != nil {
+		return ResponseField{}, fmt.Errorf("invalid message code %q", message.attr("msgcode"))
+	}
+	text := ""
+	if child := message.child(xmlNamespaceTransaction, "text"); child != nil {
+		text = child.value()
+	}
+	for _, mt := range xmlMessageTypes {
+		if strings.EqualFold(message.attr("type"), mt.messageType) {
+			return ResponseField{mt.field, NewBusinessMessage(id, text).String()}, nil
+		}
+	}
+	return ResponseField{}, fmt.Errorf("unsupported message type %q", message.attr("type"))
+}
+
+// decodeXMLData adds the fields of a data element to fields and returns the entities.
+func decodeXMLData(data *xmlElement, fields *ResponseFieldList) ([]ResponseEntity, error) {
+	var entities []ResponseEntity
+	add := func(name string, values ...string) {
+		fields.Add(ResponseFieldName(name), values...)
+	}
+	// newEntity appends an entity and returns the sink for its fields
+	newEntity := func(name ResponseEntityName) xmlFieldSink {
+		entities = append(entities, NewResponseEntity(name.Normalize(), NewResponseFieldList()))
+		i := len(entities) - 1
+		return func(name string, values ...string) {
+			entities[i].fields.Add(ResponseFieldName(name), values...)
+		}
+	}
+
+	var err error
+	switch {
+	case data.is(xmlNamespaceDomain, "infoData"), data.is(xmlNamespaceDomain, "checkData"):
+		err = decodeXMLDomain(data, add, func(role string, e *xmlElement) error {
+			entityAdd := newEntity(ResponseEntityName(role))
+			if len(e.children) == 0 {
+				entityAdd(string(ResponseFieldNameHandle), e.value())
+				return nil
+			}
+			return decodeXMLContact(e, entityAdd, nil)
+		})
+
+	case data.is(xmlNamespaceContact, "infoData"), data.is(xmlNamespaceContact, "checkData"):
+		err = decodeXMLContact(data, add, func(e *xmlElement) error {
+			return decodeXMLElements(e, xmlNamespaceContact, newEntity(ResponseEntityName(QueryEntityVerificationInformation)), xmlVerificationFields)
+		})
+
+	case data.is(xmlNamespaceMsg, "message"):
+		if err = decodeXMLAttributes(data, newEntity(ResponseEntityNameMsg), xmlQueueMessageAttributes); err != nil {
+			return nil, err
+		}
+		for _, payload := range data.children {
+			if payload.name.Space != xmlNamespaceMsg {
+				return nil, fmt.Errorf("unexpected element %q in %q", payload.name.Local, data.name.Local)
+			}
+			if err = decodeXMLElements(payload, xmlNamespaceMsg, newEntity(ResponseEntityName(payload.name.Local)), xmlQueuePayloadFields); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		err = fmt.Errorf("unsupported data element %q", data.name.Local)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
@@ -0,0 +1,297 @@
+package rri
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustEncodeQueryXML(t *testing.T, query *Query) string {
+	msg, err := query.EncodeXML()
+	require.NoError(t, err)
+	return msg
+}
+
+func mustEncodeResponseXML(t *testing.T, response *Response) string {
+	msg, err := response.EncodeXML()
+	require.NoError(t, err)
+	return msg
+}
+
+// assertSameQuery compares fields and entities regardless of the field order, which is defined by the XML schema.
+func assertSameQuery(t *testing.T, expected, actual *Query) {
+	assertSameQueryFields(t, expected.Fields(), actual.Fields())
+	require.Len(t, actual.Entities(), len(expected.Entities()))
+	for i, entity := range expected.Entities() {
+		assert.Equal(t, entity.Name(), actual.Entities()[i].Name())
+		assertSameQueryFields(t, entity.Fields(), actual.Entities()[i].Fields())
+	}
+}
+
+func assertSameQueryFields(t *testing.T, expected, actual QueryFieldList) {
+	assert.Equal(t, expected.Size(), actual.Size())
+	for _, f := range expected {
+		assert.Equal(t, expected.Values(f.Name), actual.Values(f.Name), "field %s", f.Name)
+	}
+}
+
+func assertSameResponse(t *testing.T, expected, actual *Response) {
+	assertSameResponseFields(t, expected.Fields(), actual.Fields())
+	require.Len(t, actual.Entities(), len(expected.Entities()))
+	for i, entity := range expected.Entities() {
+		assert.Equal(t, entity.Name().Normalize(), actual.Entities()[i].Name())
+		assertSameResponseFields(t, entity.Fields(), actual.Entities()[i].Fields())
+	}
+}
+
+func assertSameResponseFields(t *testing.T, expected, actual ResponseFieldList) {
+	assert.Equal(t, expected.Size(), actual.Size())
+	for _, f := range expected {
+		assert.Equal(t, expected.Values(f.Name), actual.Values(f.Name), "field %s", f.Name)
+	}
+}
+
+func TestQueryEncodeXML(t *testing.T) {
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<registry-request xmlns=\"http://registry.denic.de/global/5.0\">\n\t<login>\n\t\t<user>DENIC-1000011-TEST</user>\n\t\t<password>secret</password>\n\t</login>\n</registry-request>",
+		mustEncodeQueryXML(t, NewLoginQuery("DENIC-1000011-TEST", "secret")))
+
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<registry-request xmlns=\"http://registry.denic.de/global/5.0\" xmlns:domain=\"http://registry.denic.de/domain/5.0\">\n\t<domain:info>\n\t\t<domain:handle>dönic.de</domain:handle>\n\t\t<domain:ace>xn--dnic-5qa.de</domain:ace>\n\t</domain:info>\n</registry-request>",
+		mustEncodeQueryXML(t, NewInfoDomainQuery("dönic.de")))
+
+	msg := mustEncodeQueryXML(t, NewUpdateDomainQuery("denic.de", DomainData{
+		HolderHandles: []DenicHandle{NewDenicHandle(1000011, "HOLDER")},
+		NameServers:   []NameServer{{HostName: "ns1.denic.de"}},
+	}))
+	assert.Contains(t, msg, "<domain:contact role=\"holder\">DENIC-1000011-HOLDER</domain:contact>")
+	assert.Contains(t, msg, "<dnsentry:dnsentry xsi:type=\"dnsentry:NS\">\n\t\t\t<dnsentry:owner>denic.de.</dnsentry:owner>\n\t\t\t<dnsentry:rdata>\n\t\t\t\t<dnsentry:nameserver>ns1.denic.de</dnsentry:nameserver>\n\t\t\t</dnsentry:rdata>\n\t\t</dnsentry:dnsentry>")
+
+	assert.Contains(t, mustEncodeQueryXML(t, NewCheckHandleQuery(NewDenicHandle(1000011, "SOME-DUDE"))), "<contact:check>\n\t\t<contact:handle>DENIC-1000011-SOME-DUDE</contact:handle>\n\t</contact:check>")
+	assert.Contains(t, mustEncodeQueryXML(t, NewQueueDeleteQuery("4711", "expire")), "<msg:delete msgid=\"4711\" msgType=\"expire\"/>")
+	assert.Contains(t, mustEncodeQueryXML(t, NewTransitDomainQuery("denic.de", true)), "<domain:transit disconnect=\"true\">")
+}
+
+func TestQueryXMLRoundTrip(t *testing.T) {
+	handle := NewDenicHandle(1000011, "SOME-DUDE")
+	queries := []*Query{
+		NewLoginQuery("DENIC-1000011-TEST", "secret"),
+		NewLogoutQuery(),
+		NewCreateContactQuery(handle, validContactData()),
+		NewCreateContactQuery(handle, ContactData{Type: ContactTypeOrganisation, Name: "DENIC eG", Organisation: "DENIC eG", Address: "Theodor-Stern-Kai 1\nHaus 2", PostalCode: "60596", City: "Frankfurt am Main", CountryCode: "DE", EMail: []string{"info@denic.de", "abuse@denic.de"}}),
+		NewCheckHandleQuery(handle),
+		NewInfoHandleQuery(handle),
+		NewCreateDomainQuery("dönic.de", validDomainData()),
+		NewCheckDomainQuery("denic.de"),
+		NewInfoDomainQuery("denic.de"),
+		NewUpdateDomainQuery("denic.de", validDomainData()),
+		NewChangeHolderQuery("denic.de", validDomainData()),
+		NewDeleteDomainQuery("denic.de"),
+		NewRestoreDomainQuery("denic.de"),
+		NewTransitDomainQuery("denic.de", true),
+		NewTransitDomainQuery("denic.de", false),
+		NewCreateAuthInfo1Query("denic.de", "secret", time.Date(2020, time.September, 25, 0, 0, 0, 0, time.UTC)),
+		NewCreateAuthInfo2Query("denic.de"),
+		NewChangeProviderQuery("denic.de", "secret", validDomainData()),
+		NewQueueReadQuery(""),
+		NewQueueReadQuery(string(QueueMessageTypeExpire)),
+		NewQueueDeleteQuery("4711", ""),
+		NewQueueDeleteQuery("4711", string(QueueMessageTypeExpire)),
+	}
+
+	for _, query := range queries {
+		t.Run(string(query.Action()), func(t *testing.T) {
+			encoded := mustEncodeQueryXML(t, query)
+			assert.True(t, IsXML(encoded))
+			assert.Equal(t, MessageFormatXML, DetectMessageFormat(encoded))
+			parsed, err := ParseQuery(encoded)
+			require.NoError(t, err)
+			assertSameQuery(t, query, parsed)
+			assert.Equal(t, encoded, mustEncodeQueryXML(t, parsed))
+		})
+	}
+}
+
+func TestQueryEncodeXMLUnsupported(t *testing.T) {
+	fields := NewQueryFieldList()
+	fields.Add("foo", "bar")
+	_, err := NewQuery(LatestVersion, ActionInfo, fields).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	_, err = NewQuery("4.0", ActionLogout, nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+	_, err = NewQuery(LatestVersion, "FOO", nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	// entities are only defined for contacts
+	_, err = NewInfoDomainQuery("denic.de").WithEntity(QueryEntityVerificationInformation, nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+	_, err = NewCheckHandleQuery(NewDenicHandle(1000011, "SOME-DUDE")).WithEntity("Empty", nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	// handles of domains are encoded as contacts
+	fields = NewQueryFieldList()
+	fields.Add(QueryFieldNameHandle, "DENIC-1000011-SOME-DUDE")
+	_, err = NewQuery(LatestVersion, ActionDelete, fields).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+}
+
+func TestParseQueryXMLInvalid(t *testing.T) {
+	for _, msg := range []string{
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"><logout/>",
+		"<registry-request><logout/></registry-request>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\"><logout/></registry-response>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"><logout/><logout/></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"><domain:info xmlns:domain=\"http://registry.denic.de/msg/5.0\"/></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"><foo/></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\"><login><foo>bar</foo></login></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\" xmlns:domain=\"http://registry.denic.de/domain/5.0\"><domain:info foo=\"bar\"/></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\" xmlns:domain=\"http://registry.denic.de/domain/5.0\"><domain:create><domain:contact role=\"foo\">DENIC-1-FOO</domain:contact></domain:create></registry-request>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\" xmlns:domain=\"http://registry.denic.de/domain/5.0\" xmlns:dnsentry=\"http://registry.denic.de/dnsentry/5.0\"><domain:create><dnsentry:dnsentry><dnsentry:rdata/></dnsentry:dnsentry></domain:create></registry-request>",
+	} {
+		_, err := ParseQueryXML(msg)
+		assert.Error(t, err, msg)
+	}
+}
+
+func TestParseQueryXMLPrefixes(t *testing.T) {
+	// namespaces are resolved independent of the prefixes used by the sender
+	query, err := ParseQuery("<?xml version=\"1.0\"?>\n<r:registry-request xmlns:r=\"http://registry.denic.de/global/5.0\" xmlns:d=\"http://registry.denic.de/domain/5.0\" xmlns:e=\"http://registry.denic.de/dnsentry/5.0\" xmlns:x=\"http://www.w3.org/2001/XMLSchema-instance\">" +
+		"<d:update><d:handle>denic.de</d:handle><d:ace>denic.de</d:ace>" +
+		"<e:dnsentry x:type=\"e:NS\"><e:owner>denic.de.</e:owner><e:rdata><e:nameserver>ns1.denic.de.</e:nameserver><e:address>81.91.170.1</e:address></e:rdata></e:dnsentry>" +
+		"</d:update></r:registry-request>")
+	require.NoError(t, err)
+	assert.Equal(t, ActionUpdate, query.Action())
+	assert.Equal(t, LatestVersion, query.Version())
+	assert.Equal(t, []string{"ns1.denic.de. 81.91.170.1"}, query.Field(QueryFieldNameNameServer))
+}
+
+func TestResponseEncodeXML(t *testing.T) {
+	response := NewResponseWithInfo(ResultSuccess, nil, MockMessageTestEnvironment).WithField(ResponseFieldNameSTID, "4711")
+	assert.Equal(t, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\">\n\t<tr:transaction>\n\t\t<tr:stid>4711</tr:stid>\n\t\t<tr:result>success</tr:result>\n\t\t<tr:message msgcode=\"13000000011\" type=\"info\">\n\t\t\t<tr:text>Request was processed in test environment - not valid in real world [testing platform]</tr:text>\n\t\t</tr:message>\n\t</tr:transaction>\n</registry-response>",
+		mustEncodeResponseXML(t, response))
+
+	checkFields := NewResponseFieldList()
+	checkFields.Add(ResponseFieldNameDomainIDN, "denic.de")
+	checkFields.Add(ResponseFieldNameDomainACE, "denic.de")
+	checkFields.Add(ResponseFieldNameStatus, string(DomainStatusFree))
+	assert.Contains(t, mustEncodeResponseXML(t, NewResponse(ResultSuccess, checkFields)), "<domain:checkData>")
+	checkFields.Add(ResponseFieldNameRegAccID, "DENIC-1000011")
+	assert.Contains(t, mustEncodeResponseXML(t, NewResponse(ResultSuccess, checkFields)), "<domain:infoData>")
+}
+
+func TestResponseXMLRoundTrip(t *testing.T) {
+	domainFields := NewResponseFieldList()
+	domainFields.Add(ResponseFieldNameDomainIDN, "dönic.de")
+	domainFields.Add(ResponseFieldNameDomainACE, "xn--dnic-5qa.de")
+	domainFields.Add(ResponseFieldNameNameServer, "ns1.denic.de 81.91.170.1", "ns2.denic.de")
+	domainFields.Add(ResponseFieldNameDNSKey, "257 3 8 AwEAAb1Xh6Y=")
+	domainFields.Add(ResponseFieldNameStatus, string(DomainStatusConnect))
+	domainFields.Add(ResponseFieldNameRegAccID, "DENIC-1000011")
+	domainFields.Add(ResponseFieldNameRegAccName, "Registrar 1000011")
+	domainFields.Add(ResponseFieldNameChanged, "2020-09-25T12:00:00+02:00")
+	holderFields := NewResponseFieldList()
+	holderFields.Add(ResponseFieldNameHandle, "DENIC-1000011-HOLDER")
+	holderFields.Add(ResponseFieldNameType, "PERSON")
+	holderFields.Add(ResponseFieldNameName, "Dagobert Duck")
+	holderFields.Add(ResponseFieldNameAddress, "Im Geldspeicher")
+	holderFields.Add(ResponseFieldNameCity, "Entenhausen")
+	abuseFields := NewResponseFieldList()
+	abuseFields.Add(ResponseFieldNameHandle, "DENIC-1000011-ABUSE")
+
+	contactFields := NewResponseFieldList()
+	contactFields.Add(ResponseFieldNameHandle, "DENIC-1000011-SOME-DUDE")
+	contactFields.Add(ResponseFieldNameType, "ORG")
+	contactFields.Add(ResponseFieldNameName, "DENIC eG")
+	contactFields.Add(ResponseFieldNameOrganisation, "DENIC eG")
+	contactFields.Add(ResponseFieldNameAddress, "Theodor-Stern-Kai 1", "Haus 2")
+	contactFields.Add(ResponseFieldNamePostalCode, "60596")
+	contactFields.Add(ResponseFieldNameCity, "Frankfurt am Main")
+	contactFields.Add(ResponseFieldNameCountryCode, "DE")
+	contactFields.Add(ResponseFieldNameEMail, "info@denic.de")
+	contactFields.Add(ResponseFieldNamePhone, "+49.6927235")
+	contactFields.Add(ResponseFieldNameChanged, "2020-09-25T12:00:00+02:00")
+	verificationFields := NewResponseFieldList()
+	verificationFields.Add(ResponseFieldName(QueryFieldNameVerifiedClaim), "name", "address")
+	verificationFields.Add(ResponseFieldName(QueryFieldNameVerificationResult), "success")
+
+	checkFields := NewResponseFieldList()
+	checkFields.Add(ResponseFieldNameHandle, "DENIC-1000011-SOME-DUDE")
+	checkFields.Add(ResponseFieldNameStatus, string(DomainStatusFree))
+
+	msgFields := NewResponseFieldList()
+	msgFields.Add(ResponseFieldNameMsgID, "4711")
+	msgFields.Add(ResponseFieldNameMsgType, string(QueueMessageTypeChangeProvider))
+	msgFields.Add(ResponseFieldNameMsgTime, "2020-09-25T12:00:00+02:00")
+	payloadFields := NewResponseFieldList()
+	payloadFields.Add(ResponseFieldNameDomainIDN, "denic.de")
+	payloadFields.Add(ResponseFieldNameRegAccID, "DENIC-1000012")
+
+	responses := map[string]*Response{
+		"empty":   NewResponse(ResultSuccess, nil),
+		"failure": NewResponseWithError(ResultFailure, nil, MockMessageDomainNotFound, NewBusinessMessage(83000000001, "Some error")).WithField(ResponseFieldNameWarning, "53000000001 Some warning"),
+		"domain": NewResponseWithInfo(ResultSuccess, domainFields, MockMessageTestEnvironment).
+			WithEntity(ResponseEntityNameHolder, holderFields).
+			WithEntity(ResponseEntityNameAbuseContact, abuseFields),
+		"contact": NewResponse(ResultSuccess, contactFields).
+			WithEntity(ResponseEntityName(QueryEntityVerificationInformation), verificationFields),
+		"contact-check": NewResponse(ResultSuccess, checkFields),
+		"queue": NewResponse(ResultSuccess, nil).
+			WithEntity(ResponseEntityNameMsg, msgFields).
+			WithEntity(ResponseEntityName(QueueMessageTypeChangeProvider), payloadFields),
+	}
+
+	for name, response := range responses {
+		t.Run(name, func(t *testing.T) {
+			encoded := mustEncodeResponseXML(t, response)
+			assert.True(t, IsXML(encoded))
+			parsed, err := ParseResponse(encoded)
+			require.NoError(t, err)
+			assertSameResponse(t, response, parsed)
+			assert.Equal(t, encoded, mustEncodeResponseXML(t, parsed))
+		})
+	}
+
+	parsed, err := ParseResponseXML(mustEncodeResponseXML(t, responses["queue"]))
+	require.NoError(t, err)
+	msg, err := parsed.QueueMessage()
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	assert.Equal(t, "4711", msg.ID)
+	assert.Equal(t, ChangeProviderPayload{"denic.de", "DENIC-1000012"}, msg.Payload)
+}
+
+func TestResponseEncodeXMLUnsupported(t *testing.T) {
+	fields := NewResponseFieldList()
+	fields.Add("foo", "bar")
+	_, err := NewResponse(ResultSuccess, fields).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	_, err = NewResponse(ResultSuccess, nil).WithField(ResponseFieldNameInfo, "no id").EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	_, err = NewResponse(ResultSuccess, nil).WithEntity(ResponseEntityNameHolder, nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+
+	fields = NewResponseFieldList()
+	fields.Add(ResponseFieldNameDomainIDN, "denic.de")
+	_, err = NewResponse(ResultSuccess, fields).WithEntity("foo", nil).EncodeXML()
+	assert.ErrorIs(t, err, ErrXMLUnsupported)
+}
+
+func TestParseResponseXMLInvalid(t *testing.T) {
+	for _, msg := range []string{
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\">",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\"></registry-response>",
+		"<registry-request xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\"><tr:transaction><tr:result>success</tr:result></tr:transaction></registry-request>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\"><tr:transaction><tr:stid>4711</tr:stid></tr:transaction></registry-response>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\"><tr:transaction><tr:result>success</tr:result><tr:message type=\"info\"><tr:text>no id</tr:text></tr:message></tr:transaction></registry-response>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\"><tr:transaction><tr:result>success</tr:result><tr:message msgcode=\"1\" type=\"foo\"><tr:text>foo</tr:text></tr:message></tr:transaction></registry-response>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\"><tr:transaction><tr:result>success</tr:result><tr:data><foo/></tr:data></tr:transaction></registry-response>",
+		"<registry-response xmlns=\"http://registry.denic.de/global/5.0\" xmlns:tr=\"http://registry.denic.de/transaction/5.0\" xmlns:domain=\"http://registry.denic.de/domain/5.0\"><tr:transaction><tr:result>success</tr:result><tr:data><domain:infoData><domain:foo/></domain:infoData></tr:data></tr:transaction></registry-response>",
+	} {
+		_, err := ParseResponseXML(msg)
+		assert.Error(t, err, msg)
+	}
+}